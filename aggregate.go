@@ -0,0 +1,796 @@
+package jdb
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrInvalidBucket returns when downsampling with a bucket size of zero, or less
+	ErrInvalidBucket = errors.New("bucket size must be greater than zero")
+
+	// ErrInvalidQuantile returns when calling Quantile with a quantile outside of
+	// the range 0 to 1
+	ErrInvalidQuantile = errors.New("quantile must be between 0 and 1")
+
+	// ErrNoData returns from queries and aggregations which can't produce a
+	// meaningful result from no data, such as when no Measurements within the
+	// specified range contain the requested dimension
+	ErrNoData = errors.New("no data in range")
+
+	// ErrTooFewValues returns from aggregations which need more than one value,
+	// such as Variance, where only a single Measurement contains the dimension
+	ErrTooFewValues = errors.New("at least two values are needed")
+
+	// ErrInvalidWindow returns when calling MovingAverage with a window of zero, or less
+	ErrInvalidWindow = errors.New("window must be greater than zero")
+
+	// ErrInvalidEdges returns when calling Histogram with edges which aren't in
+	// strictly increasing order, or which contain NaN
+	ErrInvalidEdges = errors.New("edges must be strictly increasing")
+)
+
+// AggregateFunc reduces the values of a dimension within a Bucket into a single
+// value. AggregateFuncs are only ever called with at least one value, and values
+// are always ordered by the When of the Measurement they came from, such that
+// order sensitive functions like First and Last sample a state within a Bucket.
+//
+// AggregateFuncs may return NaN where values can't be aggregated, such as the Variance
+// of a single value, in which case the Bucket is left Empty.
+//
+// jdb provides Sum, Mean, Min, Max, Count, First, Last, Variance, and StdDev, but any
+// function with this signature may be used
+type AggregateFunc func(values []float64) float64
+
+var (
+	// Sum returns the total of all values
+	Sum AggregateFunc = func(values []float64) (sum float64) {
+		for _, v := range values {
+			sum += v
+		}
+
+		return
+	}
+
+	// Mean returns the arithmetic mean of all values
+	Mean AggregateFunc = func(values []float64) float64 {
+		return Sum(values) / float64(len(values))
+	}
+
+	// Min returns the smallest value
+	Min AggregateFunc = func(values []float64) float64 {
+		return slices.Min(values)
+	}
+
+	// Max returns the largest value
+	Max AggregateFunc = func(values []float64) float64 {
+		return slices.Max(values)
+	}
+
+	// Count returns the number of values
+	Count AggregateFunc = func(values []float64) float64 {
+		return float64(len(values))
+	}
+
+	// First returns the earliest value, which is the first of values
+	First AggregateFunc = func(values []float64) float64 {
+		return values[0]
+	}
+
+	// Last returns the latest value, which is the last of values
+	Last AggregateFunc = func(values []float64) float64 {
+		return values[len(values)-1]
+	}
+
+	// Variance returns the sample variance of values, or NaN where there are
+	// fewer than two values
+	Variance AggregateFunc = variance
+
+	// StdDev returns the sample standard deviation of values, or NaN where there
+	// are fewer than two values
+	StdDev AggregateFunc = func(values []float64) float64 {
+		return math.Sqrt(variance(values))
+	}
+)
+
+// variance computes the sample variance of values in a single pass, using
+// Welford's algorithm, which avoids the loss of precision caused by subtracting
+// large sums of squares from one another
+func variance(values []float64) float64 {
+	if len(values) < 2 {
+		return math.NaN()
+	}
+
+	var mean, m2 float64
+
+	for i, v := range values {
+		delta := v - mean
+		mean += delta / float64(i+1)
+		m2 += delta * (v - mean)
+	}
+
+	return m2 / float64(len(values)-1)
+}
+
+// Bucket is a single point in a downsampled series, covering the period from
+// Start until Start plus the bucket size
+type Bucket struct {
+	// Start is the (inclusive) start of the period this Bucket covers
+	Start time.Time `json:"start"`
+
+	// Value is the output of the AggregateFunc for this Bucket, and is zero
+	// for Empty Buckets
+	Value float64 `json:"value"`
+
+	// Count is the number of values which fell within this Bucket
+	Count int `json:"count"`
+
+	// Empty is true where no values fell within this Bucket, or where the
+	// AggregateFunc couldn't aggregate them, such as the Variance of a single
+	// value, in which case Count is still set
+	Empty bool `json:"empty"`
+
+	// Filled is true where Value has been derived from surrounding Buckets
+	// by `Fill`, rather than aggregated. Filled Buckets remain Empty
+	Filled bool `json:"filled"`
+}
+
+// FillPolicy determines how `Fill` fills Empty Buckets
+type FillPolicy int
+
+const (
+	// FillNone leaves Empty Buckets as they are
+	FillNone FillPolicy = iota
+
+	// FillPrevious carries the value of the last non-Empty Bucket forward
+	FillPrevious
+
+	// FillLinear interpolates between the non-Empty Buckets either side
+	FillLinear
+)
+
+// Fill returns a copy of b with Empty Buckets filled according to policy, which
+// is useful for charting libraries which can't cope with gaps in series.
+//
+// Filled Buckets have Filled set, and otherwise remain Empty with a Count of zero,
+// so that they can still be distinguished from real data.
+//
+// Buckets which can't be filled, such as leading Empty Buckets under FillPrevious
+// (which have no previous value to carry forward), or leading and trailing Empty
+// Buckets under FillLinear, are left Empty and unfilled
+func Fill(b []Bucket, policy FillPolicy) []Bucket {
+	b = slices.Clone(b)
+
+	prev := -1
+	for i := range b {
+		if !b[i].Empty {
+			if policy == FillLinear && prev >= 0 {
+				for k := prev + 1; k < i; k++ {
+					frac := float64(k-prev) / float64(i-prev)
+
+					b[k].Value = b[prev].Value + (b[i].Value-b[prev].Value)*frac
+					b[k].Filled = true
+				}
+			}
+
+			prev = i
+
+			continue
+		}
+
+		if policy == FillPrevious && prev >= 0 {
+			b[i].Value = b[prev].Value
+			b[i].Filled = true
+		}
+	}
+
+	return b
+}
+
+// DimStats holds summary statistics for a single dimension across a set
+// of Measurements
+type DimStats struct {
+	Min   float64
+	Max   float64
+	Mean  float64
+	Sum   float64
+	Count int
+}
+
+// QueryWithStats works identically to `QueryAll`, but additionally returns summary
+// statistics for a specific dimension across the returned Measurements.
+//
+// This is useful for dashboards which show a series alongside its min/ max/ average,
+// since the statistics are computed in the same pass as the query, against exactly the
+// data returned, rather than via a separate query which may return different data.
+//
+// Measurements which don't contain the dimension are still returned, but are ignored
+// for the purposes of statistics. Where no returned Measurements contain the dimension,
+// DimStats is returned empty, with a Count of zero.
+func (j *JDB) QueryWithStats(name, dimension string, opts *Options) (m []*Measurement, stats DimStats, err error) {
+	defer logSlowQuery("QueryWithStats", name, opts, time.Now(), &m)
+
+	stats.Min = math.Inf(1)
+	stats.Max = math.Inf(-1)
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err = j.queryAllFunc(name, opts, true, func(measurement *Measurement) {
+		v, ok := measurement.dimension(dimension)
+		if !ok {
+			return
+		}
+
+		stats.Count++
+		stats.Sum += v
+		stats.Min = min(stats.Min, v)
+		stats.Max = max(stats.Max, v)
+	})
+	if err != nil || stats.Count == 0 {
+		return m, DimStats{}, err
+	}
+
+	stats.Mean = stats.Sum / float64(stats.Count)
+
+	return
+}
+
+// Point is a single derived value at a specific time, such as returned by `Rate`
+type Point struct {
+	When  time.Time `json:"when"`
+	Value float64   `json:"value"`
+}
+
+// Rate treats a dimension as a monotonic counter, and returns its per-second rate
+// of change between each consecutive pair of Measurements, similarly to Prometheus'
+// `rate()` function.
+//
+// Each Point is timestamped with the later Measurement of its pair. Where a counter
+// decreases, Rate assumes it has been reset and started again from zero, rather than
+// returning a large negative rate.
+//
+// Measurements which don't contain the dimension are ignored, as are Measurements
+// which share a timestamp with their predecessor (such as those created by Upsert),
+// in which case the latter value is used. Where fewer than two Measurements contain
+// the dimension, Rate returns an empty slice
+func (j *JDB) Rate(name, dimension string, opts *Options) (p []Point, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err := j.queryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	p = make([]Point, 0)
+
+	var (
+		prev     float64
+		prevWhen time.Time
+		seen     bool
+	)
+
+	for _, measurement := range m {
+		v, ok := measurement.dimension(dimension)
+		if !ok {
+			continue
+		}
+
+		elapsed := measurement.When.Sub(prevWhen).Seconds()
+		if seen && elapsed > 0 {
+			delta := v - prev
+			if delta < 0 {
+				// Counter reset
+				delta = v
+			}
+
+			p = append(p, Point{When: measurement.When, Value: delta / elapsed})
+		}
+
+		prev, prevWhen, seen = v, measurement.When, true
+	}
+
+	return
+}
+
+// MovingAverage returns the trailing moving average of a dimension, as the mean of
+// each Measurement's value and the values of the window-1 Measurements before it,
+// which is useful for smoothing noisy data.
+//
+// Each Point is timestamped with the latest Measurement in its window, and so one
+// Point is returned for each Measurement containing the dimension. The first window-1
+// Points are averaged over partial windows, containing only the values seen so far,
+// which means the very first Point is always the first value as-is. Where window is
+// larger than the number of values, every Point is averaged over a partial window.
+//
+// Measurements which don't contain the dimension are ignored. MovingAverage returns
+// ErrInvalidWindow where window is less than one
+func (j *JDB) MovingAverage(name, dimension string, window int, opts *Options) (p []Point, err error) {
+	if window < 1 {
+		return nil, ErrInvalidWindow
+	}
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err := j.queryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	p = make([]Point, 0, len(m))
+	values := make([]float64, 0, len(m))
+
+	var sum float64
+	for _, measurement := range m {
+		v, ok := measurement.dimension(dimension)
+		if !ok {
+			continue
+		}
+
+		values = append(values, v)
+		sum += v
+
+		if len(values) > window {
+			sum -= values[len(values)-window-1]
+		}
+
+		p = append(p, Point{When: measurement.When, Value: sum / float64(min(len(values), window))})
+	}
+
+	return
+}
+
+// CumulativeSum returns the running total of a dimension, such that each Point is the
+// sum of every value up to, and including, its own, which is useful for burndown style
+// charts.
+//
+// One Point is returned for every matching Measurement, in time order, each timestamped
+// with its Measurement. Measurements which don't contain the dimension carry the total
+// so far forward unchanged, which is zero where no values have been seen yet, rather
+// than being skipped, so that totals line up with every Measurement
+func (j *JDB) CumulativeSum(name, dimension string, opts *Options) (p []Point, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err := j.queryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	p = make([]Point, len(m))
+
+	var sum float64
+	for i, measurement := range m {
+		if v, ok := measurement.dimension(dimension); ok {
+			sum += v
+		}
+
+		p[i] = Point{When: measurement.When, Value: sum}
+	}
+
+	return
+}
+
+// Quantile returns the q-quantile of a dimension across every matching Measurement,
+// where q is between 0 and 1, such as 0.99 for the 99th percentile.
+//
+// Where q falls between two values, the result is linearly interpolated between
+// them, as per most spreadsheet software.
+//
+// Quantile returns ErrInvalidQuantile for values of q outside of 0 to 1, and ErrNoData
+// where no Measurements within opts contain the dimension
+func (j *JDB) Quantile(name, dimension string, q float64, opts *Options) (v float64, err error) {
+	if q < 0 || q > 1 || math.IsNaN(q) {
+		return 0, ErrInvalidQuantile
+	}
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err := j.queryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	values := make([]float64, 0, len(m))
+	for _, measurement := range m {
+		if d, ok := measurement.dimension(dimension); ok {
+			values = append(values, d)
+		}
+	}
+
+	if len(values) == 0 {
+		return 0, ErrNoData
+	}
+
+	slices.Sort(values)
+
+	pos := q * float64(len(values)-1)
+	lower := int(math.Floor(pos))
+	if lower == len(values)-1 {
+		return values[lower], nil
+	}
+
+	return values[lower] + (values[lower+1]-values[lower])*(pos-float64(lower)), nil
+}
+
+// Histogram counts the values of a dimension across every matching Measurement into
+// buckets bounded by edges, which is useful for seeing how values are distributed,
+// rather than how they change over time, as per `Downsample`.
+//
+// Buckets include their lower edge, but not their upper edge, and so for edges of
+// `[10, 20, 30]` the returned counts are, in order, for values:
+//
+//	below 10 (underflow)
+//	from 10, up to but excluding 20
+//	from 20, up to but excluding 30
+//	30 and above (overflow)
+//
+// which is to say that one more count than there are edges is always returned.
+//
+// Measurements which don't contain the dimension are ignored, as are NaN values.
+// Histogram returns ErrInvalidEdges where edges aren't strictly increasing
+func (j *JDB) Histogram(name, dimension string, edges []float64, opts *Options) (counts []uint64, err error) {
+	for i, e := range edges {
+		if math.IsNaN(e) || (i > 0 && e <= edges[i-1]) {
+			return nil, ErrInvalidEdges
+		}
+	}
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err := j.queryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	counts = make([]uint64, len(edges)+1)
+	for _, measurement := range m {
+		v, ok := measurement.dimension(dimension)
+		if !ok || math.IsNaN(v) {
+			continue
+		}
+
+		// The first edge above v is the upper edge of v's bucket, and
+		// so its index is the index of the bucket itself
+		counts[sort.Search(len(edges), func(i int) bool { return edges[i] > v })]++
+	}
+
+	return
+}
+
+// Variance returns the sample variance of a dimension across every matching
+// Measurement, as per the AggregateFunc `Variance`, which is useful for spotting
+// anomalies.
+//
+// Variance returns ErrNoData where no Measurements within opts contain the dimension,
+// and ErrTooFewValues where only one does
+func (j *JDB) Variance(name, dimension string, opts *Options) (v float64, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err := j.queryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	values := make([]float64, 0, len(m))
+	for _, measurement := range m {
+		if d, ok := measurement.dimension(dimension); ok {
+			values = append(values, d)
+		}
+	}
+
+	switch len(values) {
+	case 0:
+		return 0, ErrNoData
+
+	case 1:
+		return 0, ErrTooFewValues
+	}
+
+	return variance(values), nil
+}
+
+// StdDev returns the sample standard deviation of a dimension across every matching
+// Measurement, and returns errors in the same cases as `JDB.Variance`
+func (j *JDB) StdDev(name, dimension string, opts *Options) (v float64, err error) {
+	v, err = j.Variance(name, dimension, opts)
+	if err != nil {
+		return
+	}
+
+	return math.Sqrt(v), nil
+}
+
+// TimeWeightedAverage returns the average of a dimension across every matching
+// Measurement, weighting each value by how long it was held for, which is to say
+// the time until the next Measurement containing the dimension. This avoids the
+// over-weighting of clustered values a plain mean suffers from with irregularly
+// spaced data, such as from sensors which only report on change.
+//
+// The last value is held until opts.To, where set, and so contributes nothing where
+// opts.To isn't set. Time before the first value, such as between opts.From and the
+// first Measurement, is ignored. Where Measurements share a timestamp, such as those
+// created by Upsert, the latter value is used.
+//
+// TimeWeightedAverage returns ErrNoData where no Measurements within opts contain the
+// dimension, and ErrTooFewValues where the values span no time at all, such as where
+// only one Measurement contains the dimension and opts.To isn't set
+func (j *JDB) TimeWeightedAverage(name, dimension string, opts *Options) (v float64, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err := j.queryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	p := points(m, dimension)
+	if len(p) == 0 {
+		return 0, ErrNoData
+	}
+
+	end := holdEnd(p, opts)
+
+	var sum, total float64
+	for i, point := range p {
+		until := end
+		if i < len(p)-1 {
+			until = p[i+1].When
+		}
+
+		w := until.Sub(point.When).Seconds()
+		sum += point.Value * w
+		total += w
+	}
+
+	if total == 0 {
+		return 0, ErrTooFewValues
+	}
+
+	return sum / total, nil
+}
+
+// Downsample aggregates a dimension into fixed size time buckets, such as hourly
+// averages, which is useful for charting large ranges without returning every
+// Measurement.
+//
+// Buckets are aligned to multiples of bucket (as per time.Time.Truncate), and run
+// from the bucket containing the earliest matching Measurement to the bucket containing
+// the latest. Buckets in between which contain no values are returned with Empty set,
+// so that gaps in data remain visible.
+//
+// Measurements which don't contain the dimension are ignored, and where none do
+// Downsample returns an empty slice.
+func (j *JDB) Downsample(name, dimension string, bucket time.Duration, fn AggregateFunc, opts *Options) (b []Bucket, err error) {
+	if bucket <= 0 {
+		return nil, ErrInvalidBucket
+	}
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err := j.queryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	return downsample(m, dimension, bucket, fn), nil
+}
+
+// GroupByIndex works identically to `Downsample`, but returns a separate series for
+// each distinct value of index, keyed by index value, such as when charting one
+// line per location.
+//
+// Index values with no data for the dimension within opts are omitted.
+func (j *JDB) GroupByIndex(name, index, dimension string, bucket time.Duration, fn AggregateFunc, opts *Options) (b map[string][]Bucket, err error) {
+	if bucket <= 0 {
+		return nil, ErrInvalidBucket
+	}
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.indices[name]
+	if !ok {
+		return nil, ErrNoSuchMeasurement
+	}
+
+	idx, ok := measurement[index]
+	if !ok {
+		return nil, ErrNoSuchIndex
+	}
+
+	b = make(map[string][]Bucket)
+	for _, value := range slices.Sorted(maps.Keys(idx)) {
+		var m []*Measurement
+
+		m, err = j.queryAllIndex(name, index, value, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if series := downsample(m, dimension, bucket, fn); len(series) > 0 {
+			b[value] = series
+		}
+	}
+
+	return
+}
+
+// DownsampleTimeWeighted works similarly to `Downsample`, but aggregates each bucket
+// with a time weighted average, as per `TimeWeightedAverage`, where each value is held
+// until the next, including across bucket boundaries.
+//
+// Because values are held, buckets which contain no Measurements of their own take
+// the value held over from the previous bucket, and so, unlike Downsample, aren't
+// Empty, despite a Count of zero. Buckets are only Empty where no time within them
+// is covered by a held value, such as a final bucket whose only value is its last,
+// where opts.To isn't set.
+//
+// Measurements which don't contain the dimension are ignored, and where none do
+// DownsampleTimeWeighted returns an empty slice
+func (j *JDB) DownsampleTimeWeighted(name, dimension string, bucket time.Duration, opts *Options) (b []Bucket, err error) {
+	if bucket <= 0 {
+		return nil, ErrInvalidBucket
+	}
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err := j.queryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	p := points(m, dimension)
+	if len(p) == 0 {
+		return make([]Bucket, 0), nil
+	}
+
+	first := p[0].When.Truncate(bucket)
+	position := func(t time.Time) int {
+		return int(t.Truncate(bucket).Sub(first) / bucket)
+	}
+
+	n := position(p[len(p)-1].When) + 1
+
+	b = make([]Bucket, n)
+	for i := range b {
+		b[i] = Bucket{Start: first.Add(bucket * time.Duration(i)), Empty: true}
+	}
+
+	sums := make([]float64, n)
+	weights := make([]float64, n)
+	end := holdEnd(p, opts)
+
+	for i, point := range p {
+		b[position(point.When)].Count++
+
+		until := end
+		if i < len(p)-1 {
+			until = p[i+1].When
+		}
+
+		// Spread the time this value is held for across every
+		// bucket it overlaps
+		for k := position(point.When); k < n && b[k].Start.Before(until); k++ {
+			from := point.When
+			if b[k].Start.After(from) {
+				from = b[k].Start
+			}
+
+			to := until
+			if bucketEnd := b[k].Start.Add(bucket); bucketEnd.Before(to) {
+				to = bucketEnd
+			}
+
+			w := to.Sub(from).Seconds()
+			sums[k] += point.Value * w
+			weights[k] += w
+		}
+	}
+
+	for k := range b {
+		if weights[k] > 0 {
+			b[k].Value = sums[k] / weights[k]
+			b[k].Empty = false
+		}
+	}
+
+	return
+}
+
+// points returns the value of a dimension for each Measurement in m which has it.
+// Where Measurements share a timestamp, such as those created by Upsert, only the
+// latter is kept. m must be sorted by When, as returned by the query functions
+func points(m []*Measurement, dimension string) (p []Point) {
+	p = make([]Point, 0, len(m))
+
+	for _, measurement := range m {
+		v, ok := measurement.dimension(dimension)
+		if !ok {
+			continue
+		}
+
+		if len(p) > 0 && p[len(p)-1].When.Equal(measurement.When) {
+			p[len(p)-1].Value = v
+
+			continue
+		}
+
+		p = append(p, Point{When: measurement.When, Value: v})
+	}
+
+	return
+}
+
+// holdEnd returns the time the last of p is held until when time weighting,
+// which is opts.To, where set and later than the last Point, or the last Point
+// itself otherwise
+func holdEnd(p []Point, opts *Options) time.Time {
+	end := p[len(p)-1].When
+	if opts != nil && opts.To.After(end) {
+		end = opts.To
+	}
+
+	return end
+}
+
+// downsample aggregates the values of a dimension within m into buckets. m must
+// be sorted by When, as returned by the query functions
+func downsample(m []*Measurement, dimension string, bucket time.Duration, fn AggregateFunc) (b []Bucket) {
+	b = make([]Bucket, 0)
+
+	var values []float64
+
+	// closeBucket aggregates any values gathered for the current
+	// bucket, and resets them
+	closeBucket := func() {
+		if len(values) > 0 {
+			b[len(b)-1].Count = len(values)
+
+			if v := fn(values); !math.IsNaN(v) {
+				b[len(b)-1].Value = v
+				b[len(b)-1].Empty = false
+			}
+		}
+
+		values = values[:0]
+	}
+
+	for _, measurement := range m {
+		v, ok := measurement.dimension(dimension)
+		if !ok {
+			continue
+		}
+
+		start := measurement.When.Truncate(bucket)
+		if len(b) == 0 || !b[len(b)-1].Start.Equal(start) {
+			closeBucket()
+
+			// Pad any gap since the previous bucket with empty buckets
+			if len(b) > 0 {
+				for next := b[len(b)-1].Start.Add(bucket); next.Before(start); next = next.Add(bucket) {
+					b = append(b, Bucket{Start: next, Empty: true})
+				}
+			}
+
+			b = append(b, Bucket{Start: start, Empty: true})
+		}
+
+		values = append(values, v)
+	}
+
+	closeBucket()
+
+	return
+}
@@ -0,0 +1,760 @@
+package jdb_test
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_QueryWithStats(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(0 - time.Hour*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		dimension   string
+		opts        *jdb.Options
+		expectCount int
+		expect      jdb.DimStats
+		expectErr   bool
+	}{
+		{"Unknown measurement fails", "zimzams", "wobble_count", nil, 0, jdb.DimStats{}, true},
+		{"Unknown dimension returns empty stats", "wibbles", "jiggle_tally", nil, 10, jdb.DimStats{}, false},
+		{"All data returns correct stats", "wibbles", "wobble_count", nil, 10, jdb.DimStats{Min: 0, Max: 9, Mean: 4.5, Sum: 45, Count: 10}, false},
+		{"Time sliced data returns stats for the slice", "wibbles", "wobble_count", &jdb.Options{From: now.Add(0 - time.Hour*2)}, 3, jdb.DimStats{Min: 0, Max: 2, Mean: 1, Sum: 3, Count: 3}, false},
+		{"Paged data returns stats for the page", "wibbles", "wobble_count", &jdb.Options{Limit: 2}, 2, jdb.DimStats{Min: 8, Max: 9, Mean: 8.5, Sum: 17, Count: 2}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, stats, err := db.QueryWithStats(test.measurement, test.dimension, test.opts)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+
+			if test.expect != stats {
+				t.Errorf("expected %#v, received %#v", test.expect, stats)
+			}
+		})
+	}
+}
+
+func TestAggregateFuncs(t *testing.T) {
+	values := []float64{4, 1, 3, 2}
+
+	for _, test := range []struct {
+		name   string
+		fn     jdb.AggregateFunc
+		expect float64
+	}{
+		{"Sum", jdb.Sum, 10},
+		{"Mean", jdb.Mean, 2.5},
+		{"Min", jdb.Min, 1},
+		{"Max", jdb.Max, 4},
+		{"Count", jdb.Count, 4},
+		{"First", jdb.First, 4},
+		{"Last", jdb.Last, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rcvd := test.fn(values)
+			if test.expect != rcvd {
+				t.Errorf("expected: %v, received %v", test.expect, rcvd)
+			}
+		})
+	}
+}
+
+func TestAggregateFuncs_spread(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		fn     jdb.AggregateFunc
+		values []float64
+		expect float64
+	}{
+		{"Variance", jdb.Variance, []float64{4, 1, 3, 2}, 5.0 / 3},
+		{"Variance of large values keeps its precision", jdb.Variance, []float64{1e9 + 4, 1e9 + 7, 1e9 + 13, 1e9 + 16}, 30},
+		{"Variance of a single value is NaN", jdb.Variance, []float64{4}, math.NaN()},
+		{"StdDev", jdb.StdDev, []float64{2, 4, 4, 4, 5, 5, 7, 9}, math.Sqrt(32.0 / 7)},
+		{"StdDev of a single value is NaN", jdb.StdDev, []float64{4}, math.NaN()},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rcvd := test.fn(test.values)
+			if math.IsNaN(test.expect) != math.IsNaN(rcvd) || math.Abs(test.expect-rcvd) > 1e-9 {
+				t.Errorf("expected: %v, received %v", test.expect, rcvd)
+			}
+		})
+	}
+}
+
+func TestJDB_Downsample(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two hours of data every ten minutes, with the third hour missing
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for _, offset := range []int{0, 1, 2, 3, 4, 5, 18, 19, 20, 21, 22, 23} {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: start.Add(time.Minute * time.Duration(offset*10)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(offset),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		dimension   string
+		bucket      time.Duration
+		fn          jdb.AggregateFunc
+		opts        *jdb.Options
+		expect      []jdb.Bucket
+		expectErr   bool
+	}{
+		{"Unknown measurement fails", "zimzams", "wobble_count", time.Hour, jdb.Sum, nil, nil, true},
+		{"Invalid bucket fails", "wibbles", "wobble_count", 0, jdb.Sum, nil, nil, true},
+		{"Unknown dimension returns nothing", "wibbles", "jiggle_tally", time.Hour, jdb.Sum, nil, []jdb.Bucket{}, false},
+		{"Gaps are returned as empty buckets", "wibbles", "wobble_count", time.Hour, jdb.Sum, nil, []jdb.Bucket{
+			{Start: start, Value: 15, Count: 6},
+			{Start: start.Add(time.Hour), Empty: true},
+			{Start: start.Add(time.Hour * 2), Empty: true},
+			{Start: start.Add(time.Hour * 3), Value: 123, Count: 6},
+		}, false},
+		{"Options are respected", "wibbles", "wobble_count", time.Hour * 2, jdb.Max, &jdb.Options{From: start.Add(time.Hour)}, []jdb.Bucket{
+			{Start: start.Add(time.Hour * 2), Value: 23, Count: 6},
+		}, false},
+		{"First takes the earliest value in each bucket", "wibbles", "wobble_count", time.Hour, jdb.First, nil, []jdb.Bucket{
+			{Start: start, Value: 0, Count: 6},
+			{Start: start.Add(time.Hour), Empty: true},
+			{Start: start.Add(time.Hour * 2), Empty: true},
+			{Start: start.Add(time.Hour * 3), Value: 18, Count: 6},
+		}, false},
+		{"Last takes the latest value in each bucket", "wibbles", "wobble_count", time.Hour, jdb.Last, nil, []jdb.Bucket{
+			{Start: start, Value: 5, Count: 6},
+			{Start: start.Add(time.Hour), Empty: true},
+			{Start: start.Add(time.Hour * 2), Empty: true},
+			{Start: start.Add(time.Hour * 3), Value: 23, Count: 6},
+		}, false},
+		{"Buckets which can't be aggregated are empty", "wibbles", "wobble_count", time.Minute * 30, jdb.Variance, &jdb.Options{To: start.Add(time.Minute * 30)}, []jdb.Bucket{
+			{Start: start, Value: 1, Count: 3},
+			{Start: start.Add(time.Minute * 30), Count: 1, Empty: true},
+		}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := db.Downsample(test.measurement, test.dimension, test.bucket, test.fn, test.opts)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if !slices.EqualFunc(test.expect, b, bucketsEqual) {
+				t.Errorf("expected: %v, received %#v", test.expect, b)
+			}
+		})
+	}
+}
+
+func TestJDB_GroupByIndex(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 12; i++ {
+		for j, location := range []string{"kitchen", "bedroom"} {
+			err = db.Insert(&jdb.Measurement{
+				Name: "environment",
+				When: start.Add(time.Minute * time.Duration(i*10)),
+				Dimensions: map[string]float64{
+					"temperature": float64(i + j),
+				},
+				Indices: map[string]string{
+					"location": location,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// An index value with no temperature
+	err = db.Insert(&jdb.Measurement{
+		Name: "environment",
+		When: start,
+		Dimensions: map[string]float64{
+			"humidity": 48,
+		},
+		Indices: map[string]string{
+			"location": "attic",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		index       string
+		bucket      time.Duration
+		expect      map[string][]jdb.Bucket
+		expectErr   bool
+	}{
+		{"Unknown measurement fails", "zimzams", "location", time.Hour, nil, true},
+		{"Unknown index fails", "environment", "wazzles", time.Hour, nil, true},
+		{"Invalid bucket fails", "environment", "location", 0, nil, true},
+		{"Each index value is downsampled separately", "environment", "location", time.Hour, map[string][]jdb.Bucket{
+			"kitchen": {
+				{Start: start, Value: 2.5, Count: 6},
+				{Start: start.Add(time.Hour), Value: 8.5, Count: 6},
+			},
+			"bedroom": {
+				{Start: start, Value: 3.5, Count: 6},
+				{Start: start.Add(time.Hour), Value: 9.5, Count: 6},
+			},
+		}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := db.GroupByIndex(test.measurement, test.index, "temperature", test.bucket, jdb.Mean, nil)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if !maps.EqualFunc(test.expect, b, func(a, b []jdb.Bucket) bool {
+				return slices.EqualFunc(a, b, bucketsEqual)
+			}) {
+				t.Errorf("expected: %v, received %#v", test.expect, b)
+			}
+		})
+	}
+}
+
+func bucketsEqual(a, b jdb.Bucket) bool {
+	return a.Start.Equal(b.Start) && a.Value == b.Value && a.Count == b.Count && a.Empty == b.Empty
+}
+
+func TestJDB_Rate(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i, v := range []float64{0, 60, 180, 30, 90} {
+		err = db.Insert(&jdb.Measurement{
+			Name: "requests",
+			When: start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"total": v,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		dimension   string
+		opts        *jdb.Options
+		expect      []jdb.Point
+		expectErr   bool
+	}{
+		{"Unknown measurement fails", "zimzams", "total", nil, nil, true},
+		{"Unknown dimension returns nothing", "requests", "jiggle_tally", nil, []jdb.Point{}, false},
+		{"Single point returns nothing", "requests", "total", &jdb.Options{From: start, To: start}, []jdb.Point{}, false},
+		{"Counter resets start from zero", "requests", "total", nil, []jdb.Point{
+			{When: start.Add(time.Minute), Value: 1},
+			{When: start.Add(time.Minute * 2), Value: 2},
+			{When: start.Add(time.Minute * 3), Value: 0.5},
+			{When: start.Add(time.Minute * 4), Value: 1},
+		}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := db.Rate(test.measurement, test.dimension, test.opts)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if !slices.EqualFunc(test.expect, p, func(a, b jdb.Point) bool {
+				return a.When.Equal(b.When) && a.Value == b.Value
+			}) {
+				t.Errorf("expected: %v, received %#v", test.expect, p)
+			}
+		})
+	}
+}
+
+func TestJDB_MovingAverage(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i, v := range []float64{10, 20, 30, 40, 50} {
+		err = db.Insert(&jdb.Measurement{
+			Name: "sensors",
+			When: start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"temperature": v,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points := func(values ...float64) (p []jdb.Point) {
+		p = make([]jdb.Point, len(values))
+		for i, v := range values {
+			p[i] = jdb.Point{When: start.Add(time.Minute * time.Duration(i)), Value: v}
+		}
+
+		return
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		dimension   string
+		window      int
+		expect      []jdb.Point
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", "temperature", 3, nil, jdb.ErrNoSuchMeasurement},
+		{"Zero window fails", "sensors", "temperature", 0, nil, jdb.ErrInvalidWindow},
+		{"Unknown dimension returns nothing", "sensors", "humidity", 3, []jdb.Point{}, nil},
+		{"Window of one returns values as-is", "sensors", "temperature", 1, points(10, 20, 30, 40, 50), nil},
+		{"Early windows are partial", "sensors", "temperature", 3, points(10, 15, 20, 30, 40), nil},
+		{"Oversized windows are always partial", "sensors", "temperature", 10, points(10, 15, 20, 25, 30), nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := db.MovingAverage(test.measurement, test.dimension, test.window, nil)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if !slices.EqualFunc(test.expect, p, func(a, b jdb.Point) bool {
+				return a.When.Equal(b.When) && a.Value == b.Value
+			}) {
+				t.Errorf("expected: %v, received %#v", test.expect, p)
+			}
+		})
+	}
+}
+
+func TestJDB_Histogram(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i, v := range []float64{5, 10, 15, 19.9, 20, 25, 30, 100} {
+		err = db.Insert(&jdb.Measurement{
+			Name: "requests",
+			When: start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"latency": v,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		dimension   string
+		edges       []float64
+		opts        *jdb.Options
+		expect      []uint64
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", "latency", []float64{10}, nil, nil, jdb.ErrNoSuchMeasurement},
+		{"Unsorted edges fail", "requests", "latency", []float64{20, 10}, nil, nil, jdb.ErrInvalidEdges},
+		{"Repeated edges fail", "requests", "latency", []float64{10, 10}, nil, nil, jdb.ErrInvalidEdges},
+		{"NaN edges fail", "requests", "latency", []float64{math.NaN()}, nil, nil, jdb.ErrInvalidEdges},
+		{"No edges count everything together", "requests", "latency", nil, nil, []uint64{8}, nil},
+		{"Unknown dimension counts nothing", "requests", "jiggle_tally", []float64{10}, nil, []uint64{0, 0}, nil},
+		{"Lower edges are inclusive", "requests", "latency", []float64{10, 20, 30}, nil, []uint64{1, 3, 2, 2}, nil},
+		{"Options are honoured", "requests", "latency", []float64{10, 20, 30}, &jdb.Options{From: start, To: start.Add(time.Minute * 2)}, []uint64{1, 2, 0, 0}, nil},
+		{"Limit and Offset are ignored", "requests", "latency", []float64{10, 20, 30}, &jdb.Options{Limit: 2, Offset: 1}, []uint64{1, 3, 2, 2}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			counts, err := db.Histogram(test.measurement, test.dimension, test.edges, test.opts)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if !slices.Equal(test.expect, counts) {
+				t.Errorf("expected: %v, received %#v", test.expect, counts)
+			}
+		})
+	}
+}
+
+func TestJDB_CumulativeSum(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	// Insert out of order, to ensure totals are accumulated by time, rather
+	// than by insertion
+	for _, i := range []int{3, 0, 4, 1, 2} {
+		m := &jdb.Measurement{
+			Name: "tickets",
+			When: start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"closed": float64(i + 1),
+			},
+		}
+
+		// One Measurement lacks the dimension, and should carry the
+		// total forward
+		if i == 2 {
+			m.Dimensions = map[string]float64{"opened": 1}
+		}
+
+		err = db.Insert(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points := func(values ...float64) (p []jdb.Point) {
+		p = make([]jdb.Point, len(values))
+		for i, v := range values {
+			p[i] = jdb.Point{When: start.Add(time.Minute * time.Duration(i)), Value: v}
+		}
+
+		return
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		dimension   string
+		expect      []jdb.Point
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", "closed", nil, jdb.ErrNoSuchMeasurement},
+		{"Unknown dimension totals zero", "tickets", "reopened", points(0, 0, 0, 0, 0), nil},
+		{"Missing values carry totals forward", "tickets", "closed", points(1, 3, 3, 7, 12), nil},
+		{"Leading missing values are zero", "tickets", "opened", points(0, 0, 1, 1, 1), nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := db.CumulativeSum(test.measurement, test.dimension, nil)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if !slices.EqualFunc(test.expect, p, func(a, b jdb.Point) bool {
+				return a.When.Equal(b.When) && a.Value == b.Value
+			}) {
+				t.Errorf("expected: %v, received %#v", test.expect, p)
+			}
+		})
+	}
+}
+
+func TestJDB_Quantile(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i, v := range []float64{50, 10, 40, 20, 30} {
+		err = db.Insert(&jdb.Measurement{
+			Name: "requests",
+			When: start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"latency": v,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		dimension   string
+		q           float64
+		opts        *jdb.Options
+		expect      float64
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", "latency", 0.5, nil, 0, jdb.ErrNoSuchMeasurement},
+		{"Negative quantiles fail", "requests", "latency", -0.1, nil, 0, jdb.ErrInvalidQuantile},
+		{"Quantiles over one fail", "requests", "latency", 1.1, nil, 0, jdb.ErrInvalidQuantile},
+		{"Unknown dimension has no data", "requests", "jiggle_tally", 0.5, nil, 0, jdb.ErrNoData},
+		{"Empty range has no data", "requests", "latency", 0.5, &jdb.Options{To: start.Add(0 - time.Hour)}, 0, jdb.ErrNoData},
+		{"Zero returns the minimum", "requests", "latency", 0, nil, 10, nil},
+		{"One returns the maximum", "requests", "latency", 1, nil, 50, nil},
+		{"Median returns the middle value", "requests", "latency", 0.5, nil, 30, nil},
+		{"Values are interpolated", "requests", "latency", 0.9, nil, 46, nil},
+		{"Options are respected", "requests", "latency", 0.5, &jdb.Options{From: start.Add(time.Minute * 3)}, 25, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := db.Quantile(test.measurement, test.dimension, test.q, test.opts)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if math.Abs(test.expect-v) > 1e-9 {
+				t.Errorf("expected: %v, received %v", test.expect, v)
+			}
+		})
+	}
+}
+
+func TestJDB_TimeWeightedAverage(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Irregularly spaced values, clustered early on, as per a sensor which
+	// only reports on change
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for offset, v := range map[time.Duration]float64{
+		0:                 10,
+		time.Minute * 10:  20,
+		time.Minute * 15:  30,
+		time.Hour:         0,
+		time.Minute * 210: 40,
+	} {
+		err = db.Insert(&jdb.Measurement{
+			Name: "environment",
+			When: start.Add(offset),
+			Dimensions: map[string]float64{
+				"temperature": v,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		dimension   string
+		opts        *jdb.Options
+		expect      float64
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", "temperature", nil, 0, jdb.ErrNoSuchMeasurement},
+		{"Unknown dimension fails", "environment", "humidity", nil, 0, jdb.ErrNoData},
+		{"A single value without an end fails", "environment", "temperature", &jdb.Options{From: start.Add(time.Hour * 3)}, 0, jdb.ErrTooFewValues},
+		{"Values are weighted by how long they're held", "environment", "temperature", nil, 1550.0 / 210, nil},
+		{"The last value is held until To", "environment", "temperature", &jdb.Options{To: start.Add(time.Hour * 4)}, 2750.0 / 240, nil},
+		{"A single value with an end is returned as-is", "environment", "temperature", &jdb.Options{From: start.Add(time.Hour), To: start.Add(time.Hour * 2)}, 0, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := db.TimeWeightedAverage(test.measurement, test.dimension, test.opts)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if test.expect != v {
+				t.Errorf("expected: %v, received %v", test.expect, v)
+			}
+		})
+	}
+
+	t.Run("DownsampleTimeWeighted", func(t *testing.T) {
+		for _, test := range []struct {
+			name   string
+			opts   *jdb.Options
+			expect []jdb.Bucket
+		}{
+			{"Values are held across buckets", nil, []jdb.Bucket{
+				{Start: start, Value: 1550.0 / 60, Count: 3},
+				{Start: start.Add(time.Hour), Value: 0, Count: 1},
+				{Start: start.Add(time.Hour * 2), Value: 0, Count: 0},
+				{Start: start.Add(time.Hour * 3), Value: 0, Count: 1},
+			}},
+			{"The last value is held until To", &jdb.Options{From: start.Add(time.Hour * 2), To: start.Add(time.Hour * 4)}, []jdb.Bucket{
+				{Start: start.Add(time.Hour * 3), Value: 40, Count: 1},
+			}},
+			{"Buckets with no held time are empty", &jdb.Options{From: start.Add(time.Hour * 3)}, []jdb.Bucket{
+				{Start: start.Add(time.Hour * 3), Count: 1, Empty: true},
+			}},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				b, err := db.DownsampleTimeWeighted("environment", "temperature", time.Hour, test.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !slices.EqualFunc(test.expect, b, bucketsEqual) {
+					t.Errorf("expected: %v, received %#v", test.expect, b)
+				}
+			})
+		}
+
+		_, err := db.DownsampleTimeWeighted("environment", "temperature", 0, nil)
+		if !errors.Is(err, jdb.ErrInvalidBucket) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrInvalidBucket, err)
+		}
+	})
+}
+
+func TestJDB_Variance(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		err = db.Insert(&jdb.Measurement{
+			Name: "requests",
+			When: start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"latency": v,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name           string
+		measurement    string
+		dimension      string
+		opts           *jdb.Options
+		expectVariance float64
+		expectErr      error
+	}{
+		{"Unknown measurement fails", "zimzams", "latency", nil, 0, jdb.ErrNoSuchMeasurement},
+		{"Unknown dimension has no data", "requests", "jiggle_tally", nil, 0, jdb.ErrNoData},
+		{"A single value is too few", "requests", "latency", &jdb.Options{To: start}, 0, jdb.ErrTooFewValues},
+		{"Every value is used", "requests", "latency", nil, 32.0 / 7, nil},
+		{"Options are respected", "requests", "latency", &jdb.Options{From: start.Add(time.Minute * 4)}, 11.0 / 3, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := db.Variance(test.measurement, test.dimension, test.opts)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if math.Abs(test.expectVariance-v) > 1e-9 {
+				t.Errorf("expected: %v, received %v", test.expectVariance, v)
+			}
+
+			sd, err := db.StdDev(test.measurement, test.dimension, test.opts)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if math.Abs(math.Sqrt(test.expectVariance)-sd) > 1e-9 {
+				t.Errorf("expected: %v, received %v", math.Sqrt(test.expectVariance), sd)
+			}
+		})
+	}
+}
+
+func TestFill(t *testing.T) {
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time { return start.Add(time.Hour * time.Duration(i)) }
+
+	input := []jdb.Bucket{
+		{Start: at(0), Empty: true},
+		{Start: at(1), Value: 10, Count: 1},
+		{Start: at(2), Empty: true},
+		{Start: at(3), Empty: true},
+		{Start: at(4), Value: 40, Count: 1},
+		{Start: at(5), Empty: true},
+	}
+
+	for _, test := range []struct {
+		name   string
+		policy jdb.FillPolicy
+		expect []jdb.Bucket
+	}{
+		{"FillNone leaves gaps", jdb.FillNone, input},
+		{"FillPrevious carries values forward", jdb.FillPrevious, []jdb.Bucket{
+			{Start: at(0), Empty: true},
+			{Start: at(1), Value: 10, Count: 1},
+			{Start: at(2), Value: 10, Empty: true, Filled: true},
+			{Start: at(3), Value: 10, Empty: true, Filled: true},
+			{Start: at(4), Value: 40, Count: 1},
+			{Start: at(5), Value: 40, Empty: true, Filled: true},
+		}},
+		{"FillLinear interpolates", jdb.FillLinear, []jdb.Bucket{
+			{Start: at(0), Empty: true},
+			{Start: at(1), Value: 10, Count: 1},
+			{Start: at(2), Value: 20, Empty: true, Filled: true},
+			{Start: at(3), Value: 30, Empty: true, Filled: true},
+			{Start: at(4), Value: 40, Count: 1},
+			{Start: at(5), Empty: true},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rcvd := jdb.Fill(input, test.policy)
+			if !slices.EqualFunc(test.expect, rcvd, func(a, b jdb.Bucket) bool {
+				return bucketsEqual(a, b) && a.Filled == b.Filled
+			}) {
+				t.Errorf("expected: %v, received %#v", test.expect, rcvd)
+			}
+		})
+	}
+
+	t.Run("Input is not modified", func(t *testing.T) {
+		if input[2].Filled || input[2].Value != 0 {
+			t.Errorf("expected input to be unmodified, received %#v", input[2])
+		}
+	})
+}
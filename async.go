@@ -0,0 +1,115 @@
+package jdb
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrInvalidFlushInterval returns when WithAsyncFlush is passed an interval
+// of zero, or less
+var ErrInvalidFlushInterval = errors.New("flush interval must be greater than zero")
+
+// asyncFlusher flushes the save buffer from a background goroutine, as
+// configured by WithAsyncFlush
+type asyncFlusher struct {
+	interval time.Duration
+	onError  func(error)
+
+	signal chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// WithAsyncFlush configures a JDB to flush its save buffer from a background
+// goroutine, rather than as part of whichever Insert happens to fill it, so that
+// inserts never pay the cost of writing to disk themselves.
+//
+// The background goroutine flushes every interval, as well as whenever the save
+// buffer reaches FlushMaxSize. FlushMaxDuration is ignored in favour of interval.
+//
+// Because flushing happens away from the caller, errors are passed to onError. Where
+// onError is nil, errors are logged via Logger instead.
+//
+// Close stops the background goroutine, before flushing anything that remains
+func WithAsyncFlush(interval time.Duration, onError func(error)) OpenOption {
+	return func(j *JDB) error {
+		if interval <= 0 {
+			return ErrInvalidFlushInterval
+		}
+
+		j.async = &asyncFlusher{
+			interval: interval,
+			onError:  onError,
+			signal:   make(chan struct{}, 1),
+			done:     make(chan struct{}),
+		}
+
+		return nil
+	}
+}
+
+// startAsyncFlush starts the background flusher, where configured
+func (j *JDB) startAsyncFlush() {
+	// Read-only databases have nothing to flush
+	if j.async == nil || j.readOnly {
+		return
+	}
+
+	j.async.wg.Add(1)
+
+	go func() {
+		defer j.async.wg.Done()
+
+		ticker := time.NewTicker(j.async.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-j.async.done:
+				return
+
+			case <-ticker.C:
+			case <-j.async.signal:
+			}
+
+			err := j.Flush()
+			if err == nil {
+				continue
+			}
+
+			if j.async.onError != nil {
+				j.async.onError(err)
+
+				continue
+			}
+
+			Logger.Error("Background flush failed", "error", err)
+		}
+	}()
+}
+
+// signalAsyncFlush asks the background flusher to flush as soon as it can,
+// without blocking
+func (j *JDB) signalAsyncFlush() {
+	select {
+	case j.async.signal <- struct{}{}:
+	default:
+		// A flush is already pending
+	}
+}
+
+// stopAsyncFlush stops the background flusher, where configured, and waits
+// for it to exit. It is safe to call more than once
+func (j *JDB) stopAsyncFlush() {
+	if j.async == nil {
+		return
+	}
+
+	j.async.once.Do(func() {
+		close(j.async.done)
+	})
+
+	j.async.wg.Wait()
+}
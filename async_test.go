@@ -0,0 +1,181 @@
+package jdb_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+// failingStore is a Store whose writes always fail
+type failingStore struct {
+	jdb.MemoryStore
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (*failingStore) Write([]byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+func (*failingStore) Rewrite(func(io.Writer) error) error {
+	return errWriteFailed
+}
+
+func TestWithAsyncFlush(t *testing.T) {
+	insert := func(t *testing.T, db *jdb.JDB, count int) {
+		t.Helper()
+
+		now := time.Now()
+		for i := 0; i < count; i++ {
+			err := db.Insert(&jdb.Measurement{
+				Name: "wibbles",
+				When: now.Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"wobble_count": float64(i * 17),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("Invalid intervals fail", func(t *testing.T) {
+		_, err := jdb.NewInMemory(jdb.WithAsyncFlush(0, nil))
+		if !errors.Is(err, jdb.ErrInvalidFlushInterval) {
+			t.Errorf("expected jdb.ErrInvalidFlushInterval, received %#v", err)
+		}
+	})
+
+	t.Run("Buffers are flushed in the background", func(t *testing.T) {
+		store := new(jdb.MemoryStore)
+
+		db, err := jdb.NewWithStore(store, jdb.WithAsyncFlush(time.Millisecond, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		insert(t, db, 10)
+
+		deadline := time.Now().Add(time.Second)
+		for bytes.Count(store.Bytes(), []byte{'\n'}) < 10 {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for background flush")
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("Close drains the buffer", func(t *testing.T) {
+		store := new(jdb.MemoryStore)
+
+		db, err := jdb.NewWithStore(store, jdb.WithAsyncFlush(time.Hour, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		insert(t, db, 10)
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if lines := bytes.Count(store.Bytes(), []byte{'\n'}); lines != 10 {
+			t.Errorf("expected 10 lines, received %d", lines)
+		}
+
+		// Closing twice shouldn't block or panic
+		db.Close()
+	})
+
+	t.Run("Errors are passed to the callback", func(t *testing.T) {
+		var (
+			errs  []error
+			mutex sync.Mutex
+		)
+
+		db, err := jdb.NewWithStore(new(failingStore), jdb.WithAsyncFlush(time.Millisecond, func(err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			errs = append(errs, err)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Closing stops the background flusher; the final flush fails just
+		// as the background ones do, and so its error is ignored
+		t.Cleanup(func() {
+			_ = db.Close()
+		})
+
+		insert(t, db, 1)
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			mutex.Lock()
+			received := len(errs)
+			mutex.Unlock()
+
+			if received > 0 {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for flush error")
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if !errors.Is(errs[0], errWriteFailed) {
+			t.Errorf("expected errWriteFailed, received %#v", errs[0])
+		}
+	})
+	t.Run("Closing waits for the background flusher to stop", func(t *testing.T) {
+		var flushes atomic.Int64
+
+		db, err := jdb.NewWithStore(new(failingStore), jdb.WithAsyncFlush(time.Millisecond, func(error) {
+			flushes.Add(1)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		insert(t, db, 1)
+
+		deadline := time.Now().Add(time.Second)
+		for flushes.Load() == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for background flush")
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+
+		if err = db.Close(); !errors.Is(err, errWriteFailed) {
+			t.Errorf("expected errWriteFailed, received %#v", err)
+		}
+
+		closed := flushes.Load()
+		time.Sleep(time.Millisecond * 20)
+
+		if n := flushes.Load(); n != closed {
+			t.Errorf("expected no flushes after closing, received %d", n-closed)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package jdb
+
+import (
+	"maps"
+	"slices"
+)
+
+// Clone returns an independent, in-memory, copy of this JDB, as per `NewInMemory`,
+// such as for what-if analysis, where Measurements need inserting or deleting without
+// touching the original database or its file.
+//
+// The clone has the same Measurements, fields, and configuration (such as Granularity
+// and DedupeStrategy) as this JDB, but writes to either have no effect on the other.
+// Because Measurements are never modified once inserted, they're shared rather than
+// copied, and so cloning costs a pointer per Measurement per shard.
+//
+// Clones don't inherit `WithAsyncFlush`, subscribers, encryption, or Codecs, none of
+// which apply to in-memory databases
+func (j *JDB) Clone() (c *JDB, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	c = j.copy()
+	c.saveBuffer = make([]*Measurement, 0, FlushMaxSize)
+	c.lastSave = j.lastSave
+	c.lastNow = j.lastNow
+	c.storeFloat32 = j.storeFloat32
+	c.dimensionKeys = maps.Clone(j.dimensionKeys)
+	c.maxPointsPerIndex = j.maxPointsPerIndex
+
+	return
+}
+
+// copy returns a JDB with copies of this JDB's shards, indices, ids, and fields,
+// which can be safely modified without affecting this JDB, and vice versa.
+//
+// Callers must hold saveMutex
+func (j *JDB) copy() *JDB {
+	c := &JDB{
+		ids:               maps.Clone(j.ids),
+		measurements:      make(map[string]map[string][]*Measurement, len(j.measurements)),
+		indices:           make(map[string]map[string]map[string]map[string][]*Measurement, len(j.indices)),
+		measurementFields: make(map[string]map[string]measurementFieldType, len(j.measurementFields)),
+		fieldMeta:         make(map[string]map[string]FieldMeta, len(j.fieldMeta)),
+		granularity:       j.granularity,
+		dedupe:            j.dedupe,
+		fileMode:          j.fileMode,
+	}
+
+	// Shards are sorted, and deleted from, in place, and so copying the maps
+	// alone isn't enough; the shards themselves need copying too
+	for name, shards := range j.measurements {
+		c.measurements[name] = cloneShards(shards)
+	}
+
+	for name, idx := range j.indices {
+		c.indices[name] = make(map[string]map[string]map[string][]*Measurement, len(idx))
+
+		for k, values := range idx {
+			c.indices[name][k] = make(map[string]map[string][]*Measurement, len(values))
+
+			for v, shards := range values {
+				c.indices[name][k][v] = cloneShards(shards)
+			}
+		}
+	}
+
+	for name, fields := range j.measurementFields {
+		c.measurementFields[name] = maps.Clone(fields)
+	}
+
+	for name, meta := range j.fieldMeta {
+		c.fieldMeta[name] = maps.Clone(meta)
+	}
+
+	return c
+}
+
+// cloneShards copies a set of shards, such that changes to the original
+// shards aren't reflected in the copy
+func cloneShards(shards map[string][]*Measurement) map[string][]*Measurement {
+	c := make(map[string][]*Measurement, len(shards))
+	for dts, shard := range shards {
+		c[dts] = slices.Clone(shard)
+	}
+
+	return c
+}
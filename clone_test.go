@@ -0,0 +1,129 @@
+package jdb_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_Clone(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "clone.db")
+
+	db, err := jdb.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	start := time.Now().Add(0 - time.Hour).Truncate(time.Hour)
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i*2+1)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+			Indices:    map[string]string{"sensor": "a"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := db.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	// Write to the clone, into the same shards, out of order, such
+	// that shards are re-sorted, and delete a few things too
+	for i := 0; i < 5; i++ {
+		err = c.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i*2)),
+			Dimensions: map[string]float64{"wobble_count": float64(100 + i)},
+			Indices:    map[string]string{"sensor": "a"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = c.DeleteByTimeRange("wibbles", start, start.Add(time.Minute*4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write to the original, too, which shouldn't show up in the clone
+	err = db.Insert(&jdb.Measurement{
+		Name:       "wibbles",
+		When:       start.Add(time.Minute * 30),
+		Dimensions: map[string]float64{"wobble_count": 1000},
+		Indices:    map[string]string{"sensor": "a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		db     *jdb.JDB
+		expect int
+	}{
+		{"original has its own writes only", db, 11},
+		{"clone has its own writes only", c, 10},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, f := range []func() ([]*jdb.Measurement, error){
+				func() ([]*jdb.Measurement, error) { return test.db.QueryAll("wibbles", nil) },
+				func() ([]*jdb.Measurement, error) { return test.db.QueryAllIndex("wibbles", "sensor", "a", nil) },
+			} {
+				m, err := f()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(m) != test.expect {
+					t.Errorf("expected %d measurements, received %d", test.expect, len(m))
+				}
+
+				for i := 1; i < len(m); i++ {
+					if m[i].When.Before(m[i-1].When) {
+						t.Errorf("expected measurements in order, received %v before %v", m[i-1].When, m[i].When)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("clone is not persisted", func(t *testing.T) {
+		err = c.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reloaded, err := jdb.OpenReadOnly(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer reloaded.Close()
+
+		m, err := reloaded.QueryAll("wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 11 {
+			t.Errorf("expected %d measurements, received %d", 11, len(m))
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package jdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// ErrUnknownCodec returns when opening a database file written with a Codec
+	// which hasn't been registered with RegisterCodec
+	ErrUnknownCodec = errors.New("database file uses an unknown codec")
+
+	// ErrCodecMismatch returns when New is passed WithCodec for an existing database
+	// file which was written with a different Codec (or none at all).
+	//
+	// A database file can only use a single Codec, which is set when the file is created
+	ErrCodecMismatch = errors.New("database file was written with a different codec")
+
+	// ErrCodecExists returns when registering a Codec with an ID that is already in use
+	ErrCodecExists = errors.New("a codec with this id is already registered")
+
+	// ErrInvalidCodecID returns when registering a Codec with an ID which can't
+	// be written to a database header, such as a newline
+	ErrInvalidCodecID = errors.New("codec ids must not be 0x00, '\\r', or '\\n'")
+)
+
+var (
+	// GzipCodec compresses database lines using gzip
+	GzipCodec Codec = gzipCodec{}
+
+	// SnappyCodec compresses database lines using snappy, which trades some
+	// compression ratio for speed
+	SnappyCodec Codec = snappyCodec{}
+
+	// ZstdCodec compresses database lines using zstd, which generally compresses
+	// better than gzip, and faster
+	ZstdCodec Codec = zstdCodec{}
+)
+
+var (
+	codecs      = map[byte]Codec{}
+	codecsMutex sync.RWMutex
+)
+
+func init() {
+	for _, c := range []Codec{GzipCodec, SnappyCodec, ZstdCodec} {
+		if err := RegisterCodec(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Codec compresses and decompresses the lines written to a database file.
+//
+// Each Measurement is compressed individually, which keeps the database file
+// append-only, at the cost of some compression ratio.
+//
+// jdb ships with GzipCodec, SnappyCodec, and ZstdCodec; other algorithms can be used
+// by implementing this interface and calling RegisterCodec
+type Codec interface {
+	// ID uniquely identifies a Codec, and is written to the header of a
+	// database file so that New knows which Codec to load it with
+	ID() byte
+
+	// Compress compresses a single line
+	Compress([]byte) []byte
+
+	// Decompress reverses Compress
+	Decompress([]byte) ([]byte, error)
+}
+
+// RegisterCodec makes a Codec available to New, both for use via WithCodec
+// and for loading database files written with that Codec.
+//
+// RegisterCodec is safe to call concurrently, but is generally best called from
+// an init function.
+func RegisterCodec(c Codec) error {
+	id := c.ID()
+	if id == 0 || id == '\r' || id == '\n' {
+		return ErrInvalidCodecID
+	}
+
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+
+	if _, ok := codecs[id]; ok {
+		return ErrCodecExists
+	}
+
+	codecs[id] = c
+
+	return nil
+}
+
+// WithCodec configures a JDB to compress its database file with the specified
+// Codec.
+//
+// This only affects newly created database files; existing database files continue
+// to use whichever Codec they were created with, and New returns ErrCodecMismatch
+// where that Codec differs from c
+func WithCodec(c Codec) OpenOption {
+	return func(j *JDB) error {
+		j.codec = c
+
+		return nil
+	}
+}
+
+func lookupCodec(id byte) (c Codec, err error) {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	c, ok := codecs[id]
+	if !ok {
+		err = ErrUnknownCodec
+	}
+
+	return
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) ID() byte { return 'g' }
+
+func (gzipCodec) Compress(b []byte) []byte {
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+
+	// Writes to a bytes.Buffer can't fail, and so neither can these
+	_, _ = w.Write(b)
+	_ = w.Close()
+
+	return buf.Bytes()
+}
+
+func (gzipCodec) Decompress(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+type snappyCodec struct{}
+
+func (snappyCodec) ID() byte { return 's' }
+
+func (snappyCodec) Compress(b []byte) []byte {
+	return snappy.Encode(nil, b)
+}
+
+func (snappyCodec) Decompress(b []byte) ([]byte, error) {
+	return snappy.Decode(nil, b)
+}
+
+// zstdEncoder and zstdDecoder are shared by every JDB using ZstdCodec; EncodeAll
+// and DecodeAll are safe for concurrent use, and creating either is expensive
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+type zstdCodec struct{}
+
+func (zstdCodec) ID() byte { return 'Z' }
+
+func (zstdCodec) Compress(b []byte) []byte {
+	return zstdEncoder.EncodeAll(b, nil)
+}
+
+func (zstdCodec) Decompress(b []byte) ([]byte, error) {
+	return zstdDecoder.DecodeAll(b, nil)
+}
@@ -0,0 +1,148 @@
+package jdb_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+// reverseCodec is a nonsense Codec which reverses lines, to prove
+// custom Codecs are used
+type reverseCodec struct{}
+
+func (reverseCodec) ID() byte { return 'r' }
+
+func (reverseCodec) Compress(b []byte) []byte {
+	out := bytes.Clone(b)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return out
+}
+
+func (c reverseCodec) Decompress(b []byte) ([]byte, error) {
+	return c.Compress(b), nil
+}
+
+func TestRegisterCodec(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		c         jdb.Codec
+		expectErr error
+	}{
+		{"Registering a new codec succeeds", reverseCodec{}, nil},
+		{"Registering a codec twice fails", reverseCodec{}, jdb.ErrCodecExists},
+		{"Registering a builtin codec fails", jdb.GzipCodec, jdb.ErrCodecExists},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := jdb.RegisterCodec(test.c)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestWithCodec(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		codec jdb.Codec
+	}{
+		{"gzip", jdb.GzipCodec},
+		{"snappy", jdb.SnappyCodec},
+		{"zstd", jdb.ZstdCodec},
+		{"custom", reverseCodec{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := os.CreateTemp("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			db, err := jdb.New(f.Name(), jdb.WithCodec(test.codec))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 10; i++ {
+				err = db.Insert(&jdb.Measurement{
+					Name: "wibbles",
+					When: time.Now().Add(time.Minute * time.Duration(i)),
+					Dimensions: map[string]float64{
+						"wobble_count": float64(i * 17),
+					},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = db.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Run("Reopening detects the codec", func(t *testing.T) {
+				db, err := jdb.New(f.Name())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				defer db.Close()
+
+				m, err := db.QueryAll("wibbles", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(m) != 10 {
+					t.Errorf("expected 10 measurements, received %d", len(m))
+				}
+			})
+
+			t.Run("Reopening with a different codec fails", func(t *testing.T) {
+				other := jdb.GzipCodec
+				if test.codec == jdb.GzipCodec {
+					other = jdb.ZstdCodec
+				}
+
+				_, err := jdb.New(f.Name(), jdb.WithCodec(other))
+				if !errors.Is(err, jdb.ErrCodecMismatch) {
+					t.Errorf("expected jdb.ErrCodecMismatch, received %#v", err)
+				}
+			})
+		})
+	}
+
+	t.Run("Adding a codec to an existing database fails", func(t *testing.T) {
+		_, err := jdb.New("testdata/valid.db", jdb.WithCodec(jdb.GzipCodec))
+		if !errors.Is(err, jdb.ErrCodecMismatch) {
+			t.Errorf("expected jdb.ErrCodecMismatch, received %#v", err)
+		}
+	})
+
+	t.Run("Loading a database with an unknown codec fails", func(t *testing.T) {
+		f, err := os.CreateTemp("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = f.WriteString("#?\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.Close()
+
+		_, err = jdb.New(f.Name())
+		if !errors.Is(err, jdb.ErrUnknownCodec) {
+			t.Errorf("expected jdb.ErrUnknownCodec, received %#v", err)
+		}
+	})
+}
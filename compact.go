@@ -0,0 +1,210 @@
+package jdb
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ErrCompactToSelf returns when calling CompactTo with the path of the database's
+// own file, which would replace the file out from underneath the database
+var ErrCompactToSelf = errors.New("cannot compact to the database's own file; use Compact instead")
+
+// Compact rewrites the database file from the current in-memory state,
+// dropping any Measurements which have since been superseded by a call
+// to `Upsert`.
+//
+// Because our database file is append-only, heavy use of `Upsert` leaves
+// the file full of stale points which make the file larger than it needs to be,
+// and which slow down calls to `New`. Compact solves this by rewriting the Store
+// with only the latest value for each Measurement. For databases opened with `New`
+// this is done by writing to a temporary file alongside the database, and then
+// atomically renaming it into place.
+//
+// Compact holds the write lock for its duration, and so all inserts will block
+// until it is finished.
+//
+// Superseded Measurements are dropped from memory too, and so queries no longer need
+// to set `Options.Deduplicate` afterwards. For in-memory databases, this is all Compact
+// does.
+func (j *JDB) Compact() (err error) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		return ErrReadOnly
+	}
+
+	return j.compact()
+}
+
+// compact does the work of `Compact`, and is split out so that other
+// functions can trigger compaction while already holding the lock.
+//
+// Callers must hold saveMutex
+func (j *JDB) compact() (err error) {
+	err = j.flush()
+	if err != nil {
+		return
+	}
+
+	j.pruneSuperseded()
+
+	if j.store == nil {
+		return
+	}
+
+	return j.store.Rewrite(j.writeLive)
+}
+
+// Backup writes a consistent snapshot of the database to w, in the same format
+// as the database file, without needing to close the database.
+//
+// The output of Backup can be loaded by `New` as-is, and is compacted in the same
+// way `Compact` compacts the database file; superseded upserts are omitted.
+//
+// Backup flushes the save buffer first, and holds the write lock while it runs, and
+// so inserts will block until it is finished
+func (j *JDB) Backup(w io.Writer) (err error) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	err = j.flush()
+	if err != nil {
+		return
+	}
+
+	buf := bufio.NewWriter(w)
+
+	err = j.writeLive(buf)
+	if err != nil {
+		return
+	}
+
+	return buf.Flush()
+}
+
+// CompactTo writes a compacted copy of the database to a new file at path, as per
+// `Compact`, but without touching the database itself, which is useful for producing
+// a clean copy to ship elsewhere. Any existing file at path is replaced.
+//
+// Unlike Backup, CompactTo doesn't flush the save buffer first; buffered Measurements
+// are written to the copy, but the database's own file is left exactly as it was.
+//
+// The copy is written with the same Codec, and encryption, as the database, and so must
+// be opened with the same OpenOptions. CompactTo holds the read lock while it runs, and
+// so inserts will block until it is finished. Because the copy is written to a temporary
+// file before being renamed into place, path mustn't be the database's own file; use
+// Compact for that, or CompactTo returns ErrCompactToSelf
+func (j *JDB) CompactTo(path string) (err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	if f, ok := j.store.(interface{ Stat() (os.FileInfo, error) }); ok {
+		src, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		if dst, err := os.Stat(path); err == nil && os.SameFile(src, dst) {
+			return ErrCompactToSelf
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".compact-*")
+	if err != nil {
+		return
+	}
+
+	// As per fileStore.Rewrite, once the rename has occurred this is a no-op
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	err = writeTemp(tmp, j.fileMode, j.writeLive)
+	if err != nil {
+		return
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeLive writes a header, followed by any field metadata, followed by all
+// live Measurements, to w
+func (j *JDB) writeLive(w io.Writer) (err error) {
+	err = j.writeHeader(w)
+	if err != nil {
+		return
+	}
+
+	err = j.writeAllFieldMetadata(w)
+	if err != nil {
+		return
+	}
+
+	return j.liveMeasurements(func(m *Measurement) error {
+		return j.writeMeasurement(w, m)
+	})
+}
+
+// liveMeasurements calls fn for every Measurement which hasn't been superseded
+// by a later Upsert, ordered by Measurement name and then timestamp.
+//
+// A Measurement is live when at least one of its IDs still points to it; which
+// is to say, when a later Upsert hasn't replaced it entirely
+func (j *JDB) liveMeasurements(fn func(*Measurement) error) (err error) {
+	for _, name := range slices.Sorted(maps.Keys(j.measurements)) {
+		// Shard keys are wall clock times, which only sort in time order where
+		// every Measurement shares a location, and so shards are merged instead
+		mergeRuns(slices.Collect(maps.Values(j.measurements[name])), func(run []*Measurement) bool {
+			for _, m := range run {
+				if !j.isLive(m) {
+					continue
+				}
+
+				err = fn(m)
+				if err != nil {
+					return false
+				}
+			}
+
+			return true
+		})
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// pruneSuperseded removes every Measurement which has been superseded by a later
+// Upsert from memory, returning the number of Measurements removed.
+//
+// Callers must hold saveMutex
+func (j *JDB) pruneSuperseded() (n int) {
+	for name := range j.measurements {
+		n += j.deleteWhere(name, func(m *Measurement) bool {
+			return !j.isLive(m)
+		})
+	}
+
+	return
+}
+
+// isLive returns true when at least one of a Measurement's ids
+// still points to it
+func (j *JDB) isLive(m *Measurement) bool {
+	for _, id := range m.ids(j.dedupe) {
+		if j.ids[id] == m {
+			return true
+		}
+	}
+
+	return false
+}
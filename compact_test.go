@@ -0,0 +1,416 @@
+package jdb_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_Compact(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	runs := 1_000
+
+	for i := 0; i < runs; i++ {
+		err = db.Upsert(&jdb.Measurement{
+			Name: "upserts",
+			When: now,
+			Indices: map[string]string{
+				"test_func": "TestJDB_Compact",
+			},
+			Dimensions: map[string]float64{
+				"value": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Insert(&jdb.Measurement{
+			Name: "inserts",
+			When: now.Add(time.Second * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"value": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Superseded upserts are only written if they're flushed
+		// before being replaced
+		err = db.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ensure everything is on disk before we measure the file
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure the database is still writable after compaction
+	err = db.Insert(&jdb.Measurement{
+		Name: "inserts",
+		When: now.Add(time.Second * time.Duration(runs)),
+		Dimensions: map[string]float64{
+			"value": float64(runs),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.Size() >= before.Size() {
+		t.Errorf("expected file to shrink from %d bytes, received %d bytes", before.Size(), after.Size())
+	}
+
+	db, err = jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for _, test := range []struct {
+		name        string
+		expectCount int
+		expectValue float64
+	}{
+		{"upserts", 1, float64(runs - 1)},
+		{"inserts", runs + 1, float64(runs)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryAll(test.name, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Fatalf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+
+			v := m[len(m)-1].Dimensions["value"]
+			if test.expectValue != v {
+				t.Errorf("expected %f, received %f", test.expectValue, v)
+			}
+		})
+	}
+}
+
+func TestJDB_Backup(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backup, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Backup(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup.Close()
+
+	// The database should remain usable after a backup
+	err = db.Insert(&jdb.Measurement{
+		Name: "wibbles",
+		When: now.Add(time.Hour),
+		Dimensions: map[string]float64{
+			"wobble_count": 0,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := jdb.New(backup.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer restored.Close()
+
+	m, err := restored.QueryAll("wibbles", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m) != 10 {
+		t.Errorf("expected 10 measurements, received %d", len(m))
+	}
+}
+
+func TestJDB_CompactTo(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	now := time.Now().Add(0 - time.Hour)
+	write := func(fn func(*jdb.Measurement) error, value float64) {
+		t.Helper()
+
+		for i := 0; i < 10; i++ {
+			err = fn(&jdb.Measurement{
+				Name: "wibbles",
+				When: now.Add(time.Minute * time.Duration(i)),
+				Dimensions: map[string]float64{
+					"wobble_count": value,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	write(db.Insert, 0)
+
+	err = db.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The upserts remain buffered when the copy is made
+	write(db.Upsert, 17)
+
+	before, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Compacting to the database's own file fails", func(t *testing.T) {
+		err := db.CompactTo(f.Name())
+		if !errors.Is(err, jdb.ErrCompactToSelf) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrCompactToSelf, err)
+		}
+	})
+
+	dst := filepath.Join(t.TempDir(), "copy.jdb")
+
+	err = db.CompactTo(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("The database is untouched", func(t *testing.T) {
+		after, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(before, after) {
+			t.Errorf("expected database file to be unchanged")
+		}
+
+		if s := db.Stats(); s.Measurements != 20 || s.SaveBuffer != 10 {
+			t.Errorf("expected 20 measurements and 10 buffered, received %d and %d", s.Measurements, s.SaveBuffer)
+		}
+	})
+
+	t.Run("The copy contains only the latest values", func(t *testing.T) {
+		copied, err := jdb.New(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer copied.Close()
+
+		if s := copied.Stats(); s.Measurements != 10 {
+			t.Errorf("expected 10 measurements, received %d", s.Measurements)
+		}
+
+		m, err := copied.QueryAll("wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 10 {
+			t.Fatalf("expected 10 measurements, received %d", len(m))
+		}
+
+		for _, m := range m {
+			if v := m.Dimensions["wobble_count"]; v != 17 {
+				t.Errorf("expected 17, received %f", v)
+			}
+		}
+	})
+}
+
+func TestJDB_Upsert_superseded(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Add(0 - time.Minute)
+	runs := 100
+
+	for i := 0; i < runs; i++ {
+		err = db.Upsert(&jdb.Measurement{
+			Name: "upserts",
+			When: now,
+			Dimensions: map[string]float64{
+				"value": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Flush every other upsert, so some superseded Measurements
+		// make it to disk and some are dropped from the buffer
+		if i%2 == 0 {
+			err = db.Flush()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if s := db.Stats(); s.Measurements != runs {
+		t.Fatalf("expected %d measurements before compaction, received %d", runs, s.Measurements)
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if s := db.Stats(); s.Measurements != 1 {
+		t.Errorf("expected 1 measurement after reload, received %d", s.Measurements)
+	}
+
+	m, err := db.QueryAll("upserts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m) != 1 {
+		t.Fatalf("expected 1 measurements, received %d", len(m))
+	}
+
+	if v := m[0].Dimensions["value"]; v != float64(runs-1) {
+		t.Errorf("expected %f, received %f", float64(runs-1), v)
+	}
+}
+
+func TestJDB_Compact_inMemory(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Add(0 - time.Minute)
+	for i := 0; i < 10; i++ {
+		err = db.Upsert(&jdb.Measurement{
+			Name: "upserts",
+			When: now,
+			Dimensions: map[string]float64{
+				"value": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := db.Stats(); s.Measurements != 1 {
+		t.Errorf("expected 1 measurement after compaction, received %d", s.Measurements)
+	}
+}
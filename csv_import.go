@@ -0,0 +1,360 @@
+package jdb
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrMissingColumn returns from ImportCSV where a column named in a CSVMapping
+	// doesn't appear in the CSV header
+	ErrMissingColumn = errors.New("column missing from csv header")
+
+	// ErrInvalidCSVValue returns from ImportCSV where a cell can't be parsed as
+	// the type its column is mapped to, such as a dimension which isn't a number
+	ErrInvalidCSVValue = errors.New("invalid csv value")
+)
+
+// CSVMapping describes the columns of a CSV file, for `ImportCSV`.
+//
+// Columns are referred to by their name in the CSV header; columns which aren't
+// mentioned are ignored. The zero value expects the `timestamp` and `measure` columns
+// written by `WriteCSV`, but maps no fields, and so a CSVMapping must name at least
+// one column of dimensions, or States, for rows to be valid
+type CSVMapping struct {
+	// Name sets the name of every imported Measurement. Where Name is empty,
+	// each row's name is read from the Measure column instead
+	Name string
+
+	// Measure is the column holding Measurement names, and defaults to `measure`.
+	// It is ignored where Name is set
+	Measure string
+
+	// Timestamp is the column holding `Measurement.When`, and defaults to `timestamp`
+	Timestamp string
+
+	// TimeFormat is the layout, as per `time.Parse`, of the Timestamp column, and
+	// defaults to `time.RFC3339`, as per `CSVOptions.TimeFormat`
+	TimeFormat string
+
+	// Delimiter separates fields, and defaults to ','
+	Delimiter rune
+
+	// Dimensions, IntDimensions, States, Indices, and Labels list the columns which
+	// hold each type of field. Blank cells are skipped, and so rows may omit fields
+	Dimensions    []string
+	IntDimensions []string
+	States        []string
+	Indices       []string
+	Labels        []string
+
+	// Strict stops the import at the first invalid row, inserting nothing, rather
+	// than skipping the row and carrying on
+	Strict bool
+}
+
+// CSVImportError wraps errors returned by ImportCSV, and includes the (1-indexed)
+// line number which caused the error
+type CSVImportError struct {
+	Line int
+	Err  error
+}
+
+// Error implements the error interface
+func (e *CSVImportError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *CSVImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportCSV reads CSV from r, such as that written by `WriteCSV`, and inserts a
+// Measurement per row, using mapping to decide which columns hold which fields. The
+// first row must be a header.
+//
+// Measurements are inserted with `InsertBatch`, and so ImportCSV is as quick as loading
+// data gets. Rows which can't be parsed, fail validation, or already exist (as per
+// `Insert`) are skipped, and the rest of the file is imported regardless; ImportCSV then
+// returns every skipped row's error, each a *CSVImportError, joined together.
+//
+// Where mapping.Strict is set, ImportCSV instead returns the first such error, as a
+// *CSVImportError, and inserts nothing at all.
+//
+// Errors in the header, such as a mapped column which doesn't exist, or CSV which is
+// malformed, always abort the import
+func (j *JDB) ImportCSV(r io.Reader, mapping CSVMapping) (inserted int, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	if mapping.Delimiter != 0 {
+		cr.Comma = mapping.Delimiter
+	}
+
+	header, err := cr.Read()
+	if err != nil {
+		return
+	}
+
+	cols, err := mapping.columns(header)
+	if err != nil {
+		return
+	}
+
+	var (
+		ms      = make([]*Measurement, 0)
+		lines   = make([]int, 0)
+		rowErrs = make([]error, 0)
+	)
+
+	// skip records an invalid row, returning an error where the import
+	// should stop as a result
+	skip := func(line int, err error) error {
+		err = &CSVImportError{Line: line, Err: err}
+		if mapping.Strict {
+			return err
+		}
+
+		rowErrs = append(rowErrs, err)
+
+		return nil
+	}
+
+	for {
+		var record []string
+
+		record, err = cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		line, _ := cr.FieldPos(0)
+
+		m, rowErr := mapping.measurement(cols, record)
+		if rowErr == nil {
+			rowErr = m.Validate()
+		}
+
+		if rowErr != nil {
+			err = skip(line, rowErr)
+			if err != nil {
+				return
+			}
+
+			continue
+		}
+
+		ms = append(ms, m)
+		lines = append(lines, line)
+	}
+
+	// Rows which already exist are the likeliest failures, such as when a file is
+	// imported twice, and so we find them up front; InsertBatch fails on the first
+	// bad Measurement, and retrying once per duplicate gets slow quickly
+	j.saveMutex.RLock()
+
+	seen := make(map[string]bool)
+	duplicates := make([]bool, len(ms))
+
+	for i, m := range ms {
+		for _, id := range m.ids(j.dedupe) {
+			if _, ok := j.ids[id]; ok || seen[id] {
+				duplicates[i] = true
+			}
+
+			seen[id] = true
+		}
+	}
+
+	j.saveMutex.RUnlock()
+
+	for i := len(ms) - 1; i >= 0; i-- {
+		if !duplicates[i] {
+			continue
+		}
+
+		err = skip(lines[i], ErrDuplicateMeasurement)
+		if err != nil {
+			return
+		}
+
+		ms = slices.Delete(ms, i, i+1)
+		lines = slices.Delete(lines, i, i+1)
+	}
+
+	// Anything else, such as field type conflicts, or Measurements inserted
+	// since we checked, is skipped one at a time
+	for len(ms) > 0 {
+		err = j.InsertBatch(ms)
+
+		var be *BatchError
+		if !errors.As(err, &be) {
+			break
+		}
+
+		err = skip(lines[be.Index], be.Err)
+		if err != nil {
+			return
+		}
+
+		ms = slices.Delete(ms, be.Index, be.Index+1)
+		lines = slices.Delete(lines, be.Index, be.Index+1)
+	}
+
+	if err != nil {
+		return
+	}
+
+	// Errors are gathered in reverse order when removing duplicates, and
+	// so need sorting back into line order
+	slices.SortStableFunc(rowErrs, func(a, b error) int {
+		return a.(*CSVImportError).Line - b.(*CSVImportError).Line
+	})
+
+	return len(ms), errors.Join(rowErrs...)
+}
+
+// csvColumns holds the position, within a CSV header, of each mapped column
+type csvColumns struct {
+	name      int
+	timestamp int
+	fields    []csvColumn
+}
+
+// csvColumn is a single mapped field column
+type csvColumn struct {
+	name string
+	pos  int
+	t    measurementFieldType
+}
+
+// columns finds the position of each mapped column within header
+func (c CSVMapping) columns(header []string) (cols csvColumns, err error) {
+	positions := make(map[string]int, len(header))
+	for i, h := range header {
+		positions[h] = i
+	}
+
+	find := func(column string) (int, error) {
+		pos, ok := positions[column]
+		if !ok {
+			return 0, fmt.Errorf("%w: %q", ErrMissingColumn, column)
+		}
+
+		return pos, nil
+	}
+
+	cols.name = -1
+	if c.Name == "" {
+		cols.name, err = find(cmp.Or(c.Measure, "measure"))
+		if err != nil {
+			return
+		}
+	}
+
+	cols.timestamp, err = find(cmp.Or(c.Timestamp, "timestamp"))
+	if err != nil {
+		return
+	}
+
+	for _, group := range []struct {
+		columns []string
+		t       measurementFieldType
+	}{
+		{c.Dimensions, dimension},
+		{c.IntDimensions, intDimension},
+		{c.States, state},
+		{c.Indices, index},
+		{c.Labels, label},
+	} {
+		for _, column := range group.columns {
+			var pos int
+
+			pos, err = find(column)
+			if err != nil {
+				return
+			}
+
+			cols.fields = append(cols.fields, csvColumn{name: column, pos: pos, t: group.t})
+		}
+	}
+
+	return
+}
+
+// measurement builds a Measurement from a single CSV record
+func (c CSVMapping) measurement(cols csvColumns, record []string) (m *Measurement, err error) {
+	cell := func(pos int) string {
+		if pos < len(record) {
+			return record[pos]
+		}
+
+		return ""
+	}
+
+	m = &Measurement{
+		Name:       c.Name,
+		Dimensions: make(map[string]float64),
+		Labels:     make(map[string]string),
+		Indices:    make(map[string]string),
+	}
+
+	if cols.name >= 0 {
+		m.Name = cell(cols.name)
+	}
+
+	m.When, err = time.Parse(cmp.Or(c.TimeFormat, time.RFC3339), cell(cols.timestamp))
+	if err != nil {
+		return nil, fmt.Errorf("%w: timestamp: %w", ErrInvalidCSVValue, err)
+	}
+
+	for _, col := range cols.fields {
+		v := cell(col.pos)
+		if v == "" {
+			continue
+		}
+
+		switch col.t {
+		case dimension:
+			m.Dimensions[col.name], err = strconv.ParseFloat(v, 64)
+
+		case intDimension:
+			if m.IntDimensions == nil {
+				m.IntDimensions = make(map[string]int64)
+			}
+
+			m.IntDimensions[col.name], err = strconv.ParseInt(v, 10, 64)
+
+		case state:
+			if m.States == nil {
+				m.States = make(map[string]bool)
+			}
+
+			m.States[col.name], err = strconv.ParseBool(v)
+
+		case index:
+			m.Indices[col.name] = v
+
+		case label:
+			m.Labels[col.name] = v
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidCSVValue, col.name, err)
+		}
+	}
+
+	return
+}
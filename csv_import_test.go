@@ -0,0 +1,214 @@
+package jdb_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+const importCSV = `timestamp,measure,temperature,readings,door_open,room,firmware
+2024-11-22T11:00:00Z,environment,19.5,1,false,kitchen,v1
+2024-11-22T11:01:00Z,environment,wibble,2,false,kitchen,v1
+2024-11-22T11:02:00Z,environment,20.5,3,,kitchen,v1
+2024-11-22T11:03:00Z,environment,21,4,maybe,kitchen,v1
+not-a-timestamp,environment,21.5,5,true,kitchen,v1
+2024-11-22T11:05:00Z,environment,22,6,true,kitchen,
+`
+
+var importMapping = jdb.CSVMapping{
+	Dimensions:    []string{"temperature"},
+	IntDimensions: []string{"readings"},
+	States:        []string{"door_open"},
+	Indices:       []string{"room"},
+	Labels:        []string{"firmware"},
+}
+
+func TestJDB_ImportCSV(t *testing.T) {
+	t.Run("Invalid rows are skipped and reported", func(t *testing.T) {
+		db, err := jdb.NewInMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		inserted, err := db.ImportCSV(strings.NewReader(importCSV), importMapping)
+		if !errors.Is(err, jdb.ErrInvalidCSVValue) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrInvalidCSVValue, err)
+		}
+
+		if inserted != 3 {
+			t.Errorf("expected %d measurements, received %d", 3, inserted)
+		}
+
+		for _, line := range []string{"line 3:", "line 5:", "line 6:"} {
+			if !strings.Contains(err.Error(), line) {
+				t.Errorf("expected %q in %q", line, err.Error())
+			}
+		}
+
+		m, err := db.QueryAllIndex("environment", "room", "kitchen", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 3 {
+			t.Fatalf("expected %d measurements, received %d", 3, len(m))
+		}
+
+		if m[0].Dimensions["temperature"] != 19.5 || m[0].IntDimensions["readings"] != 1 || m[0].States["door_open"] || m[0].Labels["firmware"] != "v1" {
+			t.Errorf("unexpected measurement %#v", m[0])
+		}
+
+		if _, ok := m[1].States["door_open"]; ok {
+			t.Errorf("expected blank state to be skipped, received %#v", m[1].States)
+		}
+
+		if _, ok := m[2].Labels["firmware"]; ok {
+			t.Errorf("expected blank label to be skipped, received %#v", m[2].Labels)
+		}
+	})
+
+	t.Run("Strict imports stop at the first invalid row", func(t *testing.T) {
+		db, err := jdb.NewInMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		mapping := importMapping
+		mapping.Strict = true
+
+		inserted, err := db.ImportCSV(strings.NewReader(importCSV), mapping)
+
+		var ie *jdb.CSVImportError
+		if !errors.As(err, &ie) {
+			t.Fatalf("expected *jdb.CSVImportError, received %#v", err)
+		}
+
+		if ie.Line != 3 {
+			t.Errorf("expected: %d, received %d", 3, ie.Line)
+		}
+
+		if inserted != 0 {
+			t.Errorf("expected %d measurements, received %d", 0, inserted)
+		}
+
+		_, err = db.QueryAll("environment", nil)
+		if !errors.Is(err, jdb.ErrNoSuchMeasurement) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrNoSuchMeasurement, err)
+		}
+	})
+
+	t.Run("Importing the same data twice skips duplicates", func(t *testing.T) {
+		db, err := jdb.NewInMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		_, err = db.ImportCSV(strings.NewReader(importCSV), importMapping)
+		if !errors.Is(err, jdb.ErrInvalidCSVValue) {
+			t.Fatalf("expected %#v, received %#v", jdb.ErrInvalidCSVValue, err)
+		}
+
+		inserted, err := db.ImportCSV(strings.NewReader(importCSV), importMapping)
+		if !errors.Is(err, jdb.ErrDuplicateMeasurement) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrDuplicateMeasurement, err)
+		}
+
+		if inserted != 0 {
+			t.Errorf("expected %d measurements, received %d", 0, inserted)
+		}
+	})
+
+	for _, test := range []struct {
+		name    string
+		mapping jdb.CSVMapping
+	}{
+		{"Missing field columns fail", jdb.CSVMapping{Dimensions: []string{"humidity"}}},
+		{"Missing timestamp columns fail", jdb.CSVMapping{Timestamp: "when", Dimensions: []string{"temperature"}}},
+		{"Missing measure columns fail", jdb.CSVMapping{Measure: "name", Dimensions: []string{"temperature"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := jdb.NewInMemory()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer db.Close()
+
+			_, err = db.ImportCSV(strings.NewReader(importCSV), test.mapping)
+			if !errors.Is(err, jdb.ErrMissingColumn) {
+				t.Errorf("expected %#v, received %#v", jdb.ErrMissingColumn, err)
+			}
+		})
+	}
+
+	t.Run("Output from WriteCSV round trips", func(t *testing.T) {
+		src, err := jdb.NewInMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer src.Close()
+
+		start := time.Now().Add(0 - time.Hour).Truncate(time.Second)
+		for i := 0; i < 10; i++ {
+			err = src.Insert(&jdb.Measurement{
+				Name:       "wibbles",
+				When:       start.Add(time.Minute * time.Duration(i)),
+				Dimensions: map[string]float64{"wobble_count": float64(i) / 2},
+				Indices:    map[string]string{"sensor": "a"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		buf := new(bytes.Buffer)
+
+		err = src.WriteCSV(buf, "wibbles", &jdb.Options{CSV: jdb.CSVOptions{Delimiter: '\t'}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dst, err := jdb.NewInMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer dst.Close()
+
+		inserted, err := dst.ImportCSV(buf, jdb.CSVMapping{
+			Name:       "imported",
+			Delimiter:  '\t',
+			Dimensions: []string{"wobble_count"},
+			Indices:    []string{"sensor"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if inserted != 10 {
+			t.Errorf("expected %d measurements, received %d", 10, inserted)
+		}
+
+		m, err := dst.QueryAllIndex("imported", "sensor", "a", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, rcvd := range m {
+			if !rcvd.When.Equal(start.Add(time.Minute*time.Duration(i))) || rcvd.Dimensions["wobble_count"] != float64(i)/2 {
+				t.Errorf("%d: unexpected measurement %#v", i, rcvd)
+			}
+		}
+	})
+}
@@ -1,12 +1,12 @@
 package jdb
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/base64"
+	"compress/gzip"
+	"crypto/cipher"
 	"encoding/csv"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"maps"
@@ -27,9 +27,17 @@ var (
 	FlushMaxSize = 1_000
 
 	// If the save buffer hasn't been flushed for `FlushMaxDuration` or
-	// longer then flush to disk
+	// longer then flush to disk.
+	//
+	// Both this and `FlushMaxSize` can be overridden for specific Measurement
+	// names with `JDB.SetFlushPolicy`
 	FlushMaxDuration = time.Hour
 
+	// If a call to `QueryAll`, `QueryAllIndex`, or one of the CSV functions takes
+	// longer than `SlowQueryThreshold` then it is logged, via Logger, as a warning.
+	// Setting this to zero disables slow query logging
+	SlowQueryThreshold time.Duration
+
 	// ErrNoSuchMeasurement returns when trying to retrieve a Measurement
 	// that hasn't been indexed by this JDB instance
 	ErrNoSuchMeasurement = errors.New("unknown measurement name")
@@ -58,12 +66,29 @@ var (
 // It will, however, give you a reasonably quick way of storing timeseries, querying
 // against an index or time range, and provide de-duplication gaurantees.
 type JDB struct {
-	f *os.File
+	// store is where this database is persisted to, and is nil for
+	// in-memory databases
+	store Store
 
 	saveBuffer []*Measurement
-	saveMutex  sync.Mutex
 	lastSave   time.Time
 
+	// flushPolicies overrides FlushMaxSize and FlushMaxDuration per Measurement
+	// name, as set by SetFlushPolicy, while buffered counts the Measurements of
+	// each of those names within saveBuffer[:bufferedCounted]
+	flushPolicies   map[string]flushPolicy
+	buffered        map[string]int
+	bufferedCounted int
+
+	// saveMutex guards everything in JDB; anything which mutates state,
+	// including flushing the save buffer, takes the write lock, while queries
+	// take the read lock so that they may run concurrently with one another
+	saveMutex sync.RWMutex
+
+	// lastNow is the most recent timestamp assigned by InsertNow, which
+	// we use to ensure assigned timestamps are always distinct
+	lastNow time.Time
+
 	// ids is a mapping of derived IDs for a given measurement/ index pair
 	// and is used to ensure a degree of deduplication.
 	//
@@ -81,7 +106,10 @@ type JDB struct {
 	// We key the []Measurement slice against a date+hour string because writes
 	// can come at any time, but we want to store them ordered by timestamp. Thus,
 	// we want to store these `Measurement`s in reasonably small blocks so that
-	// we don't need to sort the world just to slot a single Measurement in
+	// we don't need to sort the world just to slot a single Measurement in.
+	//
+	// The size of these blocks is configurable with WithGranularity; date + hour
+	// is the default
 	measurements map[string]map[string][]*Measurement
 
 	// indices are stored as per:
@@ -98,8 +126,64 @@ type JDB struct {
 	// because that allows us to, essentially, keep an additive set of fields without
 	// needing to append and deduplicate slices which we'd need to for `map[string]measurementFields`
 	measurementFields map[string]map[string]measurementFieldType
+
+	// fieldMeta holds the metadata set via SetFieldMetadata, stored as per:
+	//    fieldMeta[measurement_name][field] = FieldMeta
+	fieldMeta map[string]map[string]FieldMeta
+
+	// codec compresses each line written to disk, when set
+	codec Codec
+
+	// aead encrypts each line written to disk, when set
+	aead cipher.AEAD
+
+	// plainJSON writes each line to disk as raw json, rather than base64, when
+	// set by WithPlainJSON, or when loading a file written that way
+	plainJSON bool
+
+	// granularity sets the period of time each shard covers
+	granularity Granularity
+
+	// dedupe sets which parts of a Measurement its ids are derived from
+	dedupe DedupeStrategy
+
+	// async flushes the save buffer in the background, when set
+	async *asyncFlusher
+
+	// storeFloat32 stores Dimensions as float32s, when set
+	storeFloat32 bool
+
+	// dimensionKeys interns the sorted dimension names of Measurements stored
+	// as float32s, keyed by those names joined together, so that Measurements
+	// with the same dimensions share a single slice of names
+	dimensionKeys map[string][]string
+
+	// maxPointsPerIndex bounds the number of Measurements kept for each
+	// index value, when set
+	maxPointsPerIndex int
+
+	// subscriptions are the channels returned by Subscribe, which receive
+	// newly inserted Measurements
+	subscriptions map[chan *Measurement]bool
+
+	// closed is set by Close, after which Subscribe returns closed channels
+	closed bool
+
+	// readOnly is set by OpenReadOnly, and causes writes to return ErrReadOnly
+	readOnly bool
+
+	// fileMode is the permissions database files are created with, as set
+	// by WithFileMode
+	fileMode os.FileMode
+
+	// noLock stops New from locking the database file, when set by
+	// WithoutLock
+	noLock bool
 }
 
+// OpenOption configures a JDB as it is opened by New, NewWithStore, or NewInMemory
+type OpenOption func(*JDB) error
+
 // New returns a JDB from a databse file on disk, creating the database file if it
 // doesn't already exist.
 //
@@ -108,63 +192,113 @@ type JDB struct {
 //  1. Where the OS can't open a database file for writing
 //  2. The file it has opened isn't valid for JDB
 //
+// Files which can't be written to can be opened with `OpenReadOnly` instead.
+//
+// A database file must only be written to by a single JDB at a time, and so New locks
+// the file until `Close` is called, returning ErrLocked where it is already locked
+// (see `WithoutLock`). Where the file changes size underneath a JDB regardless, such
+// as where another process has opened it without locking, writes to it return
+// ErrFileModified rather than interleaving with, or compacting over, the other
+// process' data.
+//
+// New accepts a set of OpenOptions, such as `WithCodec`, which configure the returned JDB.
+// Database files are created with the permissions 0640, unless set by `WithFileMode`.
+//
 // This function outputs optional logs, which can be enabled by setting `jdb.Logger` to
 // a valid `slog.Logger`
-func New(file string) (j *JDB, err error) {
+func New(file string, opts ...OpenOption) (j *JDB, err error) {
 	Logger.Info("Creating new JDB instance from disk", "stage", "boot", "file", file)
 
-	j = new(JDB)
-	j.saveBuffer = make([]*Measurement, 0, FlushMaxSize)
-	j.lastSave = time.Now()
+	j, err = newJDB(opts)
+	if err != nil {
+		return
+	}
 
-	j.ids = make(map[string]*Measurement)
-	j.measurements = make(map[string]map[string][]*Measurement)
-	j.indices = make(map[string]map[string]map[string]map[string][]*Measurement)
-	j.measurementFields = make(map[string]map[string]measurementFieldType)
+	store, err := openFileStore(file, j.fileMode, !j.noLock)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files which fail to load are closed, so that they aren't left locked
+	err = j.load(store)
+	if err != nil {
+		_ = store.Close()
+
+		return nil, err
+	}
 
-	// #nosec: G302,G304
-	j.f, err = os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0640)
+	return
+}
+
+// NewWithStore returns a JDB persisted to an arbitrary Store, loading any data
+// the Store already contains.
+//
+// This allows jdb to be backed by something other than a file on disk, such as
+// a MemoryStore, or object storage. `New` is a wrapper around this function which
+// uses a file on disk.
+//
+// NewWithStore accepts the same OpenOptions as `New`, and returns errors where the
+// contents of the Store aren't valid for JDB.
+func NewWithStore(store Store, opts ...OpenOption) (j *JDB, err error) {
+	j, err = newJDB(opts)
 	if err != nil {
 		return
 	}
 
+	err = j.load(store)
+
+	return
+}
+
+// load reads the contents of store into a freshly initialised JDB, as returned by
+// newJDB, and persists to store from then on
+func (j *JDB) load(store Store) (err error) {
+	j.store = store
+
 	// For line in file, decode, add to the correct fields in JDB
 	measurementCount := 0
+	duplicates := 0
 
-	scanner := bufio.NewScanner(j.f)
-	for scanner.Scan() {
-		line := scanner.Bytes()
+	empty, err := j.scan(j.store, func(m *Measurement) error {
+		measurementCount++
 
-		m := new(Measurement)
+		ids := m.ids(j.dedupe)
 
-		// Decode base64 to string
-		dst := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
-		_, err = base64.StdEncoding.Decode(dst, line)
-		if err != nil {
-			return
-		}
+		// Measurements whose ids we've already seen replace whatever we
+		// saw first, which is expected of upserts, but may also point to
+		// overlapping data, such as from concatenating two databases
+		if slices.ContainsFunc(ids, func(id string) bool {
+			_, ok := j.ids[id]
 
-		// Parse string as json
-		err = json.NewDecoder(bytes.NewBuffer(dst)).Decode(m)
-		if err != nil {
-			return
+			return ok
+		}) {
+			duplicates++
 		}
 
-		measurementCount++
-
 		// We're using addMeasurement directly because we trust the data
 		// flushed to disc, and so we don't care about the dedupe stuff we
 		// do when we accept a Measurement on the public, export, [JDB.Insert]
 		// api
+		j.shrink(m)
+
 		fields, _ := m.fields()
-		j.addMeasurement(m, m.ids(), fields)
-	}
+		j.addMeasurement(m, ids, fields)
 
-	err = scanner.Err()
+		return nil
+	})
 	if err != nil {
 		return
 	}
 
+	// An empty file is a brand new database, and so needs a header
+	// for whichever Codec we've been configured with
+	if empty && !j.readOnly {
+		err = j.writeHeader(j.store)
+		if err != nil {
+			return
+		}
+	}
+
 	// Sort the data we've just inserted
 	//
 	// QUERY: Why do we do this here, and not in `addMeasurement`? Especially
@@ -195,27 +329,149 @@ func New(file string) (j *JDB, err error) {
 		}
 	}
 
+	// The file contains every version of every upserted Measurement, but only
+	// the latest is of any use, and so dropping the rest here means queries
+	// needn't deduplicate them
+	superseded := j.pruneSuperseded()
+
+	j.evictAll()
+
+	if duplicates > 0 {
+		Logger.Warn("Measurements with duplicate ids loaded; later Measurements replace earlier ones",
+			"stage", "boot",
+			"duplicates", duplicates,
+			"hint", "this is expected of upserted Measurements, but otherwise may point to overlapping data",
+		)
+	}
+
 	Logger.Info("Measurements Loaded",
 		"stage", "boot",
 		"measurements", measurementCount,
+		"duplicates", duplicates,
+		"superseded", superseded,
 		"groups", len(j.measurements),
 		"indices", indexCount,
 	)
 
+	j.startAsyncFlush()
+
+	return
+}
+
+// NewInMemory returns a JDB with no backing file at all.
+//
+// Such a JDB behaves identically to one returned by `New`, except that nothing is
+// ever persisted; flushing does nothing, and closing the database simply discards it.
+//
+// This is useful for tests, and for ephemeral caches.
+func NewInMemory(opts ...OpenOption) (j *JDB, err error) {
+	Logger.Info("Creating new in-memory JDB instance", "stage", "boot")
+
+	j, err = newJDB(opts)
+	if err != nil {
+		return
+	}
+
+	j.startAsyncFlush()
+
+	return
+}
+
+// newJDB initialises an empty JDB, applying any OpenOptions
+func newJDB(opts []OpenOption) (j *JDB, err error) {
+	j = new(JDB)
+	j.saveBuffer = make([]*Measurement, 0, FlushMaxSize)
+	j.lastSave = time.Now()
+	j.fileMode = defaultFileMode
+
+	j.ids = make(map[string]*Measurement)
+	j.measurements = make(map[string]map[string][]*Measurement)
+	j.indices = make(map[string]map[string]map[string]map[string][]*Measurement)
+	j.measurementFields = make(map[string]map[string]measurementFieldType)
+	j.fieldMeta = make(map[string]map[string]FieldMeta)
+
+	for _, opt := range opts {
+		err = opt(j)
+		if err != nil {
+			return
+		}
+	}
+
+	if j.plainJSON && (j.codec != nil || j.aead != nil) {
+		err = ErrPlainJSONConflict
+	}
+
 	return
 }
 
 // Close a JDB, flushing contents to disk
 func (j *JDB) Close() (err error) {
+	// The background flusher takes the lock itself, so must be stopped
+	// before we take it here
+	j.stopAsyncFlush()
+
 	j.saveMutex.Lock()
 	defer j.saveMutex.Unlock()
 
-	err = j.flush()
-	if err != nil {
+	j.closeSubscriptions()
+
+	if !j.readOnly {
+		err = j.flush()
+	}
+
+	if j.store == nil {
+		return
+	}
+
+	// The store is closed regardless of whether flushing succeeded, so that
+	// its file, and any lock on it, isn't leaked
+	return errors.Join(err, j.store.Close())
+}
+
+// Flush writes any buffered Measurements to disk, without waiting for
+// FlushMaxSize or FlushMaxDuration to be hit.
+//
+// This is useful for guaranteeing durability at specific checkpoints, such as
+// before a risky operation. Where there are no buffered Measurements, Flush does
+// nothing.
+//
+// Flush hands Measurements to the operating system, which may hold them in its
+// page cache for some time before writing them to disk; callers needing data to
+// survive a power cut, rather than just a crash, should call `Sync` afterwards.
+func (j *JDB) Flush() (err error) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		return ErrReadOnly
+	}
+
+	if len(j.saveBuffer) == 0 {
 		return
 	}
 
-	return j.f.Close()
+	return j.flush()
+}
+
+// Sync asks the operating system to commit anything already written to the
+// database file to physical disk.
+//
+// Where Flush moves buffered Measurements from jdb to the file, Sync moves
+// them from the operating system's cache to the disk itself, and so the two
+// are typically called together. Sync doesn't touch buffered Measurements,
+// which are written on the next flush as normal.
+//
+// Sync does nothing for databases without a file, such as those returned by
+// `NewInMemory`, or backed by Stores which don't implement `Sync() error`.
+func (j *JDB) Sync() (err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	if s, ok := j.store.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+
+	return
 }
 
 // Insert a Measurement into the database.
@@ -233,7 +489,27 @@ func (j *JDB) Close() (err error) {
 //
 // The upshot of this is that calls to Insert are immediately consistent.
 func (j *JDB) Insert(m *Measurement) (err error) {
-	return j.insert(m, false)
+	_, err = j.insert(m, false, false)
+
+	return
+}
+
+// InsertNow inserts a Measurement into the database, setting Measurement.When to the
+// current time.
+//
+// This is useful for things like counters, where the precise time of a Measurement
+// doesn't matter, but where each Measurement must be distinct.
+//
+// The timestamp is set while holding the write lock, and is guaranteed to be later than
+// any timestamp previously set by InsertNow on this JDB; where the clock hasn't advanced
+// since the last call, the timestamp is nudged forward by a nanosecond. This means rapid
+// calls to InsertNow wont fail with ErrDuplicateMeasurement.
+//
+// Aside from the above, InsertNow behaves identically to Insert
+func (j *JDB) InsertNow(m *Measurement) (err error) {
+	_, err = j.insert(m, false, true)
+
+	return
 }
 
 // Upsert a Measurement into the database.
@@ -243,15 +519,32 @@ func (j *JDB) Insert(m *Measurement) (err error) {
 //
 // This is useful for updating old records, but it should be used sparingly;
 // our database is persisted as an append-only structure, which means that each call
-// to this function writes an extra entry to the disk.
+// to this function writes an extra entry to the disk, unless the Measurement is itself
+// upserted again before being flushed.
 //
-// Calls to any of the `Query*` functions should set `Deduplicate: true` in Options
-// or be aware that returned data will contain duplicated data.
+// Until the database is compacted, or reopened, calls to any of the `Query*` functions
+// should set `Deduplicate: true` in Options or be aware that returned data will contain
+// duplicated data. Superseded Measurements are dropped when the database is loaded, and
+// by `Compact`.
+//
+// `Swap` works identically, but also returns the Measurement being replaced.
 func (j *JDB) Upsert(m *Measurement) (err error) {
-	return j.insert(m, true)
+	_, err = j.insert(m, true, false)
+
+	return
+}
+
+// Swap upserts a Measurement, as per `Upsert`, returning the Measurement it replaced,
+// or nil where there wasn't one. This allows, for instance, deltas to be computed on
+// update without a separate query, and without racing other writers.
+//
+// Where the Measurement's ids match more than one existing Measurement, such as where
+// each of its indices matches a different Measurement, one of them is returned
+func (j *JDB) Swap(m *Measurement) (previous *Measurement, err error) {
+	return j.insert(m, true, false)
 }
 
-func (j *JDB) insert(m *Measurement, force bool) (err error) {
+func (j *JDB) insert(m *Measurement, force, now bool) (previous *Measurement, err error) {
 	// Validate the measurement before doing anything else
 	if err = m.Validate(); err != nil {
 		return
@@ -261,15 +554,44 @@ func (j *JDB) insert(m *Measurement, force bool) (err error) {
 	j.saveMutex.Lock()
 	defer j.saveMutex.Unlock()
 
+	if j.readOnly {
+		err = ErrReadOnly
+
+		return
+	}
+
+	if now {
+		m.When = j.now()
+	}
+
+	// Shrinking Dimensions modifies m, which belongs to the caller
+	if j.storeFloat32 {
+		m = m.clone()
+		j.shrink(m)
+	}
+
 	// Grab Measurement IDs; if we have one that exists then
 	// error out, unless we're upserting.
-	measurementIDs := m.ids()
-	if !force {
-		for _, id := range measurementIDs {
-			if _, ok := j.ids[id]; ok {
-				return ErrDuplicateMeasurement
-			}
+	measurementIDs := m.ids(j.dedupe)
+
+	// ids are unordered, and so are sorted to ensure the same previous
+	// Measurement is found every time
+	var replaced *Measurement
+	for _, id := range slices.Sorted(slices.Values(measurementIDs)) {
+		existing, ok := j.ids[id]
+		if !ok {
+			continue
+		}
+
+		if !force {
+			err = ErrDuplicateMeasurement
+
+			return
 		}
+
+		replaced = existing
+
+		break
 	}
 
 	measurementFields, err := m.fields()
@@ -277,35 +599,196 @@ func (j *JDB) insert(m *Measurement, force bool) (err error) {
 		return
 	}
 
+	err = checkFieldTypes(m.Name, j.measurementFields[m.Name], measurementFields)
+	if err != nil {
+		return
+	}
+
 	j.addMeasurement(m, measurementIDs, measurementFields)
 
 	j.saveBuffer = append(j.saveBuffer, m)
 
 	// Ensure the new Measurement is placed in the right place(s)
-	slices.SortFunc(j.measurements[m.Name][m.dts()], func(a, b *Measurement) int {
-		return a.When.Compare(b.When)
-	})
+	j.sortShards(j.shardKeys(m))
+	j.evictOldest(m)
+	j.publish(m)
 
-	for k, v := range m.Indices {
-		slices.SortFunc(j.indices[m.Name][k][v][m.dts()], func(a, b *Measurement) int {
-			return a.When.Compare(b.When)
-		})
+	return expand(replaced), j.maybeFlush()
+}
+
+// InsertBatch inserts a slice of Measurements into the database in one go.
+//
+// This works similarly to calling `Insert` for each Measurement, except that:
+//
+//  1. Every Measurement is validated before any are inserted
+//  2. The write lock is taken once for the whole batch
+//  3. Each affected shard is sorted once, after all Measurements are added
+//  4. Flush conditions are checked once, after all Measurements are added
+//
+// Which makes InsertBatch much quicker than Insert when loading large amounts of data.
+//
+// Should any Measurement fail validation, or already exist (either in the database, or
+// earlier in the batch), then nothing is inserted and a *BatchError is returned, which
+// contains the position of the offending Measurement in ms
+func (j *JDB) InsertBatch(ms []*Measurement) (err error) {
+	for i, m := range ms {
+		if err = m.Validate(); err != nil {
+			return &BatchError{Index: i, Err: err}
+		}
 	}
 
-	// If we've either got a full write buffer, or we haven't saved in a while,
-	// then save now.
-	//
-	// Of course this might mean that some inserts are quite slow, but it is what it is
-	if len(j.saveBuffer) >= FlushMaxSize || time.Now().After(j.lastSave.Add(FlushMaxDuration)) {
-		err = j.flush()
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		return ErrReadOnly
+	}
+
+	// As per insert, shrinking Dimensions modifies Measurements, which
+	// belong to the caller
+	if j.storeFloat32 {
+		stored := make([]*Measurement, len(ms))
+		for i, m := range ms {
+			stored[i] = m.clone()
+			j.shrink(stored[i])
+		}
+
+		ms = stored
+	}
+
+	ids := make([][]string, len(ms))
+	fields := make([]map[string]measurementFieldType, len(ms))
+	seen := make(map[string]bool)
+
+	// batchFields tracks the types of fields seen earlier in the batch, so that
+	// Measurements within a batch can't conflict with one another either
+	batchFields := make(map[string]map[string]measurementFieldType)
+
+	for i, m := range ms {
+		ids[i] = m.ids(j.dedupe)
+		for _, id := range ids[i] {
+			if _, ok := j.ids[id]; ok || seen[id] {
+				return &BatchError{Index: i, Err: ErrDuplicateMeasurement}
+			}
+
+			seen[id] = true
+		}
+
+		fields[i], err = m.fields()
 		if err != nil {
-			return
+			return &BatchError{Index: i, Err: err}
+		}
+
+		for _, existing := range []map[string]measurementFieldType{j.measurementFields[m.Name], batchFields[m.Name]} {
+			err = checkFieldTypes(m.Name, existing, fields[i])
+			if err != nil {
+				return &BatchError{Index: i, Err: err}
+			}
+		}
+
+		if _, ok := batchFields[m.Name]; !ok {
+			batchFields[m.Name] = make(map[string]measurementFieldType)
+		}
+
+		maps.Copy(batchFields[m.Name], fields[i])
+	}
+
+	affected := make(map[shardKey]bool)
+	for i, m := range ms {
+		j.addMeasurement(m, ids[i], fields[i])
+
+		for _, k := range j.shardKeys(m) {
+			affected[k] = true
+		}
+	}
+
+	j.saveBuffer = append(j.saveBuffer, ms...)
+	j.sortShards(slices.Collect(maps.Keys(affected)))
+	j.evictOldest(ms...)
+	j.publish(ms...)
+
+	return j.maybeFlush()
+}
+
+// BatchError wraps errors returned by InsertBatch, and includes the position
+// of the Measurement, within the batch, that caused the error
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+// Error implements the error interface
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("measurement %d: %s", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error, allowing the use of errors.Is
+// to check for specific errors, such as ErrDuplicateMeasurement
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// maybeFlush flushes to disk if we've either got a full write buffer,
+// or we haven't saved in a while.
+//
+// Of course this might mean that some inserts are quite slow, but it is what it is;
+// where that isn't acceptable WithAsyncFlush can be used, in which case maybeFlush
+// signals the background flusher when the write buffer is full, and returns immediately
+func (j *JDB) maybeFlush() error {
+	full, stale := j.flushDue()
+
+	if j.async != nil {
+		if full {
+			j.signalAsyncFlush()
 		}
+
+		return nil
+	}
+
+	if full || stale {
+		return j.flush()
+	}
+
+	return nil
+}
+
+// shardKey identifies a single shard, either in j.measurements (where index is empty)
+// or within j.indices
+type shardKey struct {
+	name, index, value, dts string
+}
+
+// shardKeys returns the keys of every shard a Measurement sits in
+func (j *JDB) shardKeys(m *Measurement) (keys []shardKey) {
+	dts := m.dts(j.granularity)
+
+	keys = make([]shardKey, 0, len(m.Indices)+1)
+	keys = append(keys, shardKey{name: m.Name, dts: dts})
+
+	for k, v := range m.Indices {
+		keys = append(keys, shardKey{name: m.Name, index: k, value: v, dts: dts})
 	}
 
 	return
 }
 
+// sortShards sorts each of the specified shards by timestamp.
+//
+// This sort is stable, so that where Measurements share a timestamp (such as
+// via Upsert) they remain in insertion order, which deduplication relies on
+func (j *JDB) sortShards(keys []shardKey) {
+	for _, k := range keys {
+		shard := j.measurements[k.name][k.dts]
+		if k.index != "" {
+			shard = j.indices[k.name][k.index][k.value][k.dts]
+		}
+
+		slices.SortStableFunc(shard, func(a, b *Measurement) int {
+			return a.When.Compare(b.When)
+		})
+	}
+}
+
 // QueryAll queries for a Measurement name, returning all Measurements that fit.
 //
 // When opts is not nil, the specified time slicing options are used to
@@ -315,62 +798,110 @@ func (j *JDB) insert(m *Measurement, force bool) (err error) {
 // setting it to empty, such as `&jdb.Options{}`, or `new(jdb.Options)`- though setting
 // opts as nil saves a chunk of cycles and is, therefore, marginallty more efficient
 func (j *JDB) QueryAll(name string, opts *Options) (m []*Measurement, err error) {
-	measurement, ok := j.measurements[name]
-	if !ok {
-		err = ErrNoSuchMeasurement
+	defer logSlowQuery("QueryAll", name, opts, time.Now(), &m)
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	return j.queryAllFunc(name, opts, true, nil)
+}
+
+// QueryAllPaged works identically to `QueryAll`, but also returns the total number
+// of Measurements which match opts before Limit and Offset are applied, so that
+// callers paging through results can show something like "page 2 of 17" without
+// a second query
+func (j *JDB) QueryAllPaged(name string, opts *Options) (m []*Measurement, total int, err error) {
+	defer logSlowQuery("QueryAllPaged", name, opts, time.Now(), &m)
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
 
+	m, err = j.queryAll(name, opts)
+	if err != nil {
 		return
 	}
 
-	tmpM := make([][]*Measurement, 0)
-	for _, shard := range measurement {
-		switch opts {
-		case nil:
-			tmpM = append(tmpM, shard)
+	total = len(m)
+	if opts != nil {
+		m = opts.paginate(m)
+	}
 
-		default:
-			v := opts.validMeasurements(shard)
-			if len(v) > 0 {
-				tmpM = append(tmpM, v)
-			}
+	return
+}
+
+// queryAll is the implementation of QueryAll, and expects callers to hold
+// saveMutex
+func (j *JDB) queryAll(name string, opts *Options) (m []*Measurement, err error) {
+	return j.queryAllFunc(name, opts, false, nil)
+}
+
+// queryAllFunc works as per queryAll, additionally applying opts.Limit and
+// opts.Offset where paginate is set, and calling fn (where not nil) with each
+// returned Measurement as it is expanded, so that callers can derive values
+// from results without walking them a second time.
+//
+// Callers must hold saveMutex
+func (j *JDB) queryAllFunc(name string, opts *Options, paginate bool, fn func(*Measurement)) (m []*Measurement, err error) {
+	if opts != nil {
+		err = opts.Validate()
+		if err != nil {
+			return
 		}
 	}
 
-	// Here we're sorting the slice of measurement slices because, of course, a map
-	// doesn't persist write order due to how elements are hashed
-	//
-	// At some point this has the potential to become quite inefficient; if a Query
-	// returns a lot of matching shards then this extra sort becomes overhead.
-	//
-	// At this point we're going to want to look at the final map[string][]*Measurement
-	// in the various data structures we keep. This will become some kind of shard
-	// container that can travel through shards in order
-	slices.SortFunc(tmpM, func(a, b []*Measurement) int {
-		return a[0].When.Compare(b[0].When)
-	})
+	measurement, ok := j.measurements[name]
+	if !ok {
+		err = ErrNoSuchMeasurement
 
-	m = make([]*Measurement, 0)
-	for _, t := range tmpM {
-		m = append(m, t...)
+		return
 	}
 
+	// Shards are sorted, but a map doesn't persist write order, and so
+	// matching shards are merged back into order
+	m = mergeShards(scanShards(measurement, opts))
+
 	// Finally, deduplicate measurements for upserted data, if requested
 	if opts != nil && opts.Deduplicate {
 		deduped := make([]*Measurement, 0, len(m))
 
-		// Iterate through the slice and add the last occurrence of each unique When.
+		// Iterate through the slice and add either the first or last occurrence
+		// of each unique When.
 		for i := 0; i < len(m); i++ {
+			first := i
+
 			// Skip over duplicates by comparing the current and next When values.
-			for i+1 < len(m) && m[i].When == m[i+1].When {
+			//
+			// These are compared with Equal, as per ids, since Measurements read
+			// from disk have neither the monotonic clock reading nor, necessarily,
+			// the location of the Measurements which supersede them
+			for i+1 < len(m) && m[i].When.Equal(m[i+1].When) {
 				i++
 			}
 
+			if opts.DeduplicateKeep == KeepEarliest {
+				deduped = append(deduped, m[first])
+
+				continue
+			}
+
 			deduped = append(deduped, m[i])
 		}
 
 		m = slices.Clip(deduped)
 	}
 
+	if paginate && opts != nil {
+		m = opts.paginate(m)
+	}
+
+	for i := range m {
+		m[i] = expand(m[i])
+
+		if fn != nil {
+			fn(m[i])
+		}
+	}
+
 	return
 }
 
@@ -378,7 +909,8 @@ func (j *JDB) QueryAll(name string, opts *Options) (m []*Measurement, err error)
 // the hood), but returns Measurements as a []byte representation of the generated
 // CSV.
 //
-// It can be quite expensive for large datasets.
+// It can be quite expensive for large datasets; `WriteCSV` streams the same output
+// to an io.Writer instead, and is preferable where possible.
 //
 // This function can be used to load data into other sources, such as jupyter, or
 // a spreadsheet.
@@ -390,18 +922,85 @@ func (j *JDB) QueryAll(name string, opts *Options) (m []*Measurement, err error)
 // setting it to empty, such as `&jdb.Options{}`, or `new(jdb.Options)`- though setting
 // opts as nil saves a chunk of cycles and is, therefore, marginallty more efficient
 func (j *JDB) QueryAllCSV(name string, opts *Options) (b []byte, err error) {
-	measurements, err := j.QueryAll(name, opts)
+	buf := new(bytes.Buffer)
+
+	err = j.WriteCSV(buf, name, opts)
 	if err != nil {
 		return
 	}
 
-	buf := new(bytes.Buffer)
-	w := csv.NewWriter(buf)
+	return buf.Bytes(), nil
+}
 
-	fields := j.measurementFields[name]
+// WriteCSV works identically to `QueryAllCSV`, but writes CSV directly to w rather
+// than buffering it all in memory first.
+//
+// This makes it suitable for streaming large exports straight to a file or an HTTP
+// response.
+//
+// The format of the output can be controlled by setting opts.CSV.
+//
+// When opts is not nil, the specified time slicing options are used to
+// return a subset of Measurements.
+//
+// For the purposes of time slicing, setting opts to nil has identical behaviour to
+// setting it to empty, such as `&jdb.Options{}`, or `new(jdb.Options)`- though setting
+// opts as nil saves a chunk of cycles and is, therefore, marginallty more efficient
+func (j *JDB) WriteCSV(w io.Writer, name string, opts *Options) (err error) {
+	// We only need to hold the lock while gathering data; writing to w
+	// may be slow and we don't want to block inserts while we do it
+	start := time.Now()
+
+	j.saveMutex.RLock()
+
+	measurements, err := j.queryAll(name, opts)
+	fields := maps.Clone(j.measurementFields[name])
+	meta := maps.Clone(j.fieldMeta[name])
+
+	defer logSlowQuery("WriteCSV", name, opts, start, &measurements)
+
+	j.saveMutex.RUnlock()
+
+	if err != nil {
+		return
+	}
+
+	var csvOpts CSVOptions
+	if opts != nil {
+		csvOpts = opts.CSV
+		measurements = opts.paginate(measurements)
+	}
+
+	if csvOpts.Gzip {
+		gw := gzip.NewWriter(w)
+
+		// Closing writes the gzip footer, without which the output is
+		// truncated, and so its error matters as much as any other
+		defer func() {
+			closeErr := gw.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}()
+
+		w = gw
+	}
+
+	cw := csv.NewWriter(w)
+	if csvOpts.Delimiter != 0 {
+		cw.Comma = csvOpts.Delimiter
+	}
+
+	if csvOpts.Pivot != "" {
+		return writePivotCSV(cw, measurements, fields, meta, csvOpts)
+	}
 
 	fieldNames := make([]string, 0, len(fields))
-	for f := range fields {
+	for f, t := range fields {
+		if (t == label && csvOpts.OmitLabels) || (t == index && csvOpts.OmitIndices) {
+			continue
+		}
+
 		fieldNames = append(fieldNames, f)
 	}
 
@@ -411,7 +1010,16 @@ func (j *JDB) QueryAllCSV(name string, opts *Options) (b []byte, err error) {
 	// Let's prepend with the important ones
 	fieldNames = append([]string{"timestamp", "measure"}, fieldNames...)
 
-	err = w.Write(fieldNames)
+	header := slices.Clone(fieldNames)
+	if csvOpts.Units {
+		for i, f := range header {
+			if unit := meta[f].Unit; unit != "" {
+				header[i] = f + " (" + unit + ")"
+			}
+		}
+	}
+
+	err = cw.Write(header)
 	if err != nil {
 		return
 	}
@@ -421,7 +1029,7 @@ func (j *JDB) QueryAllCSV(name string, opts *Options) (b []byte, err error) {
 
 		for _, f := range fieldNames {
 			if f == "timestamp" {
-				line = append(line, m.When.Format(time.RFC3339))
+				line = append(line, m.When.Format(csvOpts.timeFormat()))
 
 				continue
 			}
@@ -438,6 +1046,19 @@ func (j *JDB) QueryAllCSV(name string, opts *Options) (b []byte, err error) {
 			case dimension:
 				line = append(line, strconv.FormatFloat(m.Dimensions[f], 'g', -1, 64))
 
+			case intDimension:
+				line = append(line, strconv.FormatInt(m.IntDimensions[f], 10))
+
+			case state:
+				// Unlike dimensions, a missing state has no sensible zero
+				// value, and so is left blank rather than written as false
+				cell := ""
+				if v, ok := m.States[f]; ok {
+					cell = strconv.FormatBool(v)
+				}
+
+				line = append(line, cell)
+
 			case index:
 				line = append(line, m.Indices[f])
 
@@ -446,15 +1067,15 @@ func (j *JDB) QueryAllCSV(name string, opts *Options) (b []byte, err error) {
 			}
 		}
 
-		err = w.Write(line)
+		err = cw.Write(line)
 		if err != nil {
 			return
 		}
 	}
 
-	w.Flush()
+	cw.Flush()
 
-	return buf.Bytes(), err
+	return cw.Error()
 }
 
 // QueryAllIndex queries for a Measurement name, returning all Measurements with a specific Index value.
@@ -466,6 +1087,29 @@ func (j *JDB) QueryAllCSV(name string, opts *Options) (b []byte, err error) {
 // setting it to empty, such as `&jdb.Options{}`, or `new(jdb.Options)`- though setting
 // opts as nil saves a chunk of cycles and is, therefore, marginallty more efficient
 func (j *JDB) QueryAllIndex(name, index, indexValue string, opts *Options) (m []*Measurement, err error) {
+	defer logSlowQuery("QueryAllIndex", name, opts, time.Now(), &m)
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, err = j.queryAllIndex(name, index, indexValue, opts)
+	if err == nil && opts != nil {
+		m = opts.paginate(m)
+	}
+
+	return
+}
+
+// queryAllIndex is the implementation of QueryAllIndex, and expects callers
+// to hold saveMutex
+func (j *JDB) queryAllIndex(name, index, indexValue string, opts *Options) (m []*Measurement, err error) {
+	if opts != nil {
+		err = opts.Validate()
+		if err != nil {
+			return
+		}
+	}
+
 	measurement, ok := j.indices[name]
 	if !ok {
 		err = ErrNoSuchMeasurement
@@ -485,34 +1129,18 @@ func (j *JDB) QueryAllIndex(name, index, indexValue string, opts *Options) (m []
 		return
 	}
 
-	tmpM := make([][]*Measurement, 0)
-	for _, shard := range iv {
-		switch opts {
-		case nil:
-			tmpM = append(tmpM, shard)
-
-		default:
-			v := opts.validMeasurements(shard)
-			if len(v) > 0 {
-				tmpM = append(tmpM, v)
-			}
-		}
-	}
-
-	slices.SortFunc(tmpM, func(a, b []*Measurement) int {
-		return a[0].When.Compare(b[0].When)
-	})
+	m = mergeShards(scanShards(iv, opts))
 
-	m = make([]*Measurement, 0)
-	for _, t := range tmpM {
-		m = append(m, t...)
-	}
+	expandAll(m)
 
 	return
 }
 
 // QueryFields returns the fields set for a Measurement
 func (j *JDB) QueryFields(measurement string) (fields []string, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
 	fm, ok := j.measurementFields[measurement]
 	if !ok {
 		return nil, ErrNoSuchMeasurement
@@ -526,13 +1154,65 @@ func (j *JDB) QueryFields(measurement string) (fields []string, err error) {
 	return
 }
 
+// QueryFieldTypes returns the fields set for a Measurement, along with
+// the type of each field; one of "dimension", "int_dimension", "state", "index", or "label"
+func (j *JDB) QueryFieldTypes(measurement string) (fields map[string]string, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	fm, ok := j.measurementFields[measurement]
+	if !ok {
+		return nil, ErrNoSuchMeasurement
+	}
+
+	fields = make(map[string]string, len(fm))
+	for f, t := range fm {
+		fields[f] = t.String()
+	}
+
+	return
+}
+
+// now returns the current time, stripped of monotonic clock readings, and
+// guaranteed to be later than the previous call to now.
+//
+// Callers must hold saveMutex
+func (j *JDB) now() time.Time {
+	t := time.Now().Round(0)
+	if !t.After(j.lastNow) {
+		t = j.lastNow.Add(time.Nanosecond)
+	}
+
+	j.lastNow = t
+
+	return t
+}
+
+// logSlowQuery logs a query which took longer than SlowQueryThreshold. It
+// takes a pointer to the query's results so that it can be deferred before the
+// query has run
+func logSlowQuery(query, name string, opts *Options, start time.Time, m *[]*Measurement) {
+	elapsed := time.Since(start)
+	if SlowQueryThreshold <= 0 || elapsed < SlowQueryThreshold {
+		return
+	}
+
+	Logger.Warn("Slow query",
+		"query", query,
+		"measurement", name,
+		"options", opts,
+		"results", len(*m),
+		"elapsed", elapsed,
+	)
+}
+
 // addMeasurement adds a Measurement to the underlying fields in JDB
 func (j *JDB) addMeasurement(m *Measurement, ids []string, fields map[string]measurementFieldType) {
 	if _, ok := j.measurements[m.Name]; !ok {
 		j.measurements[m.Name] = make(map[string][]*Measurement)
 	}
 
-	dsStr := m.dts()
+	dsStr := m.dts(j.granularity)
 	if _, ok := j.measurements[m.Name][dsStr]; !ok {
 		j.measurements[m.Name][dsStr] = make([]*Measurement, 0)
 	}
@@ -573,24 +1253,33 @@ func (j *JDB) addMeasurement(m *Measurement, ids []string, fields map[string]mea
 }
 
 func (j *JDB) flush() (err error) {
+	// In-memory databases have nowhere to flush to, and so
+	// just drop the buffer
+	if j.store == nil {
+		j.saveBuffer = j.saveBuffer[:0]
+		j.lastSave = time.Now()
+		j.resetBuffered()
+
+		return
+	}
+
 	Logger.Info("Flushing to disc", "buffer_length", len(j.saveBuffer))
 
-	for _, m := range j.saveBuffer {
-		buf := new(bytes.Buffer)
-		err = json.NewEncoder(buf).Encode(*m)
+	if len(j.saveBuffer) > 0 {
+		err = j.checkStore()
 		if err != nil {
 			return
 		}
+	}
 
-		dst := make([]byte, base64.StdEncoding.EncodedLen(buf.Len()))
-		base64.StdEncoding.Encode(dst, buf.Bytes())
-
-		_, err = j.f.Write(dst)
-		if err != nil {
-			return
+	for _, m := range j.saveBuffer {
+		// Measurements upserted more than once since the last flush need
+		// only their latest version writing
+		if !j.isLive(m) {
+			continue
 		}
 
-		_, err = j.f.Write([]byte{'\n'})
+		err = j.writeMeasurement(j.store, m)
 		if err != nil {
 			return
 		}
@@ -598,6 +1287,7 @@ func (j *JDB) flush() (err error) {
 
 	j.saveBuffer = make([]*Measurement, 0, FlushMaxSize)
 	j.lastSave = time.Now()
+	j.resetBuffered()
 
 	return
 }
@@ -2,10 +2,19 @@ package jdb_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,6 +43,111 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestWithFileMode(t *testing.T) {
+	t.Run("Invalid modes fail", func(t *testing.T) {
+		_, err := jdb.NewInMemory(jdb.WithFileMode(os.ModeDir | 0700))
+		if !errors.Is(err, jdb.ErrInvalidFileMode) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrInvalidFileMode, err)
+		}
+	})
+
+	// These modes are chosen to be unaffected by the usual umask of 022
+	for _, test := range []struct {
+		name   string
+		opts   []jdb.OpenOption
+		expect os.FileMode
+	}{
+		{"Files default to 0640", nil, 0640},
+		{"Files can be private", []jdb.OpenOption{jdb.WithFileMode(0600)}, 0600},
+		{"Files can be world readable", []jdb.OpenOption{jdb.WithFileMode(0644)}, 0644},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			db, err := jdb.New(filepath.Join(dir, "db.jdb"), test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer db.Close()
+
+			err = db.CompactTo(filepath.Join(dir, "copy.jdb"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, f := range []string{"db.jdb", "copy.jdb"} {
+				fi, err := os.Stat(filepath.Join(dir, f))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if test.expect != fi.Mode().Perm() {
+					t.Errorf("%s: expected %s, received %s", f, test.expect, fi.Mode().Perm())
+				}
+			}
+		})
+	}
+}
+
+func TestNewInMemory(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flush on every insert, to ensure flushing without a file is safe
+	flushMaxSize := jdb.FlushMaxSize
+	jdb.FlushMaxSize = 1
+
+	defer func() {
+		jdb.FlushMaxSize = flushMaxSize
+	}()
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+			Indices: map[string]string{
+				"wibbler": "0xabadbabe",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.Insert(&jdb.Measurement{
+		Name:       "wibbles",
+		When:       now,
+		Dimensions: map[string]float64{"wobble_count": 0},
+		Indices:    map[string]string{"wibbler": "0xabadbabe"},
+	})
+	if !errors.Is(err, jdb.ErrDuplicateMeasurement) {
+		t.Errorf("expected jdb.ErrDuplicateMeasurement, received %#v", err)
+	}
+
+	m, err := db.QueryAllIndex("wibbles", "wibbler", "0xabadbabe", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m) != 10 {
+		t.Errorf("expected 10 measurements, received %d", len(m))
+	}
+
+	for _, fn := range []func() error{db.Flush, db.Compact, db.Close} {
+		err = fn()
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
 func TestJDB_Insert(t *testing.T) {
 	f, err := os.CreateTemp("", "")
 	if err != nil {
@@ -152,6 +266,65 @@ func TestJDB_Upsert(t *testing.T) {
 	}
 }
 
+func TestJDB_Swap(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	when := time.Now().Add(0 - time.Minute)
+
+	for _, test := range []struct {
+		name           string
+		value          float64
+		expectPrevious bool
+		expectValue    float64
+	}{
+		{"Fresh inserts return nil", 1, false, 0},
+		{"Upserts return the replaced measurement", 2, true, 1},
+		{"Subsequent upserts return the latest replaced measurement", 3, true, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			previous, err := db.Swap(&jdb.Measurement{
+				Name:       "counters",
+				When:       when,
+				Dimensions: map[string]float64{"counter": test.value},
+				Indices:    map[string]string{"sensor": "a"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectPrevious != (previous != nil) {
+				t.Fatalf("expected previous: %v, received %#v", test.expectPrevious, previous)
+			}
+
+			if previous != nil && previous.Dimensions["counter"] != test.expectValue {
+				t.Errorf("expected: %v, received %v", test.expectValue, previous.Dimensions["counter"])
+			}
+		})
+	}
+
+	t.Run("Failed upserts return nil", func(t *testing.T) {
+		previous, err := db.Swap(&jdb.Measurement{
+			Name:       "counters",
+			When:       when,
+			Dimensions: map[string]float64{"gauge": 1},
+			Labels:     map[string]string{"counter": "a"},
+			Indices:    map[string]string{"sensor": "a"},
+		})
+		if err == nil {
+			t.Error("expected error, received nil")
+		}
+
+		if previous != nil {
+			t.Errorf("expected nil, received %#v", previous)
+		}
+	})
+}
+
 func TestJDB_Upsert_Complex(t *testing.T) {
 	f, err := os.CreateTemp("", "")
 	if err != nil {
@@ -230,6 +403,128 @@ func TestJDB_Upsert_Complex(t *testing.T) {
 	}
 }
 
+func TestJDB_Upsert_Complex_KeepEarliest(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	jdb.FlushMaxSize = 1_000_000
+	jdb.FlushMaxDuration = 1<<63 - 1
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	runs := 20_000
+
+	for i := 0; i < runs; i++ {
+		if i%7 == 0 {
+			err := db.Upsert(&jdb.Measurement{
+				Name: "supplementary",
+				When: time.Now(),
+				Dimensions: map[string]float64{
+					"idx": float64(i),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := db.Upsert(&jdb.Measurement{
+			Name: "upserts",
+			When: now,
+			Indices: map[string]string{
+				"test_func": "TestJDB_Upsert_Complex_KeepEarliest",
+			},
+			Labels: map[string]string{
+				"iteration": fmt.Sprintf("%d", i),
+			},
+			Dimensions: map[string]float64{
+				"value": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Get data without deduping
+	dupes, err := db.QueryAll("upserts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runs != len(dupes) {
+		t.Errorf("expected %d, received %d", runs, len(dupes))
+	}
+
+	// Get data after deduping, keeping the earliest value
+	dedupes, err := db.QueryAll("upserts", &jdb.Options{Deduplicate: true, DeduplicateKeep: jdb.KeepEarliest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dedupes) != 1 {
+		t.Fatalf("expected 1, received %d", len(dedupes))
+	}
+
+	v := dedupes[0].Dimensions["value"]
+	if v != 0 {
+		t.Errorf("expected %f, received %f", 0.0, v)
+	}
+
+	if it := dedupes[0].Labels["iteration"]; it != "0" {
+		t.Errorf("expected %q, received %q", "0", it)
+	}
+
+	// Superseded versions are dropped as the database is reopened, and so
+	// KeepEarliest only considers versions written since
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	err = db.Upsert(&jdb.Measurement{
+		Name: "upserts",
+		When: now,
+		Indices: map[string]string{
+			"test_func": "TestJDB_Upsert_Complex_KeepEarliest",
+		},
+		Dimensions: map[string]float64{
+			"value": float64(runs),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dedupes, err = db.QueryAll("upserts", &jdb.Options{Deduplicate: true, DeduplicateKeep: jdb.KeepEarliest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dedupes) != 1 {
+		t.Fatalf("expected 1, received %d", len(dedupes))
+	}
+
+	v = dedupes[0].Dimensions["value"]
+	if v != float64(runs-1) {
+		t.Errorf("expected %f, received %f", float64(runs-1), v)
+	}
+}
+
 func TestJDB_Insert_with_small_buffer(t *testing.T) {
 	f, err := os.CreateTemp("", "")
 	if err != nil {
@@ -290,7 +585,7 @@ func TestJDB_Insert_with_short_duration(t *testing.T) {
 	}
 }
 
-func TestJDB_QueryAll(t *testing.T) {
+func TestJDB_InsertNow(t *testing.T) {
 	f, err := os.CreateTemp("", "")
 	if err != nil {
 		t.Fatal(err)
@@ -304,12 +599,12 @@ func TestJDB_QueryAll(t *testing.T) {
 
 	defer db.Close()
 
-	for i := 0; i < 10; i++ {
-		err = db.Insert(&jdb.Measurement{
-			Name: "wibbles",
-			When: time.Now().Add(time.Hour * time.Duration(i)),
+	runs := 10_000
+	for i := 0; i < runs; i++ {
+		err = db.InsertNow(&jdb.Measurement{
+			Name: "counters",
 			Dimensions: map[string]float64{
-				"wobble_count": float64(i * 17),
+				"counter": float64(i),
 			},
 		})
 		if err != nil {
@@ -317,41 +612,23 @@ func TestJDB_QueryAll(t *testing.T) {
 		}
 	}
 
-	for _, test := range []struct {
-		name        string
-		searchName  string
-		expectCount int
-		expectErr   bool
-	}{
-		{"Empty measurement fails", "", 0, true},
-		{"Missing/ unknown measurement fails", "zimzams", 0, true},
-		{"Valid measurement returns correctly", "wibbles", 10, false},
-	} {
-		t.Run(test.name, func(t *testing.T) {
-			m, err := db.QueryAll(test.searchName, nil)
-			if test.expectErr == (err == nil) {
-				t.Errorf("expected: %v, received %#v", test.expectErr, err)
-			}
-
-			rcvd := len(m)
-			if test.expectCount != rcvd {
-				t.Errorf("expected: %d, received %d", test.expectCount, rcvd)
-			}
+	m, err := db.QueryAll("counters", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-			t.Run("results are sorted", func(t *testing.T) {
-				sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
-					return a.When.Compare(b.When)
-				})
+	if runs != len(m) {
+		t.Errorf("expected %d measurements, received %d", runs, len(m))
+	}
 
-				if !sorted {
-					t.Error("Results are not sorted")
-				}
-			})
-		})
+	for i := 1; i < len(m); i++ {
+		if !m[i].When.After(m[i-1].When) {
+			t.Fatalf("expected strictly increasing timestamps, received %s then %s", m[i-1].When, m[i].When)
+		}
 	}
 }
 
-func TestJDB_QueryAll_options(t *testing.T) {
+func TestJDB_InsertBatch(t *testing.T) {
 	f, err := os.CreateTemp("", "")
 	if err != nil {
 		t.Fatal(err)
@@ -366,64 +643,100 @@ func TestJDB_QueryAll_options(t *testing.T) {
 	defer db.Close()
 
 	now := time.Now()
-	for i := 0; i < 10; i++ {
-		err = db.Insert(&jdb.Measurement{
-			Name: "wibbles",
-			When: now.Add(0 - time.Hour*time.Duration(i)),
-			Dimensions: map[string]float64{
-				"wobble_count": float64(i * 17),
-			},
-		})
-		if err != nil {
-			t.Fatal(err)
+
+	batch := func(offset, n int) (ms []*jdb.Measurement) {
+		for i := 0; i < n; i++ {
+			ms = append(ms, &jdb.Measurement{
+				Name: "wibbles",
+				// Insert out of order, to ensure shards are sorted afterwards
+				When: now.Add(0 - time.Minute*time.Duration(offset+i)),
+				Dimensions: map[string]float64{
+					"wobble_count": float64(i * 17),
+				},
+				Indices: map[string]string{
+					"wibbler": "0xabadbabe",
+				},
+			})
 		}
+
+		return
+	}
+
+	err = db.InsertBatch(batch(0, 100))
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	for _, test := range []struct {
 		name        string
-		searchName  string
-		opts        *jdb.Options
-		expectCount int
-		expectErr   bool
+		ms          []*jdb.Measurement
+		expectIndex int
+		expectErr   error
 	}{
-		{"Nil options returns all values", "wibbles", nil, 10, false},
-		{"Empty options returns all values", "wibbles", new(jdb.Options), 10, false},
-		{"Setting To to now and leaving all else returns all values", "wibbles", &jdb.Options{To: now}, 10, false},
-		{"Setting To to now and setting Duration to 24 hours returns all values", "wibbles", &jdb.Options{To: now, Since: time.Hour * 24}, 10, false},
-		{"Setting Duration to 24 hours and leaving all else returns all values", "wibbles", &jdb.Options{Since: time.Hour * 24}, 10, false},
-		{"Setting From to 2 hours ago returns three values", "wibbles", &jdb.Options{From: now.Add(0 - time.Hour*2)}, 3, false},
+		{"Invalid measurements fail", append(batch(100, 5), &jdb.Measurement{Name: "wibbles"}), 5, jdb.ErrNoDimensions},
+		{"Measurements which already exist fail", append(batch(200, 5), batch(50, 1)...), 5, jdb.ErrDuplicateMeasurement},
+		{"Duplicates within the batch fail", append(batch(300, 5), batch(300, 1)...), 5, jdb.ErrDuplicateMeasurement},
 	} {
 		t.Run(test.name, func(t *testing.T) {
-			m, err := db.QueryAll(test.searchName, test.opts)
-			if test.expectErr == (err == nil) {
-				t.Errorf("expected: %v, received %#v", test.expectErr, err)
-			}
+			err := db.InsertBatch(test.ms)
 
-			rcvd := len(m)
-			if test.expectCount != rcvd {
-				t.Errorf("expected: %d, received %d", test.expectCount, rcvd)
+			var be *jdb.BatchError
+			if !errors.As(err, &be) {
+				t.Fatalf("expected *jdb.BatchError, received %#v", err)
 			}
 
-			t.Run("results are sorted", func(t *testing.T) {
-				sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
-					return a.When.Compare(b.When)
-				})
+			if test.expectIndex != be.Index {
+				t.Errorf("expected failure at %d, received %d", test.expectIndex, be.Index)
+			}
 
-				if !sorted {
-					t.Error("Results are not sorted")
-				}
-			})
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, be.Err)
+			}
 		})
 	}
+
+	t.Run("Failed batches insert nothing, and successful batches are sorted", func(t *testing.T) {
+		for _, m := range []func() ([]*jdb.Measurement, error){
+			func() ([]*jdb.Measurement, error) { return db.QueryAll("wibbles", nil) },
+			func() ([]*jdb.Measurement, error) { return db.QueryAllIndex("wibbles", "wibbler", "0xabadbabe", nil) },
+		} {
+			m, err := m()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m) != 100 {
+				t.Errorf("expected 100 measurements, received %d", len(m))
+			}
+
+			sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
+				return a.When.Compare(b.When)
+			})
+
+			if !sorted {
+				t.Error("Results are not sorted")
+			}
+		}
+	})
 }
 
-func TestJDB_QueryAllCSV(t *testing.T) {
+// TestJDB_concurrency is most useful when run with the race detector, as
+// per `go test -race`
+func TestJDB_concurrency(t *testing.T) {
 	f, err := os.CreateTemp("", "")
 	if err != nil {
 		t.Fatal(err)
 	}
 	f.Close()
 
+	// Flush often, so that flushes run alongside queries
+	flushMaxSize := jdb.FlushMaxSize
+	jdb.FlushMaxSize = 10
+
+	defer func() {
+		jdb.FlushMaxSize = flushMaxSize
+	}()
+
 	db, err := jdb.New(f.Name())
 	if err != nil {
 		t.Fatal(err)
@@ -431,93 +744,80 @@ func TestJDB_QueryAllCSV(t *testing.T) {
 
 	defer db.Close()
 
-	for i := 0; i < 10; i++ {
-		err = db.Insert(&jdb.Measurement{
-			Name: "wibbles",
-			When: time.Now().Add(time.Hour * time.Duration(i)),
-			Dimensions: map[string]float64{
-				"wobble_count": float64(i * 17),
-				"jiggle_tally": float64(8 ^ 17),
-			},
-			Indices: map[string]string{
-				"enabled": "probably",
-				"wibbler": "0xabadbabe",
-			},
-			Labels: map[string]string{
-				"version": "v0.1.1",
-				"uptime":  "1h32m11s",
-			},
-		})
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	// Add one more with slight different labels
+	now := time.Now()
 	err = db.Insert(&jdb.Measurement{
-		Name: "wibbles",
-		When: time.Now().Add(time.Hour * 72),
-		Dimensions: map[string]float64{
-			"wobble_count": 6.1111111111113,
-			"jiggle_tally": 1,
-		},
-		Indices: map[string]string{
-			"wibbler": "0xcafebabe",
-		},
-		Labels: map[string]string{
-			"uptime":   "1h32m11s",
-			"operator": "Big Doug",
-		},
+		Name:       "wibbles",
+		When:       now,
+		Dimensions: map[string]float64{"wobble_count": 0},
+		Indices:    map[string]string{"wibbler": "0xabadbabe"},
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	for _, test := range []struct {
-		name        string
-		measurement string
-		expectRows  int
-		expectCols  int
-		expectErr   bool
-	}{
-		{"Querying non-existent measurement should fail", "floops", 0, 0, true},
-		{"Querying valid measurement should return union of all fields", "wibbles", 12, 9, false},
-	} {
-		t.Run(test.name, func(t *testing.T) {
-			b, err := db.QueryAllCSV(test.measurement, nil)
-			if test.expectErr == (err == nil) {
-				t.Errorf("expected: %v, received %#v", test.expectErr, err)
-			}
+	wg := new(sync.WaitGroup)
+	errs := make(chan error, 100)
 
-			buf := bytes.NewBuffer(b)
-			r := csv.NewReader(buf)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
 
-			records, err := r.ReadAll()
-			if err != nil {
-				t.Fatal(err)
-			}
+		go func(w int) {
+			defer wg.Done()
 
-			if test.expectRows != len(records) {
-				t.Errorf("expected %d records, received %d", test.expectRows, len(records))
+			for i := 1; i < 250; i++ {
+				err := db.Upsert(&jdb.Measurement{
+					Name:       "wibbles",
+					When:       now.Add(time.Minute * time.Duration(i)),
+					Dimensions: map[string]float64{"wobble_count": float64(w * i)},
+					Indices:    map[string]string{"wibbler": "0xabadbabe"},
+				})
+				if err != nil {
+					errs <- err
+
+					return
+				}
 			}
+		}(w)
+	}
 
-			if len(records) == 0 {
-				if test.expectRows > 0 {
-					t.Fatal("there should be some columns to count, but there arent'")
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				_, err := db.QueryAll("wibbles", &jdb.Options{Deduplicate: true})
+				if err == nil {
+					_, err = db.QueryAllIndex("wibbles", "wibbler", "0xabadbabe", nil)
 				}
 
-				return
-			}
+				if err == nil {
+					_, err = db.QueryFields("wibbles")
+				}
 
-			cols := records[0]
-			if test.expectCols != len(cols) {
-				t.Errorf("expected %d columns, received %d", test.expectCols, len(cols))
+				if err == nil {
+					_, err = db.QueryAllCSV("wibbles", nil)
+				}
+
+				if err != nil {
+					errs <- err
+
+					return
+				}
 			}
-		})
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
 	}
 }
 
-func TestJDB_QueryAllIndex(t *testing.T) {
+func TestJDB_Flush(t *testing.T) {
 	f, err := os.CreateTemp("", "")
 	if err != nil {
 		t.Fatal(err)
@@ -531,230 +831,1578 @@ func TestJDB_QueryAllIndex(t *testing.T) {
 
 	defer db.Close()
 
-	for i := 0; i < 10; i++ {
-		err = db.Insert(&jdb.Measurement{
-			Name: "wibbles",
-			When: time.Now().Add(time.Hour * time.Duration(i)),
-			Dimensions: map[string]float64{
-				"wobble_count": float64(i * 17),
-			},
-			Indices: map[string]string{
-				"wizzles": "plenty",
-			},
-		})
+	size := func() int64 {
+		fi, err := os.Stat(f.Name())
 		if err != nil {
 			t.Fatal(err)
 		}
+
+		return fi.Size()
 	}
 
-	for _, test := range []struct {
-		name           string
-		searchName     string
-		searchIndex    string
-		searchIndexKey string
-		expectCount    int
-		expectErr      bool
-	}{
-		{"Empty measurement fails", "", "", "", 0, true},
-		{"Missing/ unknown measurement fails", "zimzams", "", "", 0, true},
-		{"Empty index fails", "wibbles", "", "", 0, true},
-		{"Missing/ unknown index fails", "wibbles", "wazzles", "", 0, true},
+	t.Run("Flushing an empty buffer does nothing", func(t *testing.T) {
+		err = db.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
 
-		{"Valid measurement and index, no-such value, returns 0", "wibbles", "wizzles", "some", 0, false},
-		{"Valid measurement and index returns correctly", "wibbles", "wizzles", "plenty", 10, false},
-	} {
-		t.Run(test.name, func(t *testing.T) {
-			m, err := db.QueryAllIndex(test.searchName, test.searchIndex, test.searchIndexKey, nil)
-			if test.expectErr == (err == nil) {
-				t.Errorf("expected: %v, received %#v", test.expectErr, err)
-			}
+		if s := size(); s != 0 {
+			t.Errorf("expected empty file, received %d bytes", s)
+		}
+	})
 
-			rcvd := len(m)
-			if test.expectCount != rcvd {
-				t.Errorf("expected: %d, received %d", test.expectCount, rcvd)
-			}
+	t.Run("Flushing writes buffered measurements to disk", func(t *testing.T) {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "counters",
+			When:       time.Now(),
+			Dimensions: map[string]float64{"counter": 1234},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
 
-			t.Run("results are sorted", func(t *testing.T) {
-				sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
-					return a.When.Compare(b.When)
-				})
+		err = db.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
 
-				if !sorted {
-					t.Error("Results are not sorted")
-				}
-			})
-		})
-	}
+		if s := size(); s == 0 {
+			t.Error("expected data on disk, received empty file")
+		}
+	})
 }
 
-func TestJDB_QueryFields(t *testing.T) {
-	f, err := os.CreateTemp("", "")
+func TestJDB_Sync(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "sync.db")
+
+	fileDB, err := jdb.New(f)
 	if err != nil {
 		t.Fatal(err)
 	}
-	f.Close()
 
-	db, err := jdb.New(f.Name())
+	defer fileDB.Close()
+
+	memoryDB, err := jdb.NewInMemory()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	defer db.Close()
+	defer memoryDB.Close()
 
-	for i := 0; i < jdb.FlushMaxSize*5; i++ {
-		err = db.Insert(&jdb.Measurement{
-			Name: "wibbles",
-			When: time.Now().Add(0 - time.Hour*time.Duration(i)),
-			Dimensions: map[string]float64{
-				"wobble_count": float64(i * 17),
-			},
-		})
-		if err != nil {
-			t.Fatal(err)
-		}
+	storeDB, err := jdb.NewWithStore(new(jdb.MemoryStore))
+	if err != nil {
+		t.Fatal(err)
 	}
 
+	defer storeDB.Close()
+
 	for _, test := range []struct {
-		name         string
-		measurement  string
-		expectFields int
-		expectErr    bool
+		name string
+		db   *jdb.JDB
 	}{
-		{"Querying an unknown measure should fail", "wet_hankies", 0, true},
-		{"Querying an valid measure should succeed", "wibbles", 2, false},
+		{"File backed database syncs", fileDB},
+		{"In-memory database does nothing", memoryDB},
+		{"Store without Sync does nothing", storeDB},
 	} {
 		t.Run(test.name, func(t *testing.T) {
-			f, err := db.QueryFields(test.measurement)
-			if test.expectErr == (err == nil) {
-				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			err := test.db.Insert(&jdb.Measurement{
+				Name:       "counters",
+				When:       time.Now(),
+				Dimensions: map[string]float64{"counter": 1234},
+			})
+			if err != nil {
+				t.Fatal(err)
 			}
 
-			if test.expectFields != len(f) {
-				t.Errorf("expected %d fields, received %d", test.expectFields, len(f))
+			err = test.db.Flush()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = test.db.Sync()
+			if err != nil {
+				t.Errorf("unexpected error: %#v", err)
 			}
 		})
 	}
 }
 
-func ExampleNew_create_database_and_query_index() {
+func TestJDB_Insert_IntDimensions(t *testing.T) {
 	f, err := os.CreateTemp("", "")
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 	f.Close()
 
-	// Effectively disable flushing to disk for the sake of
-	// timeliness in this test
-	jdb.FlushMaxSize = 1_000_000
-	jdb.FlushMaxDuration = 1<<63 - 1
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	database, err := jdb.New(f.Name())
+	// 2^53 + 1 can't be represented by a float64
+	var big int64 = 1<<53 + 1
+
+	err = db.Insert(&jdb.Measurement{
+		Name:          "counters",
+		When:          time.Now(),
+		IntDimensions: map[string]int64{"counter": big},
+	})
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 
-	defer database.Close()
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	t := time.Time{}
-	for i := 0; i < 1000; i++ {
-		t = t.Add(time.Minute)
+	db, err = jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		m := &jdb.Measurement{
-			When: t,
-			Name: "environmental_monitoring",
-			Dimensions: map[string]float64{
-				"Temperature": 19.23,
-				"Humidity":    52.43234,
-				"AQI":         1,
-			},
-			Labels: map[string]string{
-				"sensor_version": "v1.0.1",
-				"uptime":         "1h31m6s",
-			},
-			Indices: map[string]string{
-				"location": "living room",
-			},
+	defer db.Close()
+
+	t.Run("Values survive reopening exactly", func(t *testing.T) {
+		m, err := db.QueryAll("counters", nil)
+		if err != nil {
+			t.Fatal(err)
 		}
 
-		err = m.Validate()
+		if m[0].IntDimensions["counter"] != big {
+			t.Errorf("expected %d, received %d", big, m[0].IntDimensions["counter"])
+		}
+	})
+
+	t.Run("Values are exported to CSV exactly", func(t *testing.T) {
+		b, err := db.QueryAllCSV("counters", nil)
 		if err != nil {
-			panic(err)
+			t.Fatal(err)
 		}
 
-		err = database.Insert(m)
+		if !bytes.Contains(b, []byte(strconv.FormatInt(big, 10))) {
+			t.Errorf("expected %d in %q", big, string(b))
+		}
+	})
+
+	t.Run("Field types are reported", func(t *testing.T) {
+		f, err := db.QueryFieldTypes("counters")
 		if err != nil {
-			panic(err)
+			t.Fatal(err)
 		}
+
+		if f["counter"] != "int_dimension" {
+			t.Errorf("expected int_dimension, received %q", f["counter"])
+		}
+	})
+}
+
+func TestJDB_Insert_States(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "states.db")
+
+	db, err := jdb.New(f)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// Query an empty index
-	measurements, err := database.QueryAllIndex("environmental_monitoring", "location", "bedroom", nil)
+	now := time.Now().Add(0 - time.Minute).Truncate(time.Second)
+
+	err = db.Insert(&jdb.Measurement{
+		Name:       "pumps",
+		When:       now,
+		Dimensions: map[string]float64{"flow": 1.5},
+		States:     map[string]bool{"running": true},
+		Indices:    map[string]string{"pump": "a"},
+	})
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 
-	fmt.Printf("measurements where location == bedroom: %d\n", len(measurements))
+	err = db.Insert(&jdb.Measurement{
+		Name:       "pumps",
+		When:       now.Add(time.Second),
+		Dimensions: map[string]float64{"flow": 0},
+		States:     map[string]bool{"running": false},
+		Indices:    map[string]string{"pump": "a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// Query an index with items
-	measurements, err = database.QueryAllIndex("environmental_monitoring", "location", "living room", new(jdb.Options))
+	err = db.Close()
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 
-	fmt.Printf("measurements where location == 'living room': %d\n", len(measurements))
+	db, err = jdb.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// output:
-	// measurements where location == bedroom: 0
-	// measurements where location == 'living room': 1000
+	defer db.Close()
+
+	t.Run("Values survive reopening", func(t *testing.T) {
+		m, err := db.QueryAll("pumps", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, expect := range []bool{true, false} {
+			v, ok := m[i].States["running"]
+			if !ok || v != expect {
+				t.Errorf("expected %v, received %v (ok: %v)", expect, v, ok)
+			}
+		}
+	})
+
+	t.Run("Values are exported to CSV as booleans", func(t *testing.T) {
+		b, err := db.QueryAllCSV("pumps", &jdb.Options{CSV: jdb.CSVOptions{TimeFormat: time.RFC3339}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := "timestamp,measure,flow,pump,running\n" +
+			now.Format(time.RFC3339) + ",pumps,1.5,a,true\n" +
+			now.Add(time.Second).Format(time.RFC3339) + ",pumps,0,a,false\n"
+
+		if expect != string(b) {
+			t.Errorf("expected\n%s\nreceived\n%s", expect, string(b))
+		}
+	})
+
+	t.Run("Field types are reported", func(t *testing.T) {
+		f, err := db.QueryFieldTypes("pumps")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f["running"] != "state" {
+			t.Errorf("expected state, received %q", f["running"])
+		}
+	})
+
+	for _, test := range []struct {
+		name string
+		m    *jdb.Measurement
+	}{
+		{"States clashing with indices fail", &jdb.Measurement{Name: "pumps", States: map[string]bool{"pump": true}, Indices: map[string]string{"pump": "a"}}},
+		{"States clashing with labels fail", &jdb.Measurement{Name: "pumps", States: map[string]bool{"site": true}, Labels: map[string]string{"site": "a"}}},
+		{"States clashing with existing dimensions fail", &jdb.Measurement{Name: "pumps", States: map[string]bool{"flow": true}, Indices: map[string]string{"pump": "b"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := db.Insert(test.m)
+			if err == nil {
+				t.Error("expected error, received nil")
+			}
+		})
+	}
 }
 
-func ExampleNew_create_close_reopen_database() {
+func TestJDB_QueryAll(t *testing.T) {
 	f, err := os.CreateTemp("", "")
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 	f.Close()
 
-	// Effectively disable flushing to disk for the sake of
-	// timeliness in this test
-	jdb.FlushMaxSize = 1_000_000
-	jdb.FlushMaxDuration = 1<<63 - 1
-
-	database, err := jdb.New(f.Name())
+	db, err := jdb.New(f.Name())
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 
-	err = database.Insert(&jdb.Measurement{Name: "counters", Dimensions: map[string]float64{"Counter": 1234}})
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: time.Now().Add(time.Hour * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		searchName  string
+		expectCount int
+		expectErr   bool
+	}{
+		{"Empty measurement fails", "", 0, true},
+		{"Missing/ unknown measurement fails", "zimzams", 0, true},
+		{"Valid measurement returns correctly", "wibbles", 10, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryAll(test.searchName, nil)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			rcvd := len(m)
+			if test.expectCount != rcvd {
+				t.Errorf("expected: %d, received %d", test.expectCount, rcvd)
+			}
+
+			t.Run("results are sorted", func(t *testing.T) {
+				sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
+					return a.When.Compare(b.When)
+				})
+
+				if !sorted {
+					t.Error("Results are not sorted")
+				}
+			})
+		})
+	}
+}
+
+func TestJDB_QueryAll_options(t *testing.T) {
+	f, err := os.CreateTemp("", "")
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
+	f.Close()
 
-	// Query database
-	m, err := database.QueryAll("counters", nil)
+	db, err := jdb.New(f.Name())
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 
-	fmt.Printf("counters: %d\n", len(m))
+	defer db.Close()
 
-	// Close database
-	database.Close()
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(0 - time.Hour*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
 
-	// Reopen, reconcile for same data
-	database, err = jdb.New(f.Name())
+	for _, test := range []struct {
+		name        string
+		searchName  string
+		opts        *jdb.Options
+		expectCount int
+		expectErr   bool
+	}{
+		{"Nil options returns all values", "wibbles", nil, 10, false},
+		{"Empty options returns all values", "wibbles", new(jdb.Options), 10, false},
+		{"Setting To to now and leaving all else returns all values", "wibbles", &jdb.Options{To: now}, 10, false},
+		{"Setting To to now and setting Duration to 24 hours returns all values", "wibbles", &jdb.Options{To: now, Since: time.Hour * 24}, 10, false},
+		{"Setting Duration to 24 hours and leaving all else returns all values", "wibbles", &jdb.Options{Since: time.Hour * 24}, 10, false},
+		{"Setting From to 2 hours ago returns three values", "wibbles", &jdb.Options{From: now.Add(0 - time.Hour*2)}, 3, false},
+		{"Setting To exactly on a measurement includes it", "wibbles", &jdb.Options{To: now.Add(0 - time.Hour)}, 9, false},
+		{"Setting To exactly on a measurement without a monotonic clock includes it", "wibbles", &jdb.Options{To: now.Add(0 - time.Hour).Round(0)}, 9, false},
+		{"Setting From exactly on a measurement without a monotonic clock includes it", "wibbles", &jdb.Options{From: now.Add(0 - time.Hour*2).Round(0)}, 3, false},
+		{"Setting From and To to the same measurement returns it", "wibbles", &jdb.Options{From: now.Add(0 - time.Hour*3).Round(0), To: now.Add(0 - time.Hour*3).Round(0)}, 1, false},
+		{"Setting To and Since exactly on measurements includes both", "wibbles", &jdb.Options{To: now.Add(0 - time.Hour).Round(0), Since: time.Hour * 2}, 3, false},
+		{"Setting From after To fails", "wibbles", &jdb.Options{From: now, To: now.Add(0 - time.Hour)}, 0, true},
+		{"Setting From after To with Since ignores From", "wibbles", &jdb.Options{From: now, To: now.Add(0 - time.Hour), Since: time.Hour}, 2, false},
+		{"Setting a negative Since fails", "wibbles", &jdb.Options{Since: 0 - time.Hour}, 0, true},
+		{"Setting Limit returns that many values", "wibbles", &jdb.Options{Limit: 4}, 4, false},
+		{"Setting Offset skips values", "wibbles", &jdb.Options{Offset: 7}, 3, false},
+		{"Setting Offset beyond the results returns nothing", "wibbles", &jdb.Options{Offset: 20}, 0, false},
+		{"Setting a negative Limit fails", "wibbles", &jdb.Options{Limit: -1}, 0, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryAll(test.searchName, test.opts)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			rcvd := len(m)
+			if test.expectCount != rcvd {
+				t.Errorf("expected: %d, received %d", test.expectCount, rcvd)
+			}
+
+			t.Run("results are sorted", func(t *testing.T) {
+				sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
+					return a.When.Compare(b.When)
+				})
+
+				if !sorted {
+					t.Error("Results are not sorted")
+				}
+			})
+		})
+	}
+}
+
+func TestJDB_QueryAllCSV(t *testing.T) {
+	f, err := os.CreateTemp("", "")
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
+	f.Close()
 
-	m, err = database.QueryAll("counters", nil)
+	db, err := jdb.New(f.Name())
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 
-	fmt.Printf("counters: %d\n", len(m))
+	defer db.Close()
 
-	// output:
-	// counters: 1
-	// counters: 1
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: time.Now().Add(time.Hour * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+				"jiggle_tally": float64(8 ^ 17),
+			},
+			Indices: map[string]string{
+				"enabled": "probably",
+				"wibbler": "0xabadbabe",
+			},
+			Labels: map[string]string{
+				"version": "v0.1.1",
+				"uptime":  "1h32m11s",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Add one more with slight different labels
+	err = db.Insert(&jdb.Measurement{
+		Name: "wibbles",
+		When: time.Now().Add(time.Hour * 72),
+		Dimensions: map[string]float64{
+			"wobble_count": 6.1111111111113,
+			"jiggle_tally": 1,
+		},
+		Indices: map[string]string{
+			"wibbler": "0xcafebabe",
+		},
+		Labels: map[string]string{
+			"uptime":   "1h32m11s",
+			"operator": "Big Doug",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		expectRows  int
+		expectCols  int
+		expectErr   bool
+	}{
+		{"Querying non-existent measurement should fail", "floops", 0, 0, true},
+		{"Querying valid measurement should return union of all fields", "wibbles", 12, 9, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := db.QueryAllCSV(test.measurement, nil)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			buf := bytes.NewBuffer(b)
+			r := csv.NewReader(buf)
+
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectRows != len(records) {
+				t.Errorf("expected %d records, received %d", test.expectRows, len(records))
+			}
+
+			if len(records) == 0 {
+				if test.expectRows > 0 {
+					t.Fatal("there should be some columns to count, but there arent'")
+				}
+
+				return
+			}
+
+			cols := records[0]
+			if test.expectCols != len(cols) {
+				t.Errorf("expected %d columns, received %d", test.expectCols, len(cols))
+			}
+		})
+	}
+}
+
+func TestJDB_WriteCSV(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: time.Now().Add(time.Hour * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+			Labels: map[string]string{
+				"version": "v0.1.1",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Querying non-existent measurement should fail", func(t *testing.T) {
+		err := db.WriteCSV(new(bytes.Buffer), "floops", nil)
+		if err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("Output matches QueryAllCSV", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+
+		err := db.WriteCSV(buf, "wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := db.QueryAllCSV("wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b, buf.Bytes()) {
+			t.Errorf("expected %q, received %q", string(b), buf.String())
+		}
+
+		records, err := csv.NewReader(buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(records) != 11 {
+			t.Errorf("expected 11 records, received %d", len(records))
+		}
+	})
+
+	for _, test := range []struct {
+		name       string
+		opts       jdb.CSVOptions
+		expectCols int
+		expectTime string
+	}{
+		{"Default options include every column", jdb.CSVOptions{}, 5, time.RFC3339},
+		{"Setting a delimiter produces TSV", jdb.CSVOptions{Delimiter: '\t'}, 5, time.RFC3339},
+		{"Setting a time format is honoured", jdb.CSVOptions{TimeFormat: time.RFC3339Nano}, 5, time.RFC3339Nano},
+		{"Omitting labels drops label columns", jdb.CSVOptions{OmitLabels: true}, 4, time.RFC3339},
+		{"Omitting indices drops index columns", jdb.CSVOptions{OmitIndices: true}, 4, time.RFC3339},
+		{"Omitting both leaves only dimensions", jdb.CSVOptions{OmitLabels: true, OmitIndices: true}, 3, time.RFC3339},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+
+			err := db.WriteCSV(buf, "wibbles", &jdb.Options{CSV: test.opts})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := csv.NewReader(buf)
+			if test.opts.Delimiter != 0 {
+				r.Comma = test.opts.Delimiter
+			}
+
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectCols != len(records[0]) {
+				t.Errorf("expected %d columns, received %d", test.expectCols, len(records[0]))
+			}
+
+			_, err = time.Parse(test.expectTime, records[1][0])
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestJDB_WriteCSV_Gzip(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(0 - time.Minute*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plain, err := db.QueryAllCSV("wibbles", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = db.WriteCSV(buf, "wibbles", &jdb.Options{CSV: jdb.CSVOptions{Gzip: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gr, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(plain, b) {
+		t.Errorf("expected %q, received %q", string(plain), string(b))
+	}
+}
+
+func TestJDB_QueryAllIndex(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: time.Now().Add(time.Hour * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+			Indices: map[string]string{
+				"wizzles": "plenty",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name           string
+		searchName     string
+		searchIndex    string
+		searchIndexKey string
+		expectCount    int
+		expectErr      bool
+	}{
+		{"Empty measurement fails", "", "", "", 0, true},
+		{"Missing/ unknown measurement fails", "zimzams", "", "", 0, true},
+		{"Empty index fails", "wibbles", "", "", 0, true},
+		{"Missing/ unknown index fails", "wibbles", "wazzles", "", 0, true},
+
+		{"Valid measurement and index, no-such value, returns 0", "wibbles", "wizzles", "some", 0, false},
+		{"Valid measurement and index returns correctly", "wibbles", "wizzles", "plenty", 10, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryAllIndex(test.searchName, test.searchIndex, test.searchIndexKey, nil)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			rcvd := len(m)
+			if test.expectCount != rcvd {
+				t.Errorf("expected: %d, received %d", test.expectCount, rcvd)
+			}
+
+			t.Run("results are sorted", func(t *testing.T) {
+				sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
+					return a.When.Compare(b.When)
+				})
+
+				if !sorted {
+					t.Error("Results are not sorted")
+				}
+			})
+		})
+	}
+}
+
+func TestJDB_QueryFields(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for i := 0; i < jdb.FlushMaxSize*5; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: time.Now().Add(0 - time.Hour*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name         string
+		measurement  string
+		expectFields int
+		expectErr    bool
+	}{
+		{"Querying an unknown measure should fail", "wet_hankies", 0, true},
+		{"Querying an valid measure should succeed", "wibbles", 2, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := db.QueryFields(test.measurement)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectFields != len(f) {
+				t.Errorf("expected %d fields, received %d", test.expectFields, len(f))
+			}
+		})
+	}
+}
+
+func TestJDB_QueryFieldTypes(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	err = db.Insert(&jdb.Measurement{
+		Name: "environment",
+		When: time.Now(),
+		Dimensions: map[string]float64{
+			"Temperature": 19.23,
+		},
+		Indices: map[string]string{
+			"location": "living room",
+		},
+		Labels: map[string]string{
+			"sensor_version": "v1.0.1",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		expect      map[string]string
+		expectErr   bool
+	}{
+		{"Querying an unknown measure should fail", "wet_hankies", nil, true},
+		{"Querying an valid measure should succeed", "environment", map[string]string{"Temperature": "dimension", "location": "index", "sensor_version": "label"}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := db.QueryFieldTypes(test.measurement)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if !maps.Equal(test.expect, f) {
+				t.Errorf("expected %#v, received %#v", test.expect, f)
+			}
+		})
+	}
+}
+
+func ExampleNew_create_database_and_query_index() {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+
+	// Effectively disable flushing to disk for the sake of
+	// timeliness in this test
+	jdb.FlushMaxSize = 1_000_000
+	jdb.FlushMaxDuration = 1<<63 - 1
+
+	database, err := jdb.New(f.Name())
+	if err != nil {
+		panic(err)
+	}
+
+	defer database.Close()
+
+	t := time.Time{}
+	for i := 0; i < 1000; i++ {
+		t = t.Add(time.Minute)
+
+		m := &jdb.Measurement{
+			When: t,
+			Name: "environmental_monitoring",
+			Dimensions: map[string]float64{
+				"Temperature": 19.23,
+				"Humidity":    52.43234,
+				"AQI":         1,
+			},
+			Labels: map[string]string{
+				"sensor_version": "v1.0.1",
+				"uptime":         "1h31m6s",
+			},
+			Indices: map[string]string{
+				"location": "living room",
+			},
+		}
+
+		err = m.Validate()
+		if err != nil {
+			panic(err)
+		}
+
+		err = database.Insert(m)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Query an empty index
+	measurements, err := database.QueryAllIndex("environmental_monitoring", "location", "bedroom", nil)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("measurements where location == bedroom: %d\n", len(measurements))
+
+	// Query an index with items
+	measurements, err = database.QueryAllIndex("environmental_monitoring", "location", "living room", new(jdb.Options))
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("measurements where location == 'living room': %d\n", len(measurements))
+
+	// output:
+	// measurements where location == bedroom: 0
+	// measurements where location == 'living room': 1000
+}
+
+func ExampleNew_create_close_reopen_database() {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+
+	// Effectively disable flushing to disk for the sake of
+	// timeliness in this test
+	jdb.FlushMaxSize = 1_000_000
+	jdb.FlushMaxDuration = 1<<63 - 1
+
+	database, err := jdb.New(f.Name())
+	if err != nil {
+		panic(err)
+	}
+
+	err = database.Insert(&jdb.Measurement{Name: "counters", Dimensions: map[string]float64{"Counter": 1234}})
+	if err != nil {
+		panic(err)
+	}
+
+	// Query database
+	m, err := database.QueryAll("counters", nil)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("counters: %d\n", len(m))
+
+	// Close database
+	database.Close()
+
+	// Reopen, reconcile for same data
+	database, err = jdb.New(f.Name())
+	if err != nil {
+		panic(err)
+	}
+
+	m, err = database.QueryAll("counters", nil)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("counters: %d\n", len(m))
+
+	// output:
+	// counters: 1
+	// counters: 1
+}
+
+func TestJDB_Stats(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	jdb.FlushMaxSize = 1_000_000
+	jdb.FlushMaxDuration = 1<<63 - 1
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		for _, name := range []string{"wibbles", "wobbles"} {
+			err = db.Insert(&jdb.Measurement{
+				Name: name,
+				When: time.Now().Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"count": float64(i),
+				},
+				Indices: map[string]string{
+					"host":     "alpha",
+					"location": "kitchen",
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	s := db.Stats()
+
+	for _, test := range []struct {
+		name     string
+		expect   int64
+		received int64
+	}{
+		{"Measurements", 20, int64(s.Measurements)},
+		{"Names", 2, int64(s.Names)},
+		{"IndexEntries", 40, int64(s.IndexEntries)},
+		{"SaveBuffer", 20, int64(s.SaveBuffer)},
+		{"FileSize", 0, s.FileSize},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.expect != test.received {
+				t.Errorf("expected: %d, received %d", test.expect, test.received)
+			}
+		})
+	}
+
+	t.Run("Flushing updates FileSize and SaveBuffer", func(t *testing.T) {
+		err = db.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := db.Stats()
+		if s.SaveBuffer != 0 {
+			t.Errorf("expected: 0, received %d", s.SaveBuffer)
+		}
+
+		if s.FileSize == 0 {
+			t.Error("expected non-zero FileSize")
+		}
+	})
+}
+
+func TestJDB_BufferLen(t *testing.T) {
+	defer func(size int) {
+		jdb.FlushMaxSize = size
+	}(jdb.FlushMaxSize)
+
+	jdb.FlushMaxSize = 1_000
+
+	before := time.Now()
+
+	db, err := jdb.NewWithStore(jdb.NewMemoryStore(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened := db.LastFlush()
+	if opened.Before(before) {
+		t.Errorf("expected LastFlush to be no earlier than %s, received %s", before, opened)
+	}
+
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: before.Add(0 - time.Minute*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if l := db.BufferLen(); l != 10 {
+		t.Errorf("expected 10, received %d", l)
+	}
+
+	if !db.LastFlush().Equal(opened) {
+		t.Errorf("expected %s, received %s", opened, db.LastFlush())
+	}
+
+	err = db.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := db.BufferLen(); l != 0 {
+		t.Errorf("expected 0, received %d", l)
+	}
+
+	if !db.LastFlush().After(opened) {
+		t.Errorf("expected LastFlush to be after %s, received %s", opened, db.LastFlush())
+	}
+}
+
+func TestJDB_Path(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fileDB, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fileDB.Close()
+
+	err = fileDB.Insert(&jdb.Measurement{
+		Name: "wibbles",
+		Dimensions: map[string]float64{
+			"wobble_count": 17,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = fileDB.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memoryDB, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storeDB, err := jdb.NewWithStore(jdb.NewMemoryStore(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name       string
+		db         *jdb.JDB
+		expectPath string
+		expectSize int64
+	}{
+		{"Files return their path and size", fileDB, f.Name(), fi.Size()},
+		{"In-memory databases return nothing", memoryDB, "", 0},
+		{"Other stores return nothing", storeDB, "", 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if p := test.db.Path(); test.expectPath != p {
+				t.Errorf("expected %q, received %q", test.expectPath, p)
+			}
+
+			size, err := test.db.FileSize()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectSize != size {
+				t.Errorf("expected: %d, received %d", test.expectSize, size)
+			}
+		})
+	}
+}
+
+func TestJDB_UniqueCount(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c := db.UniqueCount(); c != 0 {
+		t.Errorf("expected 0, received %d", c)
+	}
+
+	now := time.Now()
+	for _, upsert := range []bool{false, true, true} {
+		for i := 0; i < 10; i++ {
+			fn := db.Insert
+			if upsert {
+				fn = db.Upsert
+			}
+
+			// Every Measurement has two ids, which mustn't be counted twice
+			err = fn(&jdb.Measurement{
+				Name: "wibbles",
+				When: now.Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"count": float64(i),
+				},
+				Indices: map[string]string{
+					"host":     "alpha",
+					"location": "kitchen",
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if c := db.UniqueCount(); c != 10 {
+		t.Errorf("expected 10, received %d", c)
+	}
+
+	if s := db.Stats(); s.Measurements != 30 {
+		t.Errorf("expected 30, received %d", s.Measurements)
+	}
+
+	// The count is tracked as ids change, and so must be kept in step by
+	// everything which changes them
+	for _, test := range []struct {
+		name   string
+		fn     func() error
+		expect int
+	}{
+		{"Compacting keeps every unique measurement", db.Compact, 10},
+		{"Renaming an index keeps every unique measurement", func() error { return db.RenameIndex("wibbles", "host", "hostname") }, 10},
+		{"Deleting by time range forgets deleted measurements", func() (err error) {
+			_, err = db.DeleteByTimeRange("wibbles", now.Add(0-time.Minute*2), now)
+
+			return
+		}, 7},
+		{"Deleting by predicate forgets deleted measurements", func() (err error) {
+			_, err = db.DeleteFunc("wibbles", func(m *jdb.Measurement) bool { return m.Dimensions["count"] == 9 })
+
+			return
+		}, 6},
+		{"Deleting a measurement forgets everything", func() error { return db.DeleteMeasurement("wibbles") }, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.fn()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c := db.UniqueCount(); c != test.expect {
+				t.Errorf("expected %d, received %d", test.expect, c)
+			}
+		})
+	}
+
+	t.Run("Evicted measurements are forgotten", func(t *testing.T) {
+		db, err := jdb.NewInMemory(jdb.WithMaxPointsPerIndex(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 10; i++ {
+			err = db.Insert(&jdb.Measurement{
+				Name:       "wibbles",
+				When:       now.Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{"count": float64(i)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if c := db.UniqueCount(); c != 5 {
+			t.Errorf("expected 5, received %d", c)
+		}
+	})
+}
+
+func TestJDB_Insert_FieldTypeConflicts(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		first  *jdb.Measurement
+		second *jdb.Measurement
+	}{
+		{
+			name: "Dimension then label",
+			first: &jdb.Measurement{
+				Dimensions: map[string]float64{"status": 1, "count": 1},
+			},
+			second: &jdb.Measurement{
+				Dimensions: map[string]float64{"count": 1},
+				Labels:     map[string]string{"status": "ok"},
+			},
+		},
+		{
+			name: "Index then dimension",
+			first: &jdb.Measurement{
+				Dimensions: map[string]float64{"count": 1},
+				Indices:    map[string]string{"status": "ok"},
+			},
+			second: &jdb.Measurement{
+				Dimensions: map[string]float64{"count": 1, "status": 1},
+			},
+		},
+		{
+			name: "Dimension then int dimension",
+			first: &jdb.Measurement{
+				Dimensions: map[string]float64{"count": 1},
+			},
+			second: &jdb.Measurement{
+				IntDimensions: map[string]int64{"count": 1},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Now()
+
+			test.first.Name, test.second.Name = "wibbles", "wibbles"
+			test.first.When, test.second.When = now.Add(0-time.Minute), now
+
+			t.Run("Insert", func(t *testing.T) {
+				db, err := jdb.NewInMemory()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = db.Insert(test.first)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = db.Insert(test.second)
+				if !errors.Is(err, jdb.ErrFieldTypeConflict) {
+					t.Errorf("expected jdb.ErrFieldTypeConflict, received %#v", err)
+				}
+
+				m, err := db.QueryAll("wibbles", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(m) != 1 {
+					t.Errorf("expected 1 measurement, received %d", len(m))
+				}
+			})
+
+			t.Run("InsertBatch", func(t *testing.T) {
+				db, err := jdb.NewInMemory()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = db.InsertBatch([]*jdb.Measurement{test.first, test.second})
+				if !errors.Is(err, jdb.ErrFieldTypeConflict) {
+					t.Errorf("expected jdb.ErrFieldTypeConflict, received %#v", err)
+				}
+
+				var batchErr *jdb.BatchError
+				if errors.As(err, &batchErr) && batchErr.Index != 1 {
+					t.Errorf("expected: 1, received %d", batchErr.Index)
+				}
+			})
+		})
+	}
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	logger, threshold := jdb.Logger, jdb.SlowQueryThreshold
+	defer func() {
+		jdb.Logger, jdb.SlowQueryThreshold = logger, threshold
+	}()
+
+	buf := new(bytes.Buffer)
+	jdb.Logger = slog.New(slog.NewTextHandler(buf, nil))
+
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Insert(&jdb.Measurement{
+		Name: "wibbles",
+		Dimensions: map[string]float64{
+			"wobble_count": 17,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name      string
+		threshold time.Duration
+		expectLog bool
+	}{
+		{"Zero threshold logs nothing", 0, false},
+		{"Large threshold logs nothing", time.Hour, false},
+		{"Exceeded threshold logs", time.Nanosecond, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			jdb.SlowQueryThreshold = test.threshold
+
+			for _, q := range []struct {
+				name string
+				fn   func() error
+			}{
+				{"QueryAll", func() (err error) { _, err = db.QueryAll("wibbles", nil); return }},
+				{"QueryAllIndex", func() (err error) {
+					_, err = db.QueryAllIndex("wibbles", jdb.DefaultIndexName, "wibbles", nil)
+					return
+				}},
+				{"WriteCSV", func() (err error) { _, err = db.QueryAllCSV("wibbles", nil); return }},
+			} {
+				buf.Reset()
+
+				err := q.fn()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				logged := strings.Contains(buf.String(), `msg="Slow query" query=`+q.name+" measurement=wibbles")
+				if test.expectLog != logged {
+					t.Errorf("%s: expected: %v, received %v: %s", q.name, test.expectLog, logged, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestNewWithStore_duplicates(t *testing.T) {
+	logger := jdb.Logger
+	defer func() {
+		jdb.Logger = logger
+	}()
+
+	buf := new(bytes.Buffer)
+	jdb.Logger = slog.New(slog.NewTextHandler(buf, nil))
+
+	// Build two databases which overlap, as if they had both been written
+	// to by mistake, each with a different value for the same Measurement
+	now := time.Now().Add(0 - time.Minute)
+	stores := make([][]byte, 0)
+
+	for i := 0; i < 2; i++ {
+		store := jdb.NewMemoryStore(nil)
+
+		db, err := jdb.NewWithStore(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for k := 0; k < 5; k++ {
+			err = db.Insert(&jdb.Measurement{
+				Name: "wibbles",
+				When: now.Add(0 - time.Minute*time.Duration(k+i*3)),
+				Dimensions: map[string]float64{
+					"wobble_count": float64(i),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stores = append(stores, store.Bytes())
+	}
+
+	for _, test := range []struct {
+		name             string
+		b                []byte
+		expectDuplicates int
+		expectCount      int
+	}{
+		{"Clean databases report nothing", stores[0], 0, 5},
+		{"Overlapping databases report duplicates", bytes.Join(stores, nil), 2, 8},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			buf.Reset()
+
+			db, err := jdb.NewWithStore(jdb.NewMemoryStore(test.b))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(buf.String(), fmt.Sprintf("duplicates=%d", test.expectDuplicates)) {
+				t.Errorf("expected %d duplicates to be logged, received %s", test.expectDuplicates, buf.String())
+			}
+
+			warned := strings.Contains(buf.String(), "level=WARN")
+			if warned != (test.expectDuplicates > 0) {
+				t.Errorf("expected: %v, received %v", test.expectDuplicates > 0, warned)
+			}
+
+			// Reporting duplicates mustn't change what's loaded
+			m, err := db.QueryAll("wibbles", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+		})
+	}
+}
+
+func TestJDB_QueryAllPaged(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	now := time.Now()
+	for i := 0; i < 34; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(0 - time.Minute*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		opts        *jdb.Options
+		expectCount int
+		expectTotal int
+		expectFirst float64
+		expectErr   bool
+	}{
+		{"Nil options returns everything", nil, 34, 34, 33, false},
+		{"The first page returns the earliest values", &jdb.Options{Limit: 10}, 10, 34, 33, false},
+		{"Later pages skip earlier values", &jdb.Options{Limit: 10, Offset: 10}, 10, 34, 23, false},
+		{"The last page may be short", &jdb.Options{Limit: 10, Offset: 30}, 4, 34, 3, false},
+		{"Totals respect time ranges", &jdb.Options{Limit: 2, Since: time.Minute*4 + time.Second*30}, 2, 5, 4, false},
+		{"Negative offsets fail", &jdb.Options{Offset: -1}, 0, 0, 0, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, total, err := db.QueryAllPaged("wibbles", test.opts)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+
+			if test.expectTotal != total {
+				t.Errorf("expected total %d, received %d", test.expectTotal, total)
+			}
+
+			if len(m) > 0 && test.expectFirst != m[0].Dimensions["wobble_count"] {
+				t.Errorf("expected: %v, received %v", test.expectFirst, m[0].Dimensions["wobble_count"])
+			}
+		})
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	now := time.Now()
+	low, high := 10.0, 30.0
+
+	for _, test := range []struct {
+		name      string
+		opts      jdb.Options
+		expectErr error
+	}{
+		{"Empty options are valid", jdb.Options{}, nil},
+		{"From before To is valid", jdb.Options{From: now.Add(0 - time.Hour), To: now}, nil},
+		{"From equal to To is valid", jdb.Options{From: now, To: now}, nil},
+		{"From without To is valid", jdb.Options{From: now.Add(time.Hour)}, nil},
+		{"From after To is invalid", jdb.Options{From: now, To: now.Add(0 - time.Hour)}, jdb.ErrInvalidOptions},
+		{"From after To is valid when Since is set", jdb.Options{From: now, To: now.Add(0 - time.Hour), Since: time.Minute}, nil},
+		{"Negative Since is invalid", jdb.Options{Since: 0 - time.Minute}, jdb.ErrInvalidOptions},
+		{"Negative Limit is invalid", jdb.Options{Limit: -1}, jdb.ErrInvalidOptions},
+		{"Negative Offset is invalid", jdb.Options{Offset: -1}, jdb.ErrInvalidOptions},
+		{"Keeping the earliest duplicate is valid", jdb.Options{DeduplicateKeep: jdb.KeepEarliest}, nil},
+		{"Unknown DeduplicateKeep is invalid", jdb.Options{DeduplicateKeep: -1}, jdb.ErrInvalidOptions},
+		{"Dimension filters with Min below Max are valid", jdb.Options{DimensionFilters: map[string]jdb.DimRange{"temperature": {Min: &low, Max: &high}}}, nil},
+		{"Dimension filters with Min above Max are invalid", jdb.Options{DimensionFilters: map[string]jdb.DimRange{"temperature": {Min: &high, Max: &low}}}, jdb.ErrInvalidOptions},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.opts.Validate()
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+		})
+	}
 }
@@ -0,0 +1,57 @@
+package jdb
+
+import (
+	"errors"
+)
+
+// ErrInvalidDedupeStrategy returns when WithDedupeKey is passed an unknown
+// DedupeStrategy
+var ErrInvalidDedupeStrategy = errors.New("invalid dedupe strategy")
+
+// DedupeStrategy controls which parts of a Measurement form the ids jdb uses
+// to deduplicate Measurements, and so what `Insert` considers a duplicate, and
+// what `Upsert` replaces.
+//
+// Every strategy includes the Measurement name and `When`.
+//
+// Ids are derived as a database is loaded, rather than being stored on disk, and
+// so the DedupeStrategy of a database may be changed between opens. Doing so changes
+// which Measurements already in the database are considered duplicates of one another,
+// however. Moving to a coarser strategy, such as from DedupePerIndex to DedupeTimestamp,
+// means Measurements which were previously distinct may now share an id; in this case
+// the Measurement which appears later in the database file is treated as an upsert of
+// the earlier, which is then dropped from deduplicated queries, and removed from disk
+// entirely by `Compact`. Moving to a finer strategy is always safe.
+type DedupeStrategy int
+
+const (
+	// DedupePerIndex derives an id for each index of a Measurement, such that
+	// a Measurement is a duplicate of another where any one index name and value
+	// matches. This is the default
+	DedupePerIndex DedupeStrategy = iota
+
+	// DedupeAllIndices derives a single id from every index of a Measurement,
+	// such that a Measurement is only a duplicate of another where every index
+	// name and value match.
+	//
+	// For Measurements with a single index, ids are identical to DedupePerIndex
+	DedupeAllIndices
+
+	// DedupeTimestamp derives a single id from the Measurement name and timestamp
+	// alone, ignoring indices, such that only one Measurement of a given name may
+	// exist at a given instant
+	DedupeTimestamp
+)
+
+// WithDedupeKey configures the DedupeStrategy a JDB uses to derive ids
+func WithDedupeKey(s DedupeStrategy) OpenOption {
+	return func(j *JDB) error {
+		if s < DedupePerIndex || s > DedupeTimestamp {
+			return ErrInvalidDedupeStrategy
+		}
+
+		j.dedupe = s
+
+		return nil
+	}
+}
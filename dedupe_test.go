@@ -0,0 +1,163 @@
+package jdb_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestWithDedupeKey(t *testing.T) {
+	t.Run("Invalid strategies fail", func(t *testing.T) {
+		_, err := jdb.NewInMemory(jdb.WithDedupeKey(jdb.DedupeStrategy(100)))
+		if !errors.Is(err, jdb.ErrInvalidDedupeStrategy) {
+			t.Errorf("expected: %v, received %#v", jdb.ErrInvalidDedupeStrategy, err)
+		}
+	})
+
+	now := time.Now().Add(0 - time.Hour)
+	original := map[string]string{"host": "a", "region": "eu"}
+
+	for _, test := range []struct {
+		name     string
+		strategy jdb.DedupeStrategy
+		indices  map[string]string
+		expect   error
+	}{
+		{"Per index, identical indices are duplicates", jdb.DedupePerIndex, map[string]string{"host": "a", "region": "eu"}, jdb.ErrDuplicateMeasurement},
+		{"Per index, sharing any one index is a duplicate", jdb.DedupePerIndex, map[string]string{"host": "b", "region": "eu"}, jdb.ErrDuplicateMeasurement},
+		{"Per index, distinct indices are not duplicates", jdb.DedupePerIndex, map[string]string{"host": "b", "region": "us"}, nil},
+		{"All indices, identical indices are duplicates", jdb.DedupeAllIndices, map[string]string{"host": "a", "region": "eu"}, jdb.ErrDuplicateMeasurement},
+		{"All indices, sharing one index is not a duplicate", jdb.DedupeAllIndices, map[string]string{"host": "b", "region": "eu"}, nil},
+		{"All indices, a subset of indices is not a duplicate", jdb.DedupeAllIndices, map[string]string{"host": "a"}, nil},
+		{"Timestamp, identical indices are duplicates", jdb.DedupeTimestamp, map[string]string{"host": "a", "region": "eu"}, jdb.ErrDuplicateMeasurement},
+		{"Timestamp, distinct indices are duplicates", jdb.DedupeTimestamp, map[string]string{"host": "b", "region": "us"}, jdb.ErrDuplicateMeasurement},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := jdb.NewInMemory(jdb.WithDedupeKey(test.strategy))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer db.Close()
+
+			err = db.Insert(&jdb.Measurement{
+				Name:       "environment",
+				When:       now,
+				Dimensions: map[string]float64{"temperature": 20},
+				Indices:    original,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := &jdb.Measurement{
+				Name:       "environment",
+				When:       now,
+				Dimensions: map[string]float64{"temperature": 21},
+				Indices:    test.indices,
+			}
+
+			err = db.Insert(m)
+			if !errors.Is(err, test.expect) {
+				t.Errorf("expected: %v, received %#v", test.expect, err)
+			}
+
+			// Measurements can always be found by the ids of the strategy
+			// they were inserted with
+			if err == nil {
+				for _, id := range m.IDs(test.strategy) {
+					found, ok := db.GetByID(id)
+					if !ok {
+						t.Fatalf("expected to find %q", id)
+					}
+
+					if found != m {
+						t.Errorf("expected: %#v, received %#v", m, found)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("All indices, values containing NUL bytes are rejected rather than colliding", func(t *testing.T) {
+		db, err := jdb.NewInMemory(jdb.WithDedupeKey(jdb.DedupeAllIndices))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		// Joined naively, both of these would produce the ID "x\x00\x00y"
+		for _, indices := range []map[string]string{
+			{"host": "x\x00", "region": "y"},
+			{"host": "x", "region": "\x00y"},
+		} {
+			err = db.Insert(&jdb.Measurement{
+				Name:       "environment",
+				When:       now,
+				Dimensions: map[string]float64{"temperature": 20},
+				Indices:    indices,
+			})
+			if !errors.Is(err, jdb.ErrInvalidIndexValue) {
+				t.Errorf("expected: %v, received %#v", jdb.ErrInvalidIndexValue, err)
+			}
+		}
+
+		if c := db.UniqueCount(); c != 0 {
+			t.Errorf("expected 0 measurements, received %d", c)
+		}
+	})
+
+	t.Run("Changing strategy between opens treats collisions as upserts", func(t *testing.T) {
+		f, err := os.CreateTemp("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		db, err := jdb.New(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, host := range []string{"a", "b"} {
+			err = db.Insert(&jdb.Measurement{
+				Name:       "environment",
+				When:       now,
+				Dimensions: map[string]float64{"temperature": float64(i)},
+				Indices:    map[string]string{"host": host},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = jdb.New(f.Name(), jdb.WithDedupeKey(jdb.DedupeTimestamp))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		m, err := db.QueryAll("environment", &jdb.Options{Deduplicate: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 1 {
+			t.Fatalf("expected %d measurements, received %d", 1, len(m))
+		}
+
+		if m[0].Dimensions["temperature"] != 1 {
+			t.Errorf("expected: %v, received %v", 1, m[0].Dimensions["temperature"])
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package jdb
+
+import (
+	"slices"
+	"time"
+)
+
+// DeleteByTimeRange removes all Measurements of a specific name whose timestamps fall
+// between from and to, inclusively, returning the number of Measurements removed.
+//
+// Measurements are removed from every in-memory structure, including the save buffer,
+// and so are immediately absent from queries.
+//
+// Because the database file is append-only, however, deleted Measurements remain on disk
+// until the next call to `Compact`; if the database is closed and reopened before then
+// the deleted Measurements will return.
+func (j *JDB) DeleteByTimeRange(name string, from, to time.Time) (deleted int, err error) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		err = ErrReadOnly
+
+		return
+	}
+
+	if _, ok := j.measurements[name]; !ok {
+		err = ErrNoSuchMeasurement
+
+		return
+	}
+
+	return j.deleteWhere(name, func(m *Measurement) bool {
+		return inRange(m.When, from, to)
+	}), nil
+}
+
+// DeleteByID removes a single Measurement by id, as returned by `Measurement.ID`,
+// returning whether the id existed.
+//
+// The Measurement is removed from every shard and index it sits in, and every one of
+// its ids is removed, such that it can't be found via any of its other indices either.
+// Where the Measurement has been upserted, any earlier versions are removed too.
+//
+// As per `DeleteByTimeRange`, deletions are only persisted to disk by `Compact`
+func (j *JDB) DeleteByID(id string) (deleted bool, err error) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		err = ErrReadOnly
+
+		return
+	}
+
+	m, ok := j.ids[id]
+	if !ok {
+		return
+	}
+
+	n := j.deleteWhere(m.Name, func(candidate *Measurement) bool {
+		return candidate == m || (candidate.When.Equal(m.When) && slices.Contains(candidate.ids(j.dedupe), id))
+	})
+
+	return n > 0, nil
+}
+
+// DeleteFunc removes every Measurement of a specific name for which pred returns true,
+// returning the number of Measurements removed.
+//
+// pred is called once for each Measurement, including those superseded by a later
+// Upsert, while the write lock is held; it must not modify the Measurement, nor call
+// back into the database.
+//
+// As per `DeleteByTimeRange`, deletions are only persisted to disk by `Compact`
+func (j *JDB) DeleteFunc(name string, pred func(*Measurement) bool) (deleted int, err error) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		err = ErrReadOnly
+
+		return
+	}
+
+	if _, ok := j.measurements[name]; !ok {
+		err = ErrNoSuchMeasurement
+
+		return
+	}
+
+	return j.deleteWhere(name, func(m *Measurement) bool {
+		return pred(expand(m))
+	}), nil
+}
+
+// DeleteMeasurement removes every Measurement of a specific name, along with its
+// indices, field types, and field metadata, returning ErrNoSuchMeasurement where no
+// Measurements of that name exist.
+//
+// Unlike the other Delete* functions, DeleteMeasurement persists the deletion straight
+// away; because the database file is append-only, it does so by compacting the
+// database, as per `Compact`, and so it can be slow for large databases.
+func (j *JDB) DeleteMeasurement(name string) (err error) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		return ErrReadOnly
+	}
+
+	shards, ok := j.measurements[name]
+	if !ok {
+		return ErrNoSuchMeasurement
+	}
+
+	deleted := make(map[*Measurement]bool)
+	for _, shard := range shards {
+		for _, m := range shard {
+			deleted[m] = true
+		}
+	}
+
+	j.removeMeasurements(name, deleted)
+
+	delete(j.measurements, name)
+	delete(j.indices, name)
+	delete(j.measurementFields, name)
+	delete(j.fieldMeta, name)
+
+	return j.compact()
+}
+
+// deleteWhere removes every Measurement of a specific name for which pred
+// returns true, returning the number of Measurements removed.
+//
+// Removal preserves the order of remaining Measurements, and so shards stay sorted.
+// Shards which end up empty are removed entirely.
+//
+// Callers must hold saveMutex
+func (j *JDB) deleteWhere(name string, pred func(*Measurement) bool) int {
+	deleted := make(map[*Measurement]bool)
+
+	for dts, shard := range j.measurements[name] {
+		shard = slices.DeleteFunc(shard, func(m *Measurement) bool {
+			if pred(m) {
+				deleted[m] = true
+			}
+
+			return deleted[m]
+		})
+
+		if len(shard) == 0 {
+			delete(j.measurements[name], dts)
+
+			continue
+		}
+
+		j.measurements[name][dts] = shard
+	}
+
+	if len(deleted) == 0 {
+		return 0
+	}
+
+	j.removeMeasurements(name, deleted)
+
+	return len(deleted)
+}
+
+// removeMeasurements removes a set of Measurements of a specific name from
+// j.indices, j.ids, and the save buffer.
+//
+// It does not touch j.measurements, which is handled separately by the caller, which
+// usually has to walk those shards anyway to find the Measurements to remove.
+//
+// Callers must hold saveMutex
+func (j *JDB) removeMeasurements(name string, deleted map[*Measurement]bool) {
+	isDeleted := func(m *Measurement) bool {
+		return deleted[m]
+	}
+
+	for _, values := range j.indices[name] {
+		for value, shards := range values {
+			for dts, shard := range shards {
+				shard = slices.DeleteFunc(shard, isDeleted)
+				if len(shard) == 0 {
+					delete(shards, dts)
+
+					continue
+				}
+
+				shards[dts] = shard
+			}
+
+			if len(shards) == 0 {
+				delete(values, value)
+			}
+		}
+	}
+
+	for m := range deleted {
+		for _, id := range m.ids(j.dedupe) {
+			if j.ids[id] == m {
+				delete(j.ids, id)
+			}
+		}
+	}
+
+	buffered := len(j.saveBuffer)
+
+	j.saveBuffer = slices.DeleteFunc(j.saveBuffer, isDeleted)
+	if len(j.saveBuffer) != buffered {
+		j.resetBuffered()
+	}
+}
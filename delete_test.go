@@ -0,0 +1,435 @@
+package jdb_test
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_DeleteByTimeRange(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(0 - time.Minute*time.Duration(i*30)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+			Indices: map[string]string{
+				"wibbler": "0xabadbabe",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name         string
+		measurement  string
+		from         time.Time
+		to           time.Time
+		expectDelete int
+		expectRemain int
+		expectErr    bool
+	}{
+		{"Unknown measurement fails", "zimzams", time.Time{}, now, 0, 10, true},
+		{"Empty range deletes nothing", "wibbles", now.Add(time.Hour), now.Add(time.Hour * 2), 0, 10, false},
+		{"Range deletes inclusively", "wibbles", now.Add(0 - time.Hour*2), now.Add(0 - time.Hour), 3, 7, false},
+		{"Range deletes whole shards", "wibbles", time.Time{}, now.Add(0 - time.Hour*2), 5, 2, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			deleted, err := db.DeleteByTimeRange(test.measurement, test.from, test.to)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectDelete != deleted {
+				t.Errorf("expected %d deletions, received %d", test.expectDelete, deleted)
+			}
+
+			for _, q := range []func() ([]*jdb.Measurement, error){
+				func() ([]*jdb.Measurement, error) { return db.QueryAll("wibbles", nil) },
+				func() ([]*jdb.Measurement, error) { return db.QueryAllIndex("wibbles", "wibbler", "0xabadbabe", nil) },
+			} {
+				m, err := q()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if test.expectRemain != len(m) {
+					t.Errorf("expected %d measurements, received %d", test.expectRemain, len(m))
+				}
+
+				sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
+					return a.When.Compare(b.When)
+				})
+
+				if !sorted {
+					t.Error("Results are not sorted")
+				}
+			}
+		})
+	}
+
+	t.Run("Deleted measurements can be reinserted", func(t *testing.T) {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(0 - time.Hour),
+			Dimensions: map[string]float64{
+				"wobble_count": 0,
+			},
+			Indices: map[string]string{
+				"wibbler": "0xabadbabe",
+			},
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Deletions survive compaction and reopening", func(t *testing.T) {
+		err = db.Compact()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = jdb.New(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		m, err := db.QueryAll("wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 3 {
+			t.Errorf("expected 3 measurements, received %d", len(m))
+		}
+	})
+}
+
+func TestJDB_DeleteByID(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	measurements := make([]*jdb.Measurement, 0)
+
+	for i := 0; i < 10; i++ {
+		m := &jdb.Measurement{
+			Name: "environment",
+			When: now.Add(0 - time.Minute*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"temperature": float64(i),
+			},
+			Indices: map[string]string{
+				"location": "kitchen",
+				"sensor":   "RP2040",
+			},
+		}
+
+		err = db.Insert(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		measurements = append(measurements, m)
+	}
+
+	// Upsert a replacement for the fifth measurement, so that both versions
+	// need deleting
+	replacement := *measurements[4]
+	replacement.Dimensions = map[string]float64{"temperature": 100}
+
+	err = db.Upsert(&replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name         string
+		id           string
+		expect       bool
+		expectRemain int
+	}{
+		{"Unknown ids delete nothing", "wibbles", false, 11},
+		{"Deleting by id removes the Measurement", measurements[0].ID("location"), true, 10},
+		{"Deleting removes every id", measurements[0].ID("sensor"), false, 10},
+		{"Deleting removes upserted versions", measurements[4].ID("sensor"), true, 8},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			deleted, err := db.DeleteByID(test.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expect != deleted {
+				t.Errorf("expected: %v, received %v", test.expect, deleted)
+			}
+
+			for _, q := range []func() ([]*jdb.Measurement, error){
+				func() ([]*jdb.Measurement, error) { return db.QueryAll("environment", nil) },
+				func() ([]*jdb.Measurement, error) { return db.QueryAllIndex("environment", "location", "kitchen", nil) },
+				func() ([]*jdb.Measurement, error) { return db.QueryAllIndex("environment", "sensor", "RP2040", nil) },
+			} {
+				m, err := q()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if test.expectRemain != len(m) {
+					t.Errorf("expected %d measurements, received %d", test.expectRemain, len(m))
+				}
+
+				sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
+					return a.When.Compare(b.When)
+				})
+
+				if !sorted {
+					t.Error("Results are not sorted")
+				}
+			}
+		})
+	}
+
+	t.Run("Deletions survive compaction and reopening", func(t *testing.T) {
+		err = db.Compact()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = jdb.New(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		m, err := db.QueryAll("environment", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 8 {
+			t.Errorf("expected 8 measurements, received %d", len(m))
+		}
+
+		for _, id := range []string{measurements[0].ID("location"), measurements[4].ID("location")} {
+			if _, ok := db.GetByID(id); ok {
+				t.Errorf("expected %q to be deleted", id)
+			}
+		}
+	})
+}
+
+func TestJDB_DeleteMeasurement(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	ids := make([]string, 0)
+
+	for _, name := range []string{"environment", "wibbles"} {
+		for i := 0; i < 10; i++ {
+			m := &jdb.Measurement{
+				Name: name,
+				When: now.Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"temperature": float64(i),
+				},
+				Indices: map[string]string{
+					"location": "kitchen",
+				},
+			}
+
+			err = db.Insert(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if name == "environment" {
+				ids = append(ids, m.ID("location"))
+			}
+		}
+	}
+
+	err = db.DeleteMeasurement("zimzams")
+	if !errors.Is(err, jdb.ErrNoSuchMeasurement) {
+		t.Errorf("expected %#v, received %#v", jdb.ErrNoSuchMeasurement, err)
+	}
+
+	err = db.DeleteMeasurement("environment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Close without flushing anything else, so that the deletion must have
+	// been persisted by DeleteMeasurement itself
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for _, test := range []struct {
+		name        string
+		expectCount int
+		expectErr   error
+	}{
+		{"environment", 0, jdb.ErrNoSuchMeasurement},
+		{"wibbles", 10, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := db.QueryFieldTypes(test.name)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			m, err := db.QueryAllIndex(test.name, "location", "kitchen", nil)
+			if err != nil && test.expectCount > 0 {
+				t.Fatal(err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+		})
+	}
+
+	for _, id := range ids {
+		if _, ok := db.GetByID(id); ok {
+			t.Errorf("expected %q to be deleted", id)
+		}
+	}
+}
+
+func TestJDB_DeleteFunc(t *testing.T) {
+	db, err := jdb.NewInMemory(jdb.WithFloat32Dimensions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(0 - time.Minute*time.Duration(i*30)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i),
+			},
+			Indices: map[string]string{
+				"wibbler": "0xabadbabe",
+			},
+			Labels: map[string]string{
+				"parity": []string{"even", "odd"}[i%2],
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name         string
+		measurement  string
+		pred         func(*jdb.Measurement) bool
+		expectDelete int
+		expectRemain int
+		expectErr    error
+	}{
+		{"Unknown measurement fails", "zimzams", func(*jdb.Measurement) bool { return true }, 0, 10, jdb.ErrNoSuchMeasurement},
+		{"Matching nothing deletes nothing", "wibbles", func(*jdb.Measurement) bool { return false }, 0, 10, nil},
+		{"Labels can be matched", "wibbles", func(m *jdb.Measurement) bool { return m.Labels["parity"] == "odd" }, 5, 5, nil},
+		{"Dimensions can be matched", "wibbles", func(m *jdb.Measurement) bool { return m.Dimensions["wobble_count"] >= 6 }, 2, 3, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			deleted, err := db.DeleteFunc(test.measurement, test.pred)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectDelete != deleted {
+				t.Errorf("expected %d deletions, received %d", test.expectDelete, deleted)
+			}
+
+			for _, q := range []func() ([]*jdb.Measurement, error){
+				func() ([]*jdb.Measurement, error) { return db.QueryAll("wibbles", nil) },
+				func() ([]*jdb.Measurement, error) { return db.QueryAllIndex("wibbles", "wibbler", "0xabadbabe", nil) },
+			} {
+				m, err := q()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if test.expectRemain != len(m) {
+					t.Errorf("expected %d measurements, received %d", test.expectRemain, len(m))
+				}
+
+				sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
+					return a.When.Compare(b.When)
+				})
+
+				if !sorted {
+					t.Error("Results are not sorted")
+				}
+
+				for _, m := range m {
+					if _, ok := db.GetByID(m.ID("wibbler")); !ok {
+						t.Errorf("expected %q to exist", m.ID("wibbler"))
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package jdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// headerPrefix marks the first line of a database file as a header, rather
+// than a Measurement.
+//
+// Because Measurements are base64 encoded, and '#' doesn't exist in the base64
+// alphabet, there's no way for a Measurement to be mistaken for a header
+const headerPrefix = '#'
+
+// ErrPlainJSONConflict returns when WithPlainJSON is combined with WithCodec or
+// WithEncryptionKey, both of which produce binary data which can't be stored as
+// plain json
+var ErrPlainJSONConflict = errors.New("plain json cannot be used with a codec or encryption")
+
+// isHeader returns true when a line from a database file is a header
+func isHeader(line []byte) bool {
+	return len(line) > 0 && line[0] == headerPrefix
+}
+
+// isPlainJSON returns true when a line from a database file, or the field
+// metadata within it, is raw json rather than base64.
+//
+// As with headers, '{' isn't in the base64 alphabet, and so base64 lines can't be
+// mistaken for json
+func isPlainJSON(line []byte) bool {
+	if isFieldMetadata(line) {
+		line = line[1:]
+	}
+
+	return len(line) > 0 && line[0] == '{'
+}
+
+// WithPlainJSON configures a JDB to write each Measurement to its database file as
+// a line of raw json, rather than base64 encoded json, which makes files easier to
+// inspect and roughly a third smaller.
+//
+// As with WithCodec, this only affects newly created database files; New detects
+// which format an existing file was written in and carries on writing in that format,
+// regardless of this option. Plain json can't be compressed or encrypted, and so
+// combining this option with WithCodec or WithEncryptionKey returns ErrPlainJSONConflict
+func WithPlainJSON() OpenOption {
+	return func(j *JDB) error {
+		j.plainJSON = true
+
+		return nil
+	}
+}
+
+// Decode reads a database file from r, returning every Measurement it contains in
+// file order, without building any of the indices a JDB would. This is useful for
+// tooling, such as migration scripts, which only need the raw Measurements.
+//
+// The Codec a file was written with is detected from its header, and so the only
+// OpenOption Decode needs is `WithEncryptionKey`, for encrypted files.
+//
+// Measurements are returned exactly as stored, and so may include several versions
+// of a Measurement created by `Upsert`
+func Decode(r io.Reader, opts ...OpenOption) (m []*Measurement, err error) {
+	j, err := newJDB(opts)
+	if err != nil {
+		return
+	}
+
+	m = make([]*Measurement, 0)
+	_, err = j.scan(r, func(measurement *Measurement) error {
+		m = append(m, measurement)
+
+		return nil
+	})
+
+	return
+}
+
+// Encode is the inverse of `Decode`, and writes ms to w in the same format as
+// a database file, such that the output can be opened with `New`.
+//
+// Where opts configure a Codec or encryption, Encode writes a header describing
+// them, followed by the Measurements; this is the same format `New` and flushes use.
+//
+// Encode doesn't validate or deduplicate ms, and so callers writing Measurements
+// from elsewhere should call `Measurement.Validate` on each first
+func Encode(w io.Writer, ms []*Measurement, opts ...OpenOption) (err error) {
+	j, err := newJDB(opts)
+	if err != nil {
+		return
+	}
+
+	err = j.writeHeader(w)
+	if err != nil {
+		return
+	}
+
+	for _, m := range ms {
+		err = j.writeMeasurement(w, m)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// scan reads a database file from r, calling fn for each Measurement in turn.
+//
+// As it goes, scan parses the file header (if there is one) and configures this JDB
+// accordingly. scan returns empty as true when r contains no data at all, which is
+// to say when r is a brand new database
+func (j *JDB) scan(r io.Reader, fn func(*Measurement) error) (empty bool, err error) {
+	empty = true
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		// The first line of the file may be a header, which tells us which
+		// Codec the file was written with
+		if empty {
+			empty = false
+
+			// Files are written entirely in one format, and so the first
+			// line tells us whether to expect (and write) plain json
+			j.plainJSON = isPlainJSON(line)
+
+			if isHeader(line) {
+				err = j.readHeader(line)
+				if err != nil {
+					return
+				}
+
+				continue
+			}
+
+			// The file has data, but no header; it was written without a Codec
+			err = j.readHeader(nil)
+			if err != nil {
+				return
+			}
+		}
+
+		if isFieldMetadata(line) {
+			err = j.readFieldMetadata(line)
+			if err != nil {
+				return
+			}
+
+			continue
+		}
+
+		var m *Measurement
+
+		m, err = j.decodeMeasurement(line)
+		if err != nil {
+			return
+		}
+
+		err = fn(m)
+		if err != nil {
+			return
+		}
+	}
+
+	err = scanner.Err()
+
+	return
+}
+
+// readHeader parses a header line, configuring this JDB to match the format the
+// file was written in. A nil header means the file was written without a header.
+//
+// Headers take the form '#', followed by the ID of the file's Codec (or 0x00 where
+// there is no Codec), followed by any flags, such as headerEncrypted.
+//
+// Where the JDB has been configured with a Codec which doesn't match the file, readHeader
+// returns ErrCodecMismatch. Similarly, where encryption doesn't match, readHeader returns
+// either ErrEncryptionKeyRequired or ErrNotEncrypted
+func (j *JDB) readHeader(line []byte) (err error) {
+	var c Codec
+
+	if len(line) > 1 && line[1] != 0 {
+		c, err = lookupCodec(line[1])
+		if err != nil {
+			return
+		}
+	}
+
+	if j.codec != nil && (c == nil || c.ID() != j.codec.ID()) {
+		return ErrCodecMismatch
+	}
+
+	j.codec = c
+
+	encrypted := len(line) > 2 && bytes.IndexByte(line[2:], headerEncrypted) >= 0
+
+	switch {
+	case encrypted && j.aead == nil:
+		return ErrEncryptionKeyRequired
+
+	case !encrypted && j.aead != nil:
+		return ErrNotEncrypted
+	}
+
+	return
+}
+
+// writeHeader writes a header line to w, describing the format this
+// JDB writes Measurements in.
+//
+// JDBs without a Codec or encryption don't need a header, and so writeHeader is
+// a no-op, keeping files compatible with older versions of jdb
+func (j *JDB) writeHeader(w io.Writer) (err error) {
+	if j.codec == nil && j.aead == nil {
+		return
+	}
+
+	header := []byte{headerPrefix, 0}
+	if j.codec != nil {
+		header[1] = j.codec.ID()
+	}
+
+	if j.aead != nil {
+		header = append(header, headerEncrypted)
+	}
+
+	_, err = w.Write(append(header, '\n'))
+
+	return
+}
+
+// writeMeasurement writes a Measurement to w in our on-disk format; namely
+// a line of base64 encoded json, compressed by our Codec if we have one, and
+// encrypted if we have a key, or a line of raw json where plainJSON is set
+func (j *JDB) writeMeasurement(w io.Writer, m *Measurement) (err error) {
+	buf := new(bytes.Buffer)
+	err = json.NewEncoder(buf).Encode(*expand(m))
+	if err != nil {
+		return
+	}
+
+	line, err := j.encodeLine(buf.Bytes())
+	if err != nil {
+		return
+	}
+
+	_, err = w.Write(line)
+
+	return
+}
+
+// encodeLine compresses, encrypts, and base64 encodes b, as configured,
+// returning a newline terminated line ready to be written to disk.
+//
+// Where plainJSON is set, b is written as-is
+func (j *JDB) encodeLine(b []byte) (line []byte, err error) {
+	if j.plainJSON {
+		return append(bytes.TrimSuffix(b, []byte{'\n'}), '\n'), nil
+	}
+
+	if j.codec != nil {
+		b = j.codec.Compress(b)
+	}
+
+	if j.aead != nil {
+		b, err = j.encrypt(b)
+		if err != nil {
+			return
+		}
+	}
+
+	line = make([]byte, base64.StdEncoding.EncodedLen(len(b)), base64.StdEncoding.EncodedLen(len(b))+1)
+	base64.StdEncoding.Encode(line, b)
+
+	return append(line, '\n'), nil
+}
+
+// decodeMeasurement is the inverse of writeMeasurement, and parses a
+// single line from a database file into a Measurement
+func (j *JDB) decodeMeasurement(line []byte) (m *Measurement, err error) {
+	b, err := j.decodeLine(line)
+	if err != nil {
+		return
+	}
+
+	// Parse string as json
+	m = new(Measurement)
+	err = json.NewDecoder(bytes.NewBuffer(b)).Decode(m)
+
+	return
+}
+
+// decodeLine is the inverse of encodeLine, and returns the raw contents
+// of a single line from a database file
+func (j *JDB) decodeLine(line []byte) (b []byte, err error) {
+	if j.plainJSON {
+		return line, nil
+	}
+
+	// Decode base64 to string
+	b = make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(b, line)
+	if err != nil {
+		return
+	}
+
+	b = b[:n]
+	if j.aead != nil {
+		b, err = j.decrypt(b)
+		if err != nil {
+			return
+		}
+	}
+
+	if j.codec != nil {
+		b, err = j.codec.Decompress(b)
+	}
+
+	return
+}
@@ -0,0 +1,333 @@
+package jdb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestEncode(t *testing.T) {
+	now := time.Now().Add(0 - time.Hour).Round(0)
+
+	ms := make([]*jdb.Measurement, 0)
+	for i := 0; i < 10; i++ {
+		m := &jdb.Measurement{
+			Name:       "wibbles",
+			When:       now.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+		}
+
+		err := m.Validate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ms = append(ms, m)
+	}
+
+	key := bytes.Repeat([]byte{'k'}, 32)
+
+	for _, test := range []struct {
+		name string
+		opts []jdb.OpenOption
+	}{
+		{"No options", nil},
+		{"With a codec", []jdb.OpenOption{jdb.WithCodec(jdb.GzipCodec)}},
+		{"With encryption", []jdb.OpenOption{jdb.WithEncryptionKey(key)}},
+		{"With plain json", []jdb.OpenOption{jdb.WithPlainJSON()}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+
+			err := jdb.Encode(buf, ms, test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Run("Decoding returns the same measurements", func(t *testing.T) {
+				decoded, err := jdb.Decode(bytes.NewReader(buf.Bytes()), test.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(decoded) != len(ms) {
+					t.Fatalf("expected %d measurements, received %d", len(ms), len(decoded))
+				}
+
+				for i := range ms {
+					if !decoded[i].When.Equal(ms[i].When) || decoded[i].Dimensions["wobble_count"] != ms[i].Dimensions["wobble_count"] {
+						t.Errorf("expected: %#v, received %#v", ms[i], decoded[i])
+					}
+				}
+			})
+
+			t.Run("Output can be opened as a database", func(t *testing.T) {
+				f, err := os.CreateTemp("", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = f.Write(buf.Bytes())
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.Close()
+
+				db, err := jdb.New(f.Name(), test.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				defer db.Close()
+
+				m, err := db.QueryAll("wibbles", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(m) != len(ms) {
+					t.Errorf("expected %d measurements, received %d", len(ms), len(m))
+				}
+			})
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name(), jdb.WithCodec(jdb.ZstdCodec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       time.Now().Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Codecs are detected from the header", func(t *testing.T) {
+		r, err := os.Open(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer r.Close()
+
+		m, err := jdb.Decode(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 5 {
+			t.Errorf("expected %d measurements, received %d", 5, len(m))
+		}
+	})
+
+	t.Run("Invalid data fails", func(t *testing.T) {
+		_, err := jdb.Decode(bytes.NewBufferString("this is not a database\n"))
+		if err == nil {
+			t.Error("expected error, received none")
+		}
+	})
+
+	t.Run("Encrypted data without a key fails", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+
+		err := jdb.Encode(buf, nil, jdb.WithEncryptionKey(bytes.Repeat([]byte{'k'}, 32)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = jdb.Decode(buf)
+		if !errors.Is(err, jdb.ErrEncryptionKeyRequired) {
+			t.Errorf("expected: %v, received %#v", jdb.ErrEncryptionKeyRequired, err)
+		}
+	})
+}
+
+func TestWithPlainJSON(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	// insert opens the database at f, inserts count Measurements after
+	// those inserted previously, and closes it again
+	inserted := 0
+	insert := func(t *testing.T, count int, opts ...jdb.OpenOption) {
+		t.Helper()
+
+		db, err := jdb.New(f.Name(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < count; i++ {
+			err = db.Insert(&jdb.Measurement{
+				Name: "wibbles",
+				When: start.Add(time.Minute * time.Duration(inserted)),
+				Dimensions: map[string]float64{
+					"wobble_count": float64(inserted),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			inserted++
+		}
+
+		err = db.SetFieldMetadata("wibbles", "wobble_count", jdb.FieldMeta{Unit: "wobbles"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	insert(t, 5, jdb.WithPlainJSON())
+
+	// Reopening without WithPlainJSON should carry on writing plain json
+	insert(t, 5)
+
+	t.Run("Every line is plain json", func(t *testing.T) {
+		b, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := bytes.Split(bytes.TrimSpace(b), []byte{'\n'})
+		for _, line := range lines {
+			line = bytes.TrimPrefix(line, []byte{'@'})
+
+			if !json.Valid(line) {
+				t.Errorf("expected json, received %q", line)
+			}
+		}
+
+		if len(lines) != 12 {
+			t.Errorf("expected 12 lines, received %d", len(lines))
+		}
+	})
+
+	t.Run("Plain json databases load", func(t *testing.T) {
+		db, err := jdb.New(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		m, err := db.QueryAll("wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 10 {
+			t.Errorf("expected 10 measurements, received %d", len(m))
+		}
+
+		meta, err := db.FieldMetadata("wibbles", "wobble_count")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if meta.Unit != "wobbles" {
+			t.Errorf("expected: %q, received %#v", "wobbles", meta)
+		}
+	})
+
+	t.Run("Plain json databases can't be opened with a codec", func(t *testing.T) {
+		_, err := jdb.New(f.Name(), jdb.WithCodec(jdb.GzipCodec))
+		if !errors.Is(err, jdb.ErrCodecMismatch) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrCodecMismatch, err)
+		}
+	})
+
+	t.Run("Plain json can't be combined with a codec", func(t *testing.T) {
+		_, err := jdb.NewInMemory(jdb.WithPlainJSON(), jdb.WithCodec(jdb.GzipCodec))
+		if !errors.Is(err, jdb.ErrPlainJSONConflict) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrPlainJSONConflict, err)
+		}
+	})
+
+	t.Run("Existing base64 databases remain base64", func(t *testing.T) {
+		b, err := os.ReadFile("testdata/valid.db")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.CreateTemp("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = f.Write(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		db, err := jdb.New(f.Name(), jdb.WithPlainJSON())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start,
+			Dimensions: map[string]float64{"wobble_count": 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bytes.Contains(after, []byte{'{'}) {
+			t.Errorf("expected base64 only, received %q", after[len(b):])
+		}
+
+		db, err = jdb.New(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	})
+}
@@ -0,0 +1,79 @@
+package jdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// headerEncrypted is set in the flags of a database header when the file
+// is encrypted
+const headerEncrypted = 'e'
+
+var (
+	// ErrEncryptionKeyRequired returns when opening an encrypted database
+	// without WithEncryptionKey
+	ErrEncryptionKeyRequired = errors.New("database file is encrypted, but no encryption key was provided")
+
+	// ErrNotEncrypted returns when New is passed WithEncryptionKey for an existing
+	// database file which was written without encryption.
+	//
+	// As with Codecs, encryption is set when the file is created
+	ErrNotEncrypted = errors.New("database file is not encrypted")
+
+	// ErrDecryptionFailed returns when a line from a database file can't be decrypted,
+	// which almost always means the wrong key has been passed to WithEncryptionKey
+	ErrDecryptionFailed = errors.New("unable to decrypt database file; is the encryption key correct?")
+)
+
+// WithEncryptionKey configures a JDB to encrypt its database file with AES-GCM,
+// using key, which must be 16, 24, or 32 bytes long to select AES-128, AES-192,
+// or AES-256 respectively.
+//
+// Each line is encrypted individually, with its own random nonce prepended to the
+// ciphertext, which keeps the database file append-only. Where a Codec is also
+// configured, lines are compressed before they're encrypted.
+//
+// As with WithCodec, this only affects newly created database files; existing files
+// which aren't encrypted cause New to return ErrNotEncrypted, and encrypted files
+// opened with the wrong key cause New to return ErrDecryptionFailed
+func WithEncryptionKey(key []byte) OpenOption {
+	return func(j *JDB) (err error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return fmt.Errorf("invalid encryption key: %w", err)
+		}
+
+		j.aead, err = cipher.NewGCM(block)
+
+		return
+	}
+}
+
+// encrypt seals b, prepending the nonce it was sealed with
+func (j *JDB) encrypt(b []byte) (out []byte, err error) {
+	nonce := make([]byte, j.aead.NonceSize(), j.aead.NonceSize()+len(b)+j.aead.Overhead())
+
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return
+	}
+
+	return j.aead.Seal(nonce, nonce, b, nil), nil
+}
+
+// decrypt reverses encrypt
+func (j *JDB) decrypt(b []byte) (out []byte, err error) {
+	if len(b) < j.aead.NonceSize() {
+		return nil, ErrDecryptionFailed
+	}
+
+	out, err = j.aead.Open(nil, b[:j.aead.NonceSize()], b[j.aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return
+}
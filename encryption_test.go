@@ -0,0 +1,113 @@
+package jdb_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestWithEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 32)
+
+	for _, test := range []struct {
+		name string
+		opts []jdb.OpenOption
+	}{
+		{"Encryption alone", []jdb.OpenOption{jdb.WithEncryptionKey(key)}},
+		{"Encryption with a codec", []jdb.OpenOption{jdb.WithEncryptionKey(key), jdb.WithCodec(jdb.GzipCodec)}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := os.CreateTemp("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			db, err := jdb.New(f.Name(), test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 10; i++ {
+				err = db.Insert(&jdb.Measurement{
+					Name: "wibbles",
+					When: time.Now().Add(0 - time.Minute*time.Duration(i)),
+					Dimensions: map[string]float64{
+						"wobble_count": float64(i * 17),
+					},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = db.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Run("Plaintext is not written to disk", func(t *testing.T) {
+				b, err := os.ReadFile(f.Name())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// eyJ3aGVu is the base64 encoding of `{"when`, which starts
+				// every unencrypted, uncompressed, line
+				if bytes.Contains(b, []byte("eyJ3aGVu")) {
+					t.Error("expected database file to be encrypted")
+				}
+			})
+
+			t.Run("Reopening with the same key succeeds", func(t *testing.T) {
+				db, err := jdb.New(f.Name(), test.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				defer db.Close()
+
+				m, err := db.QueryAll("wibbles", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(m) != 10 {
+					t.Errorf("expected 10 measurements, received %d", len(m))
+				}
+			})
+
+			t.Run("Reopening without a key fails", func(t *testing.T) {
+				_, err := jdb.New(f.Name())
+				if !errors.Is(err, jdb.ErrEncryptionKeyRequired) {
+					t.Errorf("expected jdb.ErrEncryptionKeyRequired, received %#v", err)
+				}
+			})
+
+			t.Run("Reopening with the wrong key fails", func(t *testing.T) {
+				_, err := jdb.New(f.Name(), jdb.WithEncryptionKey(bytes.Repeat([]byte{0xcd}, 32)))
+				if !errors.Is(err, jdb.ErrDecryptionFailed) {
+					t.Errorf("expected jdb.ErrDecryptionFailed, received %#v", err)
+				}
+			})
+		})
+	}
+
+	t.Run("Invalid keys fail", func(t *testing.T) {
+		_, err := jdb.NewInMemory(jdb.WithEncryptionKey([]byte("too short")))
+		if err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("Encrypting an existing database fails", func(t *testing.T) {
+		_, err := jdb.New("testdata/valid.db", jdb.WithEncryptionKey(key))
+		if !errors.Is(err, jdb.ErrNotEncrypted) {
+			t.Errorf("expected jdb.ErrNotEncrypted, received %#v", err)
+		}
+	})
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"math"
 	"os"
 	"time"
 
@@ -22,7 +21,7 @@ func main() {
 
 	// Effectively disable flushing to disk for the sake of
 	// timeliness in this test
-	jdb.FlushMaxSize = int(math.Inf(1))
+	jdb.FlushMaxSize = 1_000_000
 	jdb.FlushMaxDuration = 1<<63 - 1
 
 	database, err := jdb.New(f.Name())
@@ -33,12 +32,11 @@ func main() {
 	defer database.Close()
 
 	t := time.Time{}
+	batch := make([]*jdb.Measurement, 0, 10_000)
 	for i := 0; i < 10_000; i++ {
-		fmt.Printf("%d/10_000\r", i+1)
-
 		t = t.Add(time.Minute)
 
-		m := &jdb.Measurement{
+		batch = append(batch, &jdb.Measurement{
 			When: t,
 			Name: "environmental_monitoring",
 			Dimensions: map[string]float64{
@@ -53,20 +51,16 @@ func main() {
 			Indices: map[string]string{
 				"location": "living room",
 			},
-		}
-
-		err = m.Validate()
-		if err != nil {
-			panic(err)
-		}
-
-		err = database.Insert(m)
-		if err != nil {
-			panic(err)
-		}
+		})
 	}
 
-	fmt.Println()
+	// Insert everything in one go; this validates every Measurement,
+	// takes the write lock once, and sorts each shard once, which is
+	// much quicker than inserting Measurements one by one
+	err = database.InsertBatch(batch)
+	if err != nil {
+		panic(err)
+	}
 
 	// Query an empty index
 	measurements, err := database.QueryAllIndex("environmental_monitoring", "location", "bedroom", nil)
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"math"
 	"os"
 
 	"github.com/jspc/jdb"
@@ -21,7 +20,7 @@ func main() {
 
 	// Effectively disable flushing to disk for the sake of
 	// timeliness in this test
-	jdb.FlushMaxSize = int(math.Inf(1))
+	jdb.FlushMaxSize = 1_000_000
 	jdb.FlushMaxDuration = 1<<63 - 1
 
 	database, err := jdb.New(f.Name())
@@ -0,0 +1,207 @@
+package jdb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestWithFloat32Dimensions(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name(), jdb.WithFloat32Dimensions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 0.1 can't be represented exactly by either float type, and so
+	// makes precision loss obvious
+	const (
+		original = 0.1
+		reduced  = float64(float32(original))
+	)
+
+	now := time.Now().Add(0 - time.Hour)
+
+	inserted := &jdb.Measurement{
+		Name:          "environment",
+		When:          now,
+		Dimensions:    map[string]float64{"temperature": original},
+		IntDimensions: map[string]int64{"uptime": 1<<53 + 1},
+		Indices:       map[string]string{"location": "kitchen"},
+	}
+
+	err = db.Insert(inserted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.InsertBatch([]*jdb.Measurement{{
+		Name:       "environment",
+		When:       now.Add(time.Minute),
+		Dimensions: map[string]float64{"temperature": original},
+		Indices:    map[string]string{"location": "kitchen"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Inserted measurements are untouched", func(t *testing.T) {
+		if inserted.Dimensions["temperature"] != original {
+			t.Errorf("expected: %v, received %v", original, inserted.Dimensions["temperature"])
+		}
+	})
+
+	for _, test := range []struct {
+		name   string
+		reopen bool
+	}{
+		{"Queries return reduced precision values", false},
+		{"Reduced precision values are persisted", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.reopen {
+				err := db.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				db, err = jdb.New(f.Name(), jdb.WithFloat32Dimensions())
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m, err := db.QueryAll("environment", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m) != 2 {
+				t.Fatalf("expected %d measurements, received %d", 2, len(m))
+			}
+
+			for _, measurement := range m {
+				if measurement.Dimensions["temperature"] != reduced {
+					t.Errorf("expected: %v, received %v", reduced, measurement.Dimensions["temperature"])
+				}
+			}
+
+			if m[0].IntDimensions["uptime"] != 1<<53+1 {
+				t.Errorf("expected: %v, received %v", 1<<53+1, m[0].IntDimensions["uptime"])
+			}
+
+			latest, err := db.QueryLatest("environment", "location")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if latest["kitchen"].Dimensions["temperature"] != reduced {
+				t.Errorf("expected: %v, received %v", reduced, latest["kitchen"].Dimensions["temperature"])
+			}
+		})
+	}
+
+	t.Run("CSV and JSON output agree", func(t *testing.T) {
+		b, err := db.QueryAllCSV("environment", &jdb.Options{CSV: jdb.CSVOptions{OmitLabels: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := db.QueryAll("environment", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		j, err := json.Marshal(m[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := "0.10000000149011612"
+		if !strings.Contains(string(b), expect) {
+			t.Errorf("expected CSV to contain %q, received %q", expect, string(b))
+		}
+
+		if !bytes.Contains(j, []byte(expect)) {
+			t.Errorf("expected JSON to contain %q, received %q", expect, string(j))
+		}
+	})
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkWithFloat32Dimensions(b *testing.B) {
+	for _, test := range []struct {
+		name string
+		opts []jdb.OpenOption
+	}{
+		{"float64", nil},
+		{"float32", []jdb.OpenOption{jdb.WithFloat32Dimensions()}},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			var heap int64
+
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				// As per the load_100k_measurements example
+				batch := make([]*jdb.Measurement, 0, 100_000)
+				for k := 0; k < cap(batch); k++ {
+					batch = append(batch, &jdb.Measurement{
+						When: time.Time{}.Add(time.Minute * time.Duration(k+1)),
+						Name: "environmental_monitoring",
+						Dimensions: map[string]float64{
+							"Temperature": 19.23,
+							"Humidity":    52.43234,
+							"AQI":         1,
+						},
+						Labels: map[string]string{
+							"sensor_version": "v1.0.1",
+							"uptime":         "1h31m6s",
+						},
+						Indices: map[string]string{
+							"location": "living room",
+						},
+					})
+				}
+
+				db, err := jdb.NewInMemory(test.opts...)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				err = db.InsertBatch(batch)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				// batch is no longer referenced, and so only what the
+				// database retains is measured
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				runtime.KeepAlive(db)
+
+				heap += int64(after.HeapAlloc) - int64(before.HeapAlloc)
+			}
+
+			b.ReportMetric(float64(heap)/float64(b.N), "heap-bytes/op")
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package jdb
+
+import (
+	"time"
+)
+
+// flushPolicy overrides FlushMaxSize and FlushMaxDuration for a single
+// Measurement name, as set by SetFlushPolicy. Zero values fall back to
+// the global defaults
+type flushPolicy struct {
+	maxSize     int
+	maxDuration time.Duration
+}
+
+// size returns the number of buffered Measurements which trigger a flush
+func (p flushPolicy) size() int {
+	if p.maxSize > 0 {
+		return p.maxSize
+	}
+
+	return FlushMaxSize
+}
+
+// duration returns how long buffered Measurements may wait before
+// triggering a flush
+func (p flushPolicy) duration() time.Duration {
+	if p.maxDuration > 0 {
+		return p.maxDuration
+	}
+
+	return FlushMaxDuration
+}
+
+// SetFlushPolicy overrides FlushMaxSize and FlushMaxDuration for Measurements of a
+// specific name, such that a bursty Measurement can be flushed frequently, while a
+// steady one is flushed in large batches. A maxSize or maxDur of zero, or less, uses
+// the global value instead, and so setting both to zero removes the override.
+//
+// Measurements of every name share a single save buffer, and so policies decide when
+// the buffer is flushed, rather than what is flushed; when any name's policy triggers
+// a flush, every buffered Measurement is written, regardless of name. Measurements of
+// names without a policy are counted together against the global FlushMaxSize, and so
+// a name with a larger maxSize isn't flushed early just because it fills the buffer
+// beyond FlushMaxSize on its own.
+//
+// Where WithAsyncFlush is set, maxDur is ignored in favour of the flush interval, just
+// as FlushMaxDuration is, but maxSize is honoured
+func (j *JDB) SetFlushPolicy(name string, maxSize int, maxDur time.Duration) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	// The buffer needs recounting against the new set of policies
+	j.resetBuffered()
+
+	if maxSize <= 0 && maxDur <= 0 {
+		delete(j.flushPolicies, name)
+
+		return
+	}
+
+	if j.flushPolicies == nil {
+		j.flushPolicies = make(map[string]flushPolicy)
+	}
+
+	j.flushPolicies[name] = flushPolicy{maxSize: maxSize, maxDuration: maxDur}
+}
+
+// flushDue reports whether the save buffer is full, or has gone unflushed for
+// too long, as per FlushMaxSize, FlushMaxDuration, and any flush policies.
+//
+// Callers must hold saveMutex
+func (j *JDB) flushDue() (full, stale bool) {
+	now := time.Now()
+
+	if len(j.flushPolicies) == 0 {
+		return len(j.saveBuffer) >= FlushMaxSize, now.After(j.lastSave.Add(FlushMaxDuration))
+	}
+
+	j.countBuffered()
+
+	others := len(j.saveBuffer)
+	for name, p := range j.flushPolicies {
+		n := j.buffered[name]
+		if n == 0 {
+			continue
+		}
+
+		others -= n
+
+		full = full || n >= p.size()
+		stale = stale || now.After(j.lastSave.Add(p.duration()))
+	}
+
+	full = full || others >= FlushMaxSize
+	stale = stale || (others > 0 && now.After(j.lastSave.Add(FlushMaxDuration)))
+
+	return
+}
+
+// countBuffered counts the Measurements appended to the save buffer since it
+// was last counted, for each name with a flush policy. Because the buffer is
+// only ever appended to, only new Measurements need counting, except where
+// the buffer is flushed or has Measurements removed, which resets the count.
+//
+// Callers must hold saveMutex
+func (j *JDB) countBuffered() {
+	if j.buffered == nil {
+		j.buffered = make(map[string]int, len(j.flushPolicies))
+	}
+
+	for _, m := range j.saveBuffer[j.bufferedCounted:] {
+		if _, ok := j.flushPolicies[m.Name]; ok {
+			j.buffered[m.Name]++
+		}
+	}
+
+	j.bufferedCounted = len(j.saveBuffer)
+}
+
+// resetBuffered discards the counts made by countBuffered, and must be called
+// whenever Measurements are removed from the save buffer.
+//
+// Callers must hold saveMutex
+func (j *JDB) resetBuffered() {
+	j.buffered = nil
+	j.bufferedCounted = 0
+}
@@ -0,0 +1,110 @@
+package jdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_SetFlushPolicy(t *testing.T) {
+	defer func(size int, duration time.Duration) {
+		jdb.FlushMaxSize = size
+		jdb.FlushMaxDuration = duration
+	}(jdb.FlushMaxSize, jdb.FlushMaxDuration)
+
+	jdb.FlushMaxSize = 10
+	jdb.FlushMaxDuration = time.Hour
+
+	start := time.Now().Add(0 - time.Hour)
+
+	// insert inserts count Measurements of name, each a second after the last,
+	// starting from the start of each test
+	var next int
+
+	insert := func(t *testing.T, db *jdb.JDB, name string, count int) {
+		t.Helper()
+
+		for i := 0; i < count; i++ {
+			err := db.Insert(&jdb.Measurement{
+				Name: name,
+				When: start.Add(time.Second * time.Duration(next)),
+				Dimensions: map[string]float64{
+					"value": float64(i),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next++
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		policy func(*jdb.JDB)
+		insert func(*testing.T, *jdb.JDB)
+		expect int
+	}{
+		{"Without policies, the global size applies", func(*jdb.JDB) {}, func(t *testing.T, db *jdb.JDB) {
+			insert(t, db, "logs", 9)
+			insert(t, db, "metrics", 1)
+		}, 0},
+		{"Smaller sizes flush early", func(db *jdb.JDB) { db.SetFlushPolicy("logs", 5, 0) }, func(t *testing.T, db *jdb.JDB) {
+			insert(t, db, "metrics", 3)
+			insert(t, db, "logs", 4)
+		}, 7},
+		{"Reaching a smaller size flushes everything", func(db *jdb.JDB) { db.SetFlushPolicy("logs", 5, 0) }, func(t *testing.T, db *jdb.JDB) {
+			insert(t, db, "metrics", 3)
+			insert(t, db, "logs", 5)
+		}, 0},
+		{"Larger sizes aren't flushed by the global size", func(db *jdb.JDB) { db.SetFlushPolicy("metrics", 20, 0) }, func(t *testing.T, db *jdb.JDB) {
+			insert(t, db, "metrics", 15)
+		}, 15},
+		{"Other names still honour the global size", func(db *jdb.JDB) { db.SetFlushPolicy("metrics", 20, 0) }, func(t *testing.T, db *jdb.JDB) {
+			insert(t, db, "metrics", 15)
+
+			insert(t, db, "logs", 10)
+		}, 0},
+		{"Shorter durations flush early", func(db *jdb.JDB) { db.SetFlushPolicy("logs", 0, time.Nanosecond) }, func(t *testing.T, db *jdb.JDB) {
+			insert(t, db, "metrics", 3)
+			time.Sleep(time.Millisecond)
+
+			insert(t, db, "logs", 1)
+		}, 0},
+		{"Removed policies no longer apply", func(db *jdb.JDB) {
+			db.SetFlushPolicy("logs", 5, 0)
+			db.SetFlushPolicy("logs", 0, 0)
+		}, func(t *testing.T, db *jdb.JDB) {
+			insert(t, db, "logs", 5)
+		}, 5},
+		{"Deleted Measurements aren't counted", func(db *jdb.JDB) { db.SetFlushPolicy("logs", 5, 0) }, func(t *testing.T, db *jdb.JDB) {
+			insert(t, db, "logs", 3)
+
+			_, err := db.DeleteByTimeRange("logs", start, start.Add(time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			insert(t, db, "logs", 3)
+		}, 4},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := jdb.NewInMemory()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next = 0
+
+			test.policy(db)
+
+			test.insert(t, db)
+
+			if received := db.Stats().SaveBuffer; test.expect != received {
+				t.Errorf("expected %d buffered measurements, received %d", test.expect, received)
+			}
+		})
+	}
+}
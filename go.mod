@@ -1,3 +1,9 @@
 module github.com/jspc/jdb
 
 go 1.23.2
+
+require (
+	github.com/golang/snappy v1.0.0
+	github.com/klauspost/compress v1.17.11
+	google.golang.org/protobuf v1.36.12
+)
@@ -0,0 +1,66 @@
+package jdb
+
+import (
+	"errors"
+)
+
+// ErrInvalidGranularity returns when WithGranularity is passed an unknown Granularity
+var ErrInvalidGranularity = errors.New("invalid granularity")
+
+// Granularity controls the period of time covered by each of the shards which
+// Measurements are stored in.
+//
+// Each insert sorts the shards it touches, and each query walks (and sorts) every
+// shard of a Measurement name. Finer granularities, then, make for smaller shards
+// and cheaper inserts of out of order data, at the cost of more shards to walk per
+// query. Coarser granularities suit sparse data, such as daily metrics, where finer
+// granularities would leave each Measurement in a shard of its own.
+//
+// BenchmarkJDB_QueryAll_Granularity demonstrates the effect of each Granularity on
+// queries.
+//
+// Shards are derived from `Measurement.When` as a database is loaded, rather than being
+// stored on disk, and so the Granularity of a database may be changed freely between
+// opens.
+type Granularity int
+
+const (
+	// GranularityHour shards Measurements by hour, and is the default
+	GranularityHour Granularity = iota
+
+	// GranularityMinute shards Measurements by minute
+	GranularityMinute
+
+	// GranularityDay shards Measurements by day
+	GranularityDay
+)
+
+// format returns the time format used to derive shard keys. Keys are derived
+// from wall clock time, and so only sort in time order where Measurements share
+// a location; shards should be ordered by their contents instead
+func (g Granularity) format() string {
+	switch g {
+	case GranularityMinute:
+		return "2006-01-02_15:04"
+
+	case GranularityDay:
+		return "2006-01-02"
+
+	default:
+		return "2006-01-02_15"
+	}
+}
+
+// WithGranularity configures the Granularity of the shards a JDB stores
+// Measurements in
+func WithGranularity(g Granularity) OpenOption {
+	return func(j *JDB) error {
+		if g < GranularityHour || g > GranularityDay {
+			return ErrInvalidGranularity
+		}
+
+		j.granularity = g
+
+		return nil
+	}
+}
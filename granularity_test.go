@@ -0,0 +1,145 @@
+package jdb_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+var granularities = []struct {
+	name string
+	g    jdb.Granularity
+}{
+	{"minute", jdb.GranularityMinute},
+	{"hour", jdb.GranularityHour},
+	{"day", jdb.GranularityDay},
+}
+
+func TestWithGranularity(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name(), jdb.WithGranularity(jdb.GranularityMinute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Three days worth of data, every ten minutes
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 432; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: start.Add(time.Minute * time.Duration(i*10)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &jdb.Options{From: start.Add(time.Hour * 20), To: start.Add(time.Hour * 30)}
+
+	for _, test := range granularities {
+		t.Run(fmt.Sprintf("Reopening with %s granularity returns the same data", test.name), func(t *testing.T) {
+			db, err := jdb.New(f.Name(), jdb.WithGranularity(test.g))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer db.Close()
+
+			for _, q := range []func() ([]*jdb.Measurement, error){
+				func() ([]*jdb.Measurement, error) { return db.QueryAll("wibbles", opts) },
+				func() ([]*jdb.Measurement, error) {
+					return db.QueryAllIndex("wibbles", jdb.DefaultIndexName, "wibbles", opts)
+				},
+			} {
+				m, err := q()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(m) != 61 {
+					t.Errorf("expected 61 measurements, received %d", len(m))
+				}
+
+				sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
+					return a.When.Compare(b.When)
+				})
+
+				if !sorted {
+					t.Error("Results are not sorted")
+				}
+			}
+		})
+	}
+
+	t.Run("Invalid granularities fail", func(t *testing.T) {
+		_, err := jdb.NewInMemory(jdb.WithGranularity(jdb.Granularity(100)))
+		if !errors.Is(err, jdb.ErrInvalidGranularity) {
+			t.Errorf("expected jdb.ErrInvalidGranularity, received %#v", err)
+		}
+	})
+}
+
+func BenchmarkJDB_QueryAll_Granularity(b *testing.B) {
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	for _, test := range granularities {
+		db, err := jdb.NewInMemory(jdb.WithGranularity(test.g))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		// A week of data, every ten seconds
+		batch := make([]*jdb.Measurement, 0, 60_480)
+		for i := 0; i < cap(batch); i++ {
+			batch = append(batch, &jdb.Measurement{
+				Name: "wibbles",
+				When: start.Add(time.Second * time.Duration(i*10)),
+				Dimensions: map[string]float64{
+					"wobble_count": float64(i),
+				},
+			})
+		}
+
+		err = db.InsertBatch(batch)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, r := range []struct {
+			name string
+			d    time.Duration
+		}{
+			{"ten minutes", time.Minute * 10},
+			{"one day", time.Hour * 24},
+		} {
+			opts := &jdb.Options{From: start.Add(time.Hour * 48), To: start.Add(time.Hour*48 + r.d)}
+
+			b.Run(fmt.Sprintf("%s granularity, %s range", test.name, r.name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, err := db.QueryAll("wibbles", opts)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
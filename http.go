@@ -0,0 +1,227 @@
+package jdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingName returns from the query endpoints served by `JDB.Handler` when
+// a request doesn't specify a Measurement name
+var ErrMissingName = errors.New("missing required parameter: name")
+
+// Handler returns an http.Handler which serves read-only query endpoints, for
+// quickly integrating jdb with other services. It serves:
+//
+//	GET /query      returns Measurements as JSON, as per `QueryAll`
+//	GET /query.csv  returns Measurements as CSV, as per `WriteCSV`
+//
+// Both endpoints require the query parameter `name`, and accept the optional
+// parameters understood by `ParseOptions`, such as `from=now-1h`.
+//
+// Unknown Measurements return 404, and invalid parameters return 400.
+//
+// Handler can be mounted under a prefix with http.StripPrefix
+func (j *JDB) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /query", func(w http.ResponseWriter, r *http.Request) {
+		name, opts, err := queryParams(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		m, err := j.QueryAll(name, opts)
+		if err != nil {
+			httpError(w, err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		// Errors here mean the client has gone away, and so there's
+		// nobody left to tell
+		_ = json.NewEncoder(w).Encode(m)
+	})
+
+	mux.HandleFunc("GET /query.csv", func(w http.ResponseWriter, r *http.Request) {
+		name, opts, err := queryParams(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+
+		// WriteCSV only returns errors before writing anything when the query itself
+		// fails, and so it's safe to write an error response here
+		err = j.WriteCSV(w, name, opts)
+		if err != nil {
+			httpError(w, err)
+		}
+	})
+
+	return mux
+}
+
+// queryParams parses the query parameters accepted by Handler
+func queryParams(q url.Values) (name string, opts *Options, err error) {
+	name = q.Get("name")
+	if name == "" {
+		err = ErrMissingName
+
+		return
+	}
+
+	opts, err = ParseOptions(q)
+
+	return
+}
+
+// ParseOptions parses Options from a set of values, such as the query string of
+// an HTTP request, using the keys in each field's form tag. It understands:
+//
+//	from, to          timestamps; either RFC3339, or relative to now, as per below
+//	since             a duration, such as `1h30m`, or `7d`
+//	deduplicate       a boolean
+//	deduplicate_keep  either `latest` or `earliest`
+//	limit             an integer
+//	offset            an integer
+//
+// Relative timestamps take the form `now`, optionally followed by an offset such as
+// `now-15m` or `now+1h`, where the offset is a Go duration, or a whole number of days
+// or weeks, such as `now-7d` or `now-2w`. Every relative timestamp is relative to the
+// same instant, and so `from=now-1h&to=now` covers exactly an hour.
+//
+// Keys which aren't present are left unset, while invalid values return an error
+// naming the offending key. The returned Options are validated, as per `Options.Validate`
+func ParseOptions(values url.Values) (opts *Options, err error) {
+	opts = new(Options)
+	now := time.Now().Round(0)
+
+	for _, param := range []struct {
+		key   string
+		parse func(string) error
+	}{
+		{"from", func(s string) (err error) { opts.From, err = parseTime(s, now); return }},
+		{"to", func(s string) (err error) { opts.To, err = parseTime(s, now); return }},
+		{"since", func(s string) (err error) { opts.Since, err = parseDuration(s); return }},
+		{"deduplicate", func(s string) (err error) { opts.Deduplicate, err = strconv.ParseBool(s); return }},
+		{"deduplicate_keep", func(s string) (err error) { opts.DeduplicateKeep, err = parseDedupeKeep(s); return }},
+		{"limit", func(s string) (err error) { opts.Limit, err = strconv.Atoi(s); return }},
+		{"offset", func(s string) (err error) { opts.Offset, err = strconv.Atoi(s); return }},
+	} {
+		if !values.Has(param.key) {
+			continue
+		}
+
+		err = param.parse(values.Get(param.key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter %s: %w", param.key, err)
+		}
+	}
+
+	err = opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// parseTime parses either an RFC3339 timestamp, or a timestamp relative
+// to now, such as `now-15m`, as per ParseOptions
+func parseTime(s string, now time.Time) (t time.Time, err error) {
+	offset, ok := strings.CutPrefix(s, "now")
+	if !ok {
+		t, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			err = fmt.Errorf("%q is neither an RFC3339 timestamp, nor relative to now, such as now-15m", s)
+		}
+
+		return
+	}
+
+	if offset == "" {
+		return now, nil
+	}
+
+	if offset[0] != '-' && offset[0] != '+' {
+		return t, fmt.Errorf("%q must be followed by + or -, such as now-15m", s)
+	}
+
+	d, err := parseDuration(offset[1:])
+	if err != nil {
+		return
+	}
+
+	if offset[0] == '-' {
+		d = 0 - d
+	}
+
+	return now.Add(d), nil
+}
+
+// parseDedupeKeep parses the name of a DedupeKeep, as per ParseOptions
+func parseDedupeKeep(s string) (k DedupeKeep, err error) {
+	switch s {
+	case "latest":
+		return KeepLatest, nil
+
+	case "earliest":
+		return KeepEarliest, nil
+	}
+
+	return k, fmt.Errorf("%q is neither latest nor earliest", s)
+}
+
+// parseDuration parses a Go duration, such as `1h30m`, along with a whole
+// number of days or weeks, such as `7d` or `2w`, which Go durations lack
+func parseDuration(s string) (d time.Duration, err error) {
+	for _, u := range []struct {
+		suffix string
+		name   string
+		unit   time.Duration
+	}{
+		{"d", "days", time.Hour * 24},
+		{"w", "weeks", time.Hour * 24 * 7},
+	} {
+		n, ok := strings.CutSuffix(s, u.suffix)
+		if !ok {
+			continue
+		}
+
+		i, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a whole number of %s", s, u.name)
+		}
+
+		return time.Duration(i) * u.unit, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// httpError writes err to w with a status code appropriate to the error
+func httpError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, ErrNoSuchMeasurement):
+		status = http.StatusNotFound
+
+	case errors.Is(err, ErrInvalidOptions):
+		status = http.StatusBadRequest
+	}
+
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,194 @@
+package jdb_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_Handler(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(0 - time.Minute*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	from := queryTime(now.Add(0 - time.Minute*90))
+
+	for _, test := range []struct {
+		name         string
+		method       string
+		target       string
+		expectStatus int
+		expectType   string
+		expectCount  int
+	}{
+		{"Missing name fails", http.MethodGet, "/query", http.StatusBadRequest, "", 0},
+		{"Unknown measurement is not found", http.MethodGet, "/query?name=zimzams", http.StatusNotFound, "", 0},
+		{"Invalid from fails", http.MethodGet, "/query?name=wibbles&from=yesterday", http.StatusBadRequest, "", 0},
+		{"Invalid since fails", http.MethodGet, "/query?name=wibbles&since=ages", http.StatusBadRequest, "", 0},
+		{"Invalid deduplicate fails", http.MethodGet, "/query?name=wibbles&deduplicate=perhaps", http.StatusBadRequest, "", 0},
+		{"Contradictory range fails", http.MethodGet, "/query?name=wibbles&from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z", http.StatusBadRequest, "", 0},
+		{"Posting is not allowed", http.MethodPost, "/query?name=wibbles", http.StatusMethodNotAllowed, "", 0},
+		{"Unknown paths are not found", http.MethodGet, "/wibbles", http.StatusNotFound, "", 0},
+
+		{"JSON returns every measurement", http.MethodGet, "/query?name=wibbles", http.StatusOK, "application/json", 10},
+		{"JSON respects since", http.MethodGet, "/query?name=wibbles&since=4m30s", http.StatusOK, "application/json", 5},
+		{"JSON respects from", http.MethodGet, "/query?name=wibbles&from=" + from, http.StatusOK, "application/json", 10},
+		{"JSON respects relative from", http.MethodGet, "/query?name=wibbles&from=now-4m30s", http.StatusOK, "application/json", 5},
+		{"JSON respects since in days", http.MethodGet, "/query?name=wibbles&since=1d", http.StatusOK, "application/json", 10},
+		{"JSON respects limit and offset", http.MethodGet, "/query?name=wibbles&limit=3&offset=8", http.StatusOK, "application/json", 2},
+		{"Negative limit fails", http.MethodGet, "/query?name=wibbles&limit=-1", http.StatusBadRequest, "", 0},
+		{"Invalid offset fails", http.MethodGet, "/query?name=wibbles&offset=lots", http.StatusBadRequest, "", 0},
+		{"CSV unknown measurement is not found", http.MethodGet, "/query.csv?name=zimzams", http.StatusNotFound, "", 0},
+		{"CSV returns every measurement", http.MethodGet, "/query.csv?name=wibbles", http.StatusOK, "text/csv", 10},
+		{"CSV respects since", http.MethodGet, "/query.csv?name=wibbles&since=4m30s&deduplicate=true", http.StatusOK, "text/csv", 5},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			db.Handler().ServeHTTP(rec, httptest.NewRequest(test.method, test.target, nil))
+
+			if test.expectStatus != rec.Code {
+				t.Fatalf("expected: %d, received %d: %s", test.expectStatus, rec.Code, rec.Body.String())
+			}
+
+			if test.expectStatus != http.StatusOK {
+				return
+			}
+
+			if ct := rec.Header().Get("Content-Type"); test.expectType != ct {
+				t.Errorf("expected: %q, received %q", test.expectType, ct)
+			}
+
+			var count int
+
+			switch test.expectType {
+			case "application/json":
+				m := make([]*jdb.Measurement, 0)
+
+				err := json.NewDecoder(rec.Body).Decode(&m)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				count = len(m)
+
+			case "text/csv":
+				// Ignore the header row
+				count = strings.Count(rec.Body.String(), "\n") - 1
+			}
+
+			if test.expectCount != count {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, count)
+			}
+		})
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	fixed := time.Date(2024, 11, 22, 11, 46, 44, 0, time.UTC)
+
+	for _, test := range []struct {
+		name        string
+		query       string
+		expectFrom  time.Duration
+		expectTo    time.Duration
+		expectSince time.Duration
+		expectErr   string
+	}{
+		{"Empty values are valid", "", 0, 0, 0, ""},
+		{"now is now", "from=now&to=now", 0, 0, 0, ""},
+		{"Relative minutes are parsed", "from=now-15m", time.Minute * -15, 0, 0, ""},
+		{"Relative days are parsed", "from=now-7d&to=now-1d", time.Hour * 24 * -7, time.Hour * -24, 0, ""},
+		{"Relative weeks are parsed", "from=now-2w", time.Hour * 24 * -14, 0, 0, ""},
+		{"Future offsets are parsed", "to=now%2B1h", 0, time.Hour, 0, ""},
+		{"Since accepts days", "since=3d", 0, 0, time.Hour * 72, ""},
+		{"Invalid from names the field", "from=yesterday", 0, 0, 0, "invalid parameter from"},
+		{"Invalid offsets name the field", "to=now-lots", 0, 0, 0, "invalid parameter to"},
+		{"Missing signs name the field", "from=now15m", 0, 0, 0, "invalid parameter from"},
+		{"Fractional days name the field", "since=1.5d", 0, 0, 0, "invalid parameter since"},
+		{"Contradictory ranges fail", "from=now&to=now-1h", 0, 0, 0, "invalid options"},
+		{"Deduplicate keep is parsed", "deduplicate=true&deduplicate_keep=earliest", 0, 0, 0, ""},
+		{"Invalid deduplicate keep names the field", "deduplicate_keep=middle", 0, 0, 0, "invalid parameter deduplicate_keep"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			before := time.Now().Round(0)
+
+			opts, err := jdb.ParseOptions(q)
+			if test.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectErr) {
+					t.Errorf("expected error containing %q, received %#v", test.expectErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectSince != opts.Since {
+				t.Errorf("expected: %v, received %v", test.expectSince, opts.Since)
+			}
+
+			for _, tm := range []struct {
+				set    bool
+				expect time.Duration
+				rcvd   time.Time
+			}{
+				{q.Has("from"), test.expectFrom, opts.From},
+				{q.Has("to"), test.expectTo, opts.To},
+			} {
+				if !tm.set {
+					continue
+				}
+
+				// now is captured during ParseOptions, and so sits somewhere
+				// between before and the end of the call
+				if offset := tm.rcvd.Sub(before); offset < tm.expect || offset > tm.expect+time.Second {
+					t.Errorf("expected offset of %v, received %v", tm.expect, offset)
+				}
+			}
+		})
+	}
+
+	t.Run("RFC3339 timestamps are parsed", func(t *testing.T) {
+		opts, err := jdb.ParseOptions(url.Values{"from": {fixed.Format(time.RFC3339)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !fixed.Equal(opts.From) {
+			t.Errorf("expected: %v, received %v", fixed, opts.From)
+		}
+	})
+}
+
+// queryTime formats t for use in a query string
+func queryTime(t time.Time) string {
+	return strings.ReplaceAll(t.Format(time.RFC3339), "+", "%2B")
+}
@@ -0,0 +1,141 @@
+package jdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// If a batch being built by `Ingest` hasn't reached `FlushMaxSize` within
+// `IngestMaxDelay` of its first Measurement arriving then it is inserted anyway
+var IngestMaxDelay = time.Second
+
+// IngestError wraps errors caused by individual Measurements passed to Ingest,
+// such as those which fail validation, and includes the Measurement in question
+type IngestError struct {
+	Measurement *Measurement
+	Err         error
+}
+
+// Error implements the error interface
+func (e *IngestError) Error() string {
+	return fmt.Sprintf("%s at %s: %s", e.Measurement.Name, e.Measurement.When, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *IngestError) Unwrap() error {
+	return e.Err
+}
+
+// IngestOption configures a call to Ingest
+type IngestOption func(*ingester)
+
+// IngestOnError passes each *IngestError to fn, rather than logging it. Where fn
+// returns an error, Ingest stops and returns it; returning nil skips the offending
+// Measurement and carries on, which allows callers to stop at the first bad
+// Measurement by returning the error they're given
+func IngestOnError(fn func(error) error) IngestOption {
+	return func(i *ingester) {
+		i.onError = fn
+	}
+}
+
+// ingester holds the configuration of a single call to Ingest
+type ingester struct {
+	onError func(error) error
+}
+
+// Ingest reads Measurements from ch and inserts them in batches, as per `InsertBatch`,
+// which is useful for consuming from message queues and other high throughput sources
+// without paying for the write lock once per Measurement.
+//
+// Batches are inserted whenever they reach FlushMaxSize, or IngestMaxDelay after
+// their first Measurement arrived, whichever comes first.
+//
+// Ingest runs until either ctx is cancelled, in which case it returns ctx.Err(), or
+// ch is closed, in which case it returns nil. Either way, anything received but not
+// yet inserted is inserted, and the database flushed, before returning.
+//
+// Measurements which can't be inserted, such as those which fail validation or which
+// already exist, are skipped without affecting the rest of their batch. By default,
+// the resulting *IngestError is logged via Logger, which can be overridden with
+// `IngestOnError`. Other errors, such as from flushing, stop Ingest
+func (j *JDB) Ingest(ctx context.Context, ch <-chan *Measurement, opts ...IngestOption) (err error) {
+	i := &ingester{
+		onError: func(err error) error {
+			Logger.Warn("Skipping measurement during ingest", "error", err)
+
+			return nil
+		},
+	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	batch := make([]*Measurement, 0, FlushMaxSize)
+
+	timer := time.NewTimer(IngestMaxDelay)
+	timer.Stop()
+
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Join(j.ingestBatch(batch, i), j.Flush(), ctx.Err())
+
+		case m, ok := <-ch:
+			if !ok {
+				return errors.Join(j.ingestBatch(batch, i), j.Flush())
+			}
+
+			if len(batch) == 0 {
+				timer.Reset(IngestMaxDelay)
+			}
+
+			batch = append(batch, m)
+			if len(batch) < FlushMaxSize {
+				continue
+			}
+
+			timer.Stop()
+
+		case <-timer.C:
+		}
+
+		err = j.ingestBatch(batch, i)
+		if err != nil {
+			return
+		}
+
+		batch = batch[:0]
+	}
+}
+
+// ingestBatch inserts batch, skipping any Measurements which InsertBatch
+// rejects, one at a time, as per i.onError
+func (j *JDB) ingestBatch(batch []*Measurement, i *ingester) (err error) {
+	// batch is reused by the caller, and so mustn't be modified
+	batch = slices.Clone(batch)
+
+	for len(batch) > 0 {
+		err = j.InsertBatch(batch)
+
+		var be *BatchError
+		if !errors.As(err, &be) {
+			return
+		}
+
+		err = i.onError(&IngestError{Measurement: batch[be.Index], Err: be.Err})
+		if err != nil {
+			return
+		}
+
+		batch = slices.Delete(batch, be.Index, be.Index+1)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package jdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_Ingest(t *testing.T) {
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	measurement := func(i int) *jdb.Measurement {
+		return &jdb.Measurement{
+			Name: "wibbles",
+			When: start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+		}
+	}
+
+	// send writes count Measurements to a channel, along with one which fails
+	// validation and one duplicate, before closing it
+	send := func(count int) <-chan *jdb.Measurement {
+		ch := make(chan *jdb.Measurement)
+
+		go func() {
+			defer close(ch)
+
+			for i := 0; i < count; i++ {
+				ch <- measurement(i)
+
+				switch i {
+				case 2:
+					ch <- &jdb.Measurement{Name: "wibbles", When: start}
+
+				case 5:
+					ch <- measurement(i)
+				}
+			}
+		}()
+
+		return ch
+	}
+
+	count := func(t *testing.T, db *jdb.JDB) int {
+		t.Helper()
+
+		m, err := db.QueryAll("wibbles", &jdb.Options{From: start, To: start.Add(time.Hour)})
+		if err != nil && !errors.Is(err, jdb.ErrNoSuchMeasurement) {
+			t.Fatal(err)
+		}
+
+		return len(m)
+	}
+
+	defer func(size int, delay time.Duration) {
+		jdb.FlushMaxSize = size
+		jdb.IngestMaxDelay = delay
+	}(jdb.FlushMaxSize, jdb.IngestMaxDelay)
+
+	// Ensure channels need more than one batch
+	jdb.FlushMaxSize = 4
+
+	t.Run("Invalid measurements are skipped", func(t *testing.T) {
+		db, err := jdb.NewInMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errs := make([]error, 0)
+
+		err = db.Ingest(context.Background(), send(10), jdb.IngestOnError(func(err error) error {
+			errs = append(errs, err)
+
+			return nil
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c := count(t, db); c != 10 {
+			t.Errorf("expected 10 measurements, received %d", c)
+		}
+
+		if len(errs) != 2 {
+			t.Fatalf("expected 2 errors, received %d", len(errs))
+		}
+
+		for i, expect := range []error{jdb.ErrNoDimensions, jdb.ErrDuplicateMeasurement} {
+			var ie *jdb.IngestError
+			if !errors.As(errs[i], &ie) {
+				t.Errorf("expected *jdb.IngestError, received %#v", errs[i])
+			}
+
+			if !errors.Is(errs[i], expect) {
+				t.Errorf("expected %#v, received %#v", expect, errs[i])
+			}
+		}
+	})
+
+	t.Run("Errors from the handler stop ingest", func(t *testing.T) {
+		db, err := jdb.NewInMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Ingest(context.Background(), send(10), jdb.IngestOnError(func(err error) error {
+			return err
+		}))
+		if !errors.Is(err, jdb.ErrNoDimensions) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrNoDimensions, err)
+		}
+
+		// The batch containing the invalid Measurement is abandoned entirely
+		if c := count(t, db); c != 0 {
+			t.Errorf("expected 0 measurements, received %d", c)
+		}
+	})
+
+	t.Run("Partial batches are inserted after IngestMaxDelay", func(t *testing.T) {
+		jdb.IngestMaxDelay = time.Millisecond
+
+		db, err := jdb.NewInMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ch := make(chan *jdb.Measurement)
+		defer close(ch)
+
+		go db.Ingest(context.Background(), ch)
+
+		ch <- measurement(0)
+
+		deadline := time.Now().Add(time.Second)
+		for count(t, db) != 1 {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for partial batch")
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("Cancelling inserts the remainder", func(t *testing.T) {
+		jdb.IngestMaxDelay = time.Hour
+
+		db, err := jdb.NewInMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := make(chan *jdb.Measurement)
+		done := make(chan error)
+
+		go func() {
+			done <- db.Ingest(ctx, ch)
+		}()
+
+		for i := 0; i < 6; i++ {
+			ch <- measurement(i)
+		}
+
+		cancel()
+
+		err = <-done
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected %#v, received %#v", context.Canceled, err)
+		}
+
+		if c := count(t, db); c != 6 {
+			t.Errorf("expected 6 measurements, received %d", c)
+		}
+	})
+}
@@ -0,0 +1,260 @@
+// measurement.proto describes the wire format returned by JDB.QueryAllProto.
+//
+// Go code for these messages is generated into the jdbpb package with:
+//
+//   go generate github.com/jspc/jdb
+//
+// Consumers in other languages can generate code from this file as normal.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: measurement.proto
+
+package jdbpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Measurement struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// when is Measurement.When, as nanoseconds since the unix epoch
+	When          int64              `protobuf:"varint,1,opt,name=when,proto3" json:"when,omitempty"`
+	Name          string             `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Dimensions    map[string]float64 `protobuf:"bytes,3,rep,name=dimensions,proto3" json:"dimensions,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	Labels        map[string]string  `protobuf:"bytes,4,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Indices       map[string]string  `protobuf:"bytes,5,rep,name=indices,proto3" json:"indices,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	IntDimensions map[string]int64   `protobuf:"bytes,6,rep,name=int_dimensions,json=intDimensions,proto3" json:"int_dimensions,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	States        map[string]bool    `protobuf:"bytes,7,rep,name=states,proto3" json:"states,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Measurement) Reset() {
+	*x = Measurement{}
+	mi := &file_measurement_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Measurement) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Measurement) ProtoMessage() {}
+
+func (x *Measurement) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Measurement.ProtoReflect.Descriptor instead.
+func (*Measurement) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Measurement) GetWhen() int64 {
+	if x != nil {
+		return x.When
+	}
+	return 0
+}
+
+func (x *Measurement) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Measurement) GetDimensions() map[string]float64 {
+	if x != nil {
+		return x.Dimensions
+	}
+	return nil
+}
+
+func (x *Measurement) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *Measurement) GetIndices() map[string]string {
+	if x != nil {
+		return x.Indices
+	}
+	return nil
+}
+
+func (x *Measurement) GetIntDimensions() map[string]int64 {
+	if x != nil {
+		return x.IntDimensions
+	}
+	return nil
+}
+
+func (x *Measurement) GetStates() map[string]bool {
+	if x != nil {
+		return x.States
+	}
+	return nil
+}
+
+type Measurements struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Measurements  []*Measurement         `protobuf:"bytes,1,rep,name=measurements,proto3" json:"measurements,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Measurements) Reset() {
+	*x = Measurements{}
+	mi := &file_measurement_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Measurements) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Measurements) ProtoMessage() {}
+
+func (x *Measurements) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Measurements.ProtoReflect.Descriptor instead.
+func (*Measurements) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Measurements) GetMeasurements() []*Measurement {
+	if x != nil {
+		return x.Measurements
+	}
+	return nil
+}
+
+var File_measurement_proto protoreflect.FileDescriptor
+
+const file_measurement_proto_rawDesc = "" +
+	"\n" +
+	"\x11measurement.proto\x12\x03jdb\"\x9b\x05\n" +
+	"\vMeasurement\x12\x12\n" +
+	"\x04when\x18\x01 \x01(\x03R\x04when\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12@\n" +
+	"\n" +
+	"dimensions\x18\x03 \x03(\v2 .jdb.Measurement.DimensionsEntryR\n" +
+	"dimensions\x124\n" +
+	"\x06labels\x18\x04 \x03(\v2\x1c.jdb.Measurement.LabelsEntryR\x06labels\x127\n" +
+	"\aindices\x18\x05 \x03(\v2\x1d.jdb.Measurement.IndicesEntryR\aindices\x12J\n" +
+	"\x0eint_dimensions\x18\x06 \x03(\v2#.jdb.Measurement.IntDimensionsEntryR\rintDimensions\x124\n" +
+	"\x06states\x18\a \x03(\v2\x1c.jdb.Measurement.StatesEntryR\x06states\x1a=\n" +
+	"\x0fDimensionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a:\n" +
+	"\fIndicesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a@\n" +
+	"\x12IntDimensionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\x1a9\n" +
+	"\vStatesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\bR\x05value:\x028\x01\"D\n" +
+	"\fMeasurements\x124\n" +
+	"\fmeasurements\x18\x01 \x03(\v2\x10.jdb.MeasurementR\fmeasurementsB\x1bZ\x19github.com/jspc/jdb/jdbpbb\x06proto3"
+
+var (
+	file_measurement_proto_rawDescOnce sync.Once
+	file_measurement_proto_rawDescData []byte
+)
+
+func file_measurement_proto_rawDescGZIP() []byte {
+	file_measurement_proto_rawDescOnce.Do(func() {
+		file_measurement_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_measurement_proto_rawDesc), len(file_measurement_proto_rawDesc)))
+	})
+	return file_measurement_proto_rawDescData
+}
+
+var file_measurement_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_measurement_proto_goTypes = []any{
+	(*Measurement)(nil),  // 0: jdb.Measurement
+	(*Measurements)(nil), // 1: jdb.Measurements
+	nil,                  // 2: jdb.Measurement.DimensionsEntry
+	nil,                  // 3: jdb.Measurement.LabelsEntry
+	nil,                  // 4: jdb.Measurement.IndicesEntry
+	nil,                  // 5: jdb.Measurement.IntDimensionsEntry
+	nil,                  // 6: jdb.Measurement.StatesEntry
+}
+var file_measurement_proto_depIdxs = []int32{
+	2, // 0: jdb.Measurement.dimensions:type_name -> jdb.Measurement.DimensionsEntry
+	3, // 1: jdb.Measurement.labels:type_name -> jdb.Measurement.LabelsEntry
+	4, // 2: jdb.Measurement.indices:type_name -> jdb.Measurement.IndicesEntry
+	5, // 3: jdb.Measurement.int_dimensions:type_name -> jdb.Measurement.IntDimensionsEntry
+	6, // 4: jdb.Measurement.states:type_name -> jdb.Measurement.StatesEntry
+	0, // 5: jdb.Measurements.measurements:type_name -> jdb.Measurement
+	6, // [6:6] is the sub-list for method output_type
+	6, // [6:6] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_measurement_proto_init() }
+func file_measurement_proto_init() {
+	if File_measurement_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_measurement_proto_rawDesc), len(file_measurement_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_measurement_proto_goTypes,
+		DependencyIndexes: file_measurement_proto_depIdxs,
+		MessageInfos:      file_measurement_proto_msgTypes,
+	}.Build()
+	File_measurement_proto = out.File
+	file_measurement_proto_goTypes = nil
+	file_measurement_proto_depIdxs = nil
+}
@@ -0,0 +1,243 @@
+package jdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidLineProtocol returns when ParseLineProtocol encounters a line which
+	// doesn't follow the InfluxDB line protocol
+	ErrInvalidLineProtocol = errors.New("invalid line protocol")
+
+	// ErrInvalidFieldValue returns when a line protocol field value can't be
+	// parsed, such as an unterminated string or an out of range integer
+	ErrInvalidFieldValue = errors.New("invalid line protocol field value")
+)
+
+// LineProtocolError wraps errors returned by ParseLineProtocol, and includes
+// the (1-indexed) line number which caused the error
+type LineProtocolError struct {
+	Line int
+	Err  error
+}
+
+// Error implements the error interface
+func (e *LineProtocolError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *LineProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// ParseLineProtocol parses InfluxDB line protocol from r into Measurements, which can
+// then be passed to `InsertBatch`. See: https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/
+//
+// Data is mapped as follows:
+//
+//  1. The measurement becomes `Measurement.Name`
+//  2. Tags become `Measurement.Indices`
+//  3. Float fields become `Measurement.Dimensions`
+//  4. Integer (`1i`) and unsigned integer (`1u`) fields become `Measurement.IntDimensions`
+//  5. String and boolean fields become `Measurement.Labels`
+//  6. The timestamp, which must be in nanoseconds, becomes `Measurement.When`
+//
+// Lines without a timestamp are given the current time, as per InfluxDB. Blank lines,
+// and comments beginning with '#', are skipped.
+//
+// Malformed lines, including those with no numeric fields, cause ParseLineProtocol to
+// return a *LineProtocolError containing the offending line number
+func ParseLineProtocol(r io.Reader) (m []*Measurement, err error) {
+	m = make([]*Measurement, 0)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		measurement, err := parseLine(line)
+		if err == nil {
+			err = measurement.Validate()
+		}
+
+		if err != nil {
+			return nil, &LineProtocolError{Line: n, Err: err}
+		}
+
+		m = append(m, measurement)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func parseLine(line string) (m *Measurement, err error) {
+	sections := lpSplit(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, fmt.Errorf("%w: expected 2 or 3 space separated sections, received %d", ErrInvalidLineProtocol, len(sections))
+	}
+
+	m = &Measurement{
+		Dimensions:    make(map[string]float64),
+		IntDimensions: make(map[string]int64),
+		Labels:        make(map[string]string),
+		Indices:       make(map[string]string),
+	}
+
+	key := lpSplit(sections[0], ',', false)
+
+	m.Name = lpUnescape(key[0])
+	if m.Name == "" {
+		return nil, fmt.Errorf("%w: missing measurement", ErrInvalidLineProtocol)
+	}
+
+	for _, tag := range key[1:] {
+		k, v, ok := lpCut(tag)
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("%w: invalid tag %q", ErrInvalidLineProtocol, tag)
+		}
+
+		m.Indices[lpUnescape(k)] = lpUnescape(v)
+	}
+
+	for _, field := range lpSplit(sections[1], ',', true) {
+		k, v, ok := lpCut(field)
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("%w: invalid field %q", ErrInvalidLineProtocol, field)
+		}
+
+		err = m.setLineProtocolField(lpUnescape(k), v)
+		if err != nil {
+			return
+		}
+	}
+
+	m.When = time.Now()
+	if len(sections) == 3 {
+		var ns int64
+
+		ns, err = strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid timestamp %q", ErrInvalidLineProtocol, sections[2])
+		}
+
+		m.When = time.Unix(0, ns)
+	}
+
+	return
+}
+
+// setLineProtocolField parses a line protocol field value, setting it
+// on the correct field of m
+func (m *Measurement) setLineProtocolField(k, v string) (err error) {
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		m.Labels[k] = "true"
+
+		return
+
+	case "f", "F", "false", "False", "FALSE":
+		m.Labels[k] = "false"
+
+		return
+	}
+
+	switch {
+	case v[0] == '"':
+		if len(v) < 2 || v[len(v)-1] != '"' {
+			return fmt.Errorf("%w: unterminated string %q", ErrInvalidFieldValue, v)
+		}
+
+		m.Labels[k] = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(v[1 : len(v)-1])
+
+	case strings.HasSuffix(v, "i"):
+		m.IntDimensions[k], err = strconv.ParseInt(v[:len(v)-1], 10, 64)
+
+	case strings.HasSuffix(v, "u"):
+		var u uint64
+
+		u, err = strconv.ParseUint(v[:len(v)-1], 10, 64)
+		if err == nil && u > math.MaxInt64 {
+			err = strconv.ErrRange
+		}
+
+		m.IntDimensions[k] = int64(u)
+
+	default:
+		m.Dimensions[k], err = strconv.ParseFloat(v, 64)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", ErrInvalidFieldValue, v, err)
+	}
+
+	return
+}
+
+// lpSplit splits s on every unescaped instance of sep, ignoring separators
+// within double quotes when quotes is true. Escapes are left intact, for
+// later unescaping
+func lpSplit(s string, sep byte, quotes bool) (out []string) {
+	var (
+		start   int
+		inQuote bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+
+		case quotes && s[i] == '"':
+			inQuote = !inQuote
+
+		case s[i] == sep && !inQuote:
+			if i > start {
+				out = append(out, s[start:i])
+			}
+
+			start = i + 1
+		}
+	}
+
+	if start < len(s) {
+		out = append(out, s[start:])
+	}
+
+	return
+}
+
+// lpCut splits s around the first unescaped '='
+func lpCut(s string) (k, v string, ok bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+
+		case '=':
+			return s[:i], s[i+1:], true
+		}
+	}
+
+	return s, "", false
+}
+
+// lpUnescape removes the backslashes from escaped commas, equals
+// signs, and spaces
+func lpUnescape(s string) string {
+	return strings.NewReplacer(`\,`, `,`, `\=`, `=`, `\ `, ` `, `\\`, `\`).Replace(s)
+}
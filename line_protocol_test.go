@@ -0,0 +1,138 @@
+package jdb_test
+
+import (
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestParseLineProtocol(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		input      string
+		expect     *jdb.Measurement
+		expectLine int
+	}{
+		{
+			name:  "Full line is parsed",
+			input: "environment,location=kitchen,sensor=RP2040 temperature=19.23,humidity=48i,door=\"open\",heating=t 1556813561098000000",
+			expect: &jdb.Measurement{
+				Name:          "environment",
+				When:          time.Unix(0, 1556813561098000000),
+				Dimensions:    map[string]float64{"temperature": 19.23},
+				IntDimensions: map[string]int64{"humidity": 48},
+				Labels:        map[string]string{"door": "open", "heating": "true"},
+				Indices:       map[string]string{"location": "kitchen", "sensor": "RP2040"},
+			},
+		},
+		{
+			name:  "Escapes are handled",
+			input: "my\\ environment,the\\ location=big\\,kitchen temperature=19.23,note=\"a \\\"quoted\\\", spaced, string\" 1556813561098000000",
+			expect: &jdb.Measurement{
+				Name:          "my environment",
+				When:          time.Unix(0, 1556813561098000000),
+				Dimensions:    map[string]float64{"temperature": 19.23},
+				IntDimensions: map[string]int64{},
+				Labels:        map[string]string{"note": "a \"quoted\", spaced, string"},
+				Indices:       map[string]string{"the location": "big,kitchen"},
+			},
+		},
+		{
+			name:  "Comments and blank lines are skipped",
+			input: "# a comment\n\nenvironment temperature=19.23,count=3u 1556813561098000000\n",
+			expect: &jdb.Measurement{
+				Name:          "environment",
+				When:          time.Unix(0, 1556813561098000000),
+				Dimensions:    map[string]float64{"temperature": 19.23},
+				IntDimensions: map[string]int64{"count": 3},
+				Labels:        map[string]string{},
+				Indices:       map[string]string{"_default_index": "environment"},
+			},
+		},
+		{"Missing fields fail", "environment\nenvironment,location=kitchen", nil, 1},
+		{"Invalid tags fail", "environment temperature=19.23\nenvironment,location temperature=19.23", nil, 2},
+		{"Invalid floats fail", "environment temperature=nineteen", nil, 1},
+		{"Invalid integers fail", "environment temperature=19.23i", nil, 1},
+		{"Out of range unsigned integers fail", "environment count=18446744073709551615u", nil, 1},
+		{"Unterminated strings fail", "environment temperature=19.23,note=\"hello 1556813561098000000", nil, 1},
+		{"Invalid timestamps fail", "environment temperature=19.23 yesterday", nil, 1},
+		{"Lines without numeric fields fail", "environment note=\"hello\"", nil, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := jdb.ParseLineProtocol(strings.NewReader(test.input))
+			if test.expectLine > 0 {
+				var lpErr *jdb.LineProtocolError
+				if !errors.As(err, &lpErr) {
+					t.Fatalf("expected *jdb.LineProtocolError, received %#v", err)
+				}
+
+				if test.expectLine != lpErr.Line {
+					t.Errorf("expected: %d, received %d", test.expectLine, lpErr.Line)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m) != 1 {
+				t.Fatalf("expected 1 measurement, received %d", len(m))
+			}
+
+			rcvd := m[0]
+			switch {
+			case test.expect.Name != rcvd.Name:
+				t.Errorf("expected: %q, received %q", test.expect.Name, rcvd.Name)
+
+			case !test.expect.When.Equal(rcvd.When):
+				t.Errorf("expected: %v, received %v", test.expect.When, rcvd.When)
+
+			case !maps.Equal(test.expect.Dimensions, rcvd.Dimensions):
+				t.Errorf("expected: %v, received %v", test.expect.Dimensions, rcvd.Dimensions)
+
+			case !maps.Equal(test.expect.IntDimensions, rcvd.IntDimensions):
+				t.Errorf("expected: %v, received %v", test.expect.IntDimensions, rcvd.IntDimensions)
+
+			case !maps.Equal(test.expect.Labels, rcvd.Labels):
+				t.Errorf("expected: %v, received %v", test.expect.Labels, rcvd.Labels)
+
+			case !maps.Equal(test.expect.Indices, rcvd.Indices):
+				t.Errorf("expected: %v, received %v", test.expect.Indices, rcvd.Indices)
+			}
+		})
+	}
+
+	t.Run("Missing timestamps use the current time", func(t *testing.T) {
+		m, err := jdb.ParseLineProtocol(strings.NewReader("environment temperature=19.23"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if time.Since(m[0].When) > time.Minute {
+			t.Errorf("expected a recent timestamp, received %v", m[0].When)
+		}
+	})
+
+	t.Run("Parsed measurements can be inserted", func(t *testing.T) {
+		m, err := jdb.ParseLineProtocol(strings.NewReader("environment,location=kitchen temperature=19.23 1556813561098000000\nenvironment,location=bedroom temperature=18.5 1556813561098000000"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := jdb.NewInMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.InsertBatch(m)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package jdb
+
+import (
+	"os"
+)
+
+// lockFile is a no-op on systems without flock
+func lockFile(*os.File) error {
+	return nil
+}
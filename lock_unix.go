@@ -0,0 +1,20 @@
+//go:build unix
+
+package jdb
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock on f, returning ErrLocked where
+// something else already holds it. The lock is released when f is closed
+func lockFile(f *os.File) (err error) {
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+
+	return
+}
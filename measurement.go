@@ -4,19 +4,59 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"math"
 	"slices"
+	"strings"
 	"time"
+	"unicode"
 )
 
 var (
 	ErrEmptyName    = errors.New("measurement name must not be empty")
 	ErrNoDimensions = errors.New("measurement has no dimensions")
 	ErrFieldInUse   = errors.New("field names must be unique across dimensions, labels, and indices for a given Measurement name")
+
+	// ErrInvalidDimensionValue returns when a Measurement has a dimension which is
+	// NaN or infinite, neither of which can be represented in json, and so would
+	// prevent the database from being reloaded
+	ErrInvalidDimensionValue = errors.New("dimension values must not be NaN or infinite")
+
+	// ErrFieldTypeConflict returns when inserting a Measurement which uses a field
+	// as a different type to previously inserted Measurements of the same name, such
+	// as a label which was previously an index.
+	//
+	// Returned errors wrap ErrFieldTypeConflict with the details of the conflict, and
+	// so should be checked with errors.Is
+	ErrFieldTypeConflict = errors.New("field type conflicts with existing measurements")
+
+	// ErrInvalidName returns when a Measurement name, or the name of one of its
+	// fields, is longer than MaxNameLength or contains control characters.
+	//
+	// Returned errors wrap ErrInvalidName with the offending name, and so should
+	// be checked with errors.Is
+	ErrInvalidName = errors.New("invalid name")
+
+	// ErrInvalidIndexValue returns when a Measurement has an index value containing
+	// a NUL byte. Index values are joined with NUL bytes to form Measurement IDs, and
+	// so allowing them would let different values produce the same ID.
+	//
+	// Returned errors wrap ErrInvalidIndexValue with the offending index, and so
+	// should be checked with errors.Is
+	ErrInvalidIndexValue = errors.New("index values must not contain NUL bytes")
+
+	// MaxNameLength is the longest, in bytes, that a Measurement name, or the name
+	// of a dimension, state, label, or index, may be. Setting this to zero disables
+	// the check entirely.
+	//
+	// Names containing control characters, including the NUL byte which separates
+	// the components of Measurement IDs, are always rejected
+	MaxNameLength = 256
 )
 
 const (
-	dtsFmt = "2006-01-02_15"
-
 	// DefaultIndexName is used for Measurements where an Index
 	// hasn't beed specified so we can still de-dupe it.
 	DefaultIndexName = "_default_index"
@@ -43,39 +83,115 @@ const (
 //
 //	id := name + \0x00 + indexName + \0x00 + indexValue + \0x00 + measurement_timestamp_in_nanoseconds + \0x00
 //
-// and then base64 encoded.
+// (where the timestamp is an 8 byte, big endian, integer) and then base64 encoded.
 //
 // This does mean there's the potential for collisions, should multiple Measurements
 // have the same name, index, and timestamp (to the nanosecond); it's _unlikely_ to
 // happen, but it's possible. With this in mind, indexing on a sensor ID, or
-// something unique to the creator of a Measurement is always smart
+// something unique to the creator of a Measurement is always smart.
+//
+// Which indices form these ids can be configured with `WithDedupeKey`.
+//
+// Dimensions are stored as float64s, which can only represent integers exactly up
+// to 2^53. Where larger integers, such as big counters, need storing exactly then
+// IntDimensions can be used instead. A dimension name may appear in either Dimensions
+// or IntDimensions, but not both.
+//
+// On/off states, such as whether a door is open, can be stored in States, which keeps
+// them as booleans rather than coercing them to 1 and 0.
 type Measurement struct {
-	When       time.Time          `json:"when"`
-	Name       string             `json:"name"`
-	Dimensions map[string]float64 `json:"dimensions"`
-	Labels     map[string]string  `json:"labels"`
-	Indices    map[string]string  `json:"indices"`
+	When          time.Time          `json:"when"`
+	Name          string             `json:"name"`
+	Dimensions    map[string]float64 `json:"dimensions"`
+	IntDimensions map[string]int64   `json:"int_dimensions,omitempty"`
+	States        map[string]bool    `json:"states,omitempty"`
+	Labels        map[string]string  `json:"labels"`
+	Indices       map[string]string  `json:"indices"`
+
+	// dimensions32 holds Dimensions in databases opened with WithFloat32Dimensions,
+	// in which case Dimensions is nil until the Measurement is returned from a query
+	dimensions32 *float32Dimensions
 }
 
 // Validate returns an error if:
 //
 //  1. The Measurement name is empty
-//  2. The Measurement has no Dimensions
+//  2. The Measurement has no Dimensions, IntDimensions, or States
+//  3. A name appears in more than one of Dimensions, IntDimensions, and States
+//  4. A dimension is NaN, or infinite
+//  5. The Measurement name, or the name of any field, is too long or contains
+//     control characters (see MaxNameLength)
 //
 // If the Measurement has no indices, we create one called `_default_index`
 // with the same value as the Measurement name. This exists purely to make
 // deduplication easier and can be ignored by pretty much everything
 //
+// Similarly, if When is the zero time then it is set to the current time, which
+// stops Measurements without a timestamp from colliding with one another. Callers
+// who genuinely want a timestamp at the start of time should set When to something
+// just after it, such as `time.Unix(0, 0)`
+//
 // Without these three elements, a Measurement is functionally meaningless
 func (m *Measurement) Validate() error {
 	if len(m.Name) == 0 {
 		return ErrEmptyName
 	}
 
-	if len(m.Dimensions) == 0 {
+	err := validateName(m.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, names := range []iter.Seq[string]{
+		maps.Keys(m.Dimensions),
+		maps.Keys(m.IntDimensions),
+		maps.Keys(m.States),
+		maps.Keys(m.Labels),
+		maps.Keys(m.Indices),
+	} {
+		for name := range names {
+			err = validateName(name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(m.Dimensions)+len(m.IntDimensions)+len(m.States) == 0 {
 		return ErrNoDimensions
 	}
 
+	for k := range m.IntDimensions {
+		if _, ok := m.Dimensions[k]; ok {
+			return ErrFieldInUse
+		}
+	}
+
+	for k := range m.States {
+		_, isDimension := m.Dimensions[k]
+		_, isIntDimension := m.IntDimensions[k]
+
+		if isDimension || isIntDimension {
+			return ErrFieldInUse
+		}
+	}
+
+	for _, v := range m.Dimensions {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return ErrInvalidDimensionValue
+		}
+	}
+
+	for k, v := range m.Indices {
+		if strings.ContainsRune(v, '\x00') {
+			return fmt.Errorf("%w: index %q", ErrInvalidIndexValue, k)
+		}
+	}
+
+	if m.When.IsZero() {
+		m.When = time.Now().Round(0)
+	}
+
 	if len(m.Indices) == 0 {
 		m.Indices = map[string]string{
 			DefaultIndexName: m.Name,
@@ -85,35 +201,135 @@ func (m *Measurement) Validate() error {
 	return nil
 }
 
-func (m Measurement) dts() string {
-	return m.When.Format(dtsFmt)
+// validateName returns an error wrapping ErrInvalidName where name is longer
+// than MaxNameLength, or contains control characters.
+//
+// Because Measurement IDs are built from names separated by NUL bytes, a name
+// containing one could otherwise produce the same ID as a different Measurement
+func validateName(name string) error {
+	if MaxNameLength > 0 && len(name) > MaxNameLength {
+		return fmt.Errorf("%w: %.32q... is longer than %d bytes", ErrInvalidName, name, MaxNameLength)
+	}
+
+	if strings.ContainsFunc(name, unicode.IsControl) {
+		return fmt.Errorf("%w: %q contains control characters", ErrInvalidName, name)
+	}
+
+	return nil
+}
+
+// dimension returns the value of a named dimension, and whether this
+// Measurement has that dimension at all
+//
+// IntDimensions are converted to float64s, and so very large values may
+// lose precision
+func (m Measurement) dimension(name string) (v float64, ok bool) {
+	v, ok = m.Dimensions[name]
+	if ok {
+		return
+	}
+
+	if f, ok := m.dimensions32.get(name); ok {
+		return float64(f), true
+	}
+
+	i, ok := m.IntDimensions[name]
+
+	return float64(i), ok
 }
 
-func (m Measurement) ids() (ids []string) {
-	ids = make([]string, 0, len(m.Indices))
-	ns := m.When.UnixNano()
+// clone returns a deep copy of this Measurement
+func (m Measurement) clone() *Measurement {
+	m.Dimensions = maps.Clone(m.Dimensions)
+	m.IntDimensions = maps.Clone(m.IntDimensions)
+	m.States = maps.Clone(m.States)
+	m.Labels = maps.Clone(m.Labels)
+	m.Indices = maps.Clone(m.Indices)
 
-	nsBuf := make([]byte, binary.MaxVarintLen64)
-	_ = binary.PutVarint(nsBuf, ns)
+	return &m
+}
 
-	nulBytes := []byte{'\x00'}
+// dts returns the key of the shard this Measurement sits in, at
+// a specific Granularity
+func (m Measurement) dts(g Granularity) string {
+	return m.When.Format(g.format())
+}
+
+// ID returns the id jdb uses internally to identify this Measurement against a
+// specific index, and which can be passed to `JDB.GetByID`.
+//
+// ids are derived from the Measurement name, the index name and value, and
+// `When`, and so are deterministic; they can be computed without reference to a JDB,
+// such as when building secondary indexes externally.
+//
+// Measurements without any indices are identified by the index `_default_index`
+// once they've been inserted (see `Validate`). ID returns an empty string where the
+// Measurement doesn't have indexName.
+//
+// ID only applies to databases using DedupePerIndex, which is the default; `IDs`
+// returns ids for other strategies
+func (m Measurement) ID(indexName string) string {
+	v, ok := m.Indices[indexName]
+	if !ok {
+		return ""
+	}
+
+	return m.id(indexName, v)
+}
+
+// IDs returns every id jdb uses internally to identify this Measurement, under a
+// specific DedupeStrategy, each of which can be passed to `JDB.GetByID`
+func (m Measurement) IDs(s DedupeStrategy) []string {
+	return m.ids(s)
+}
+
+func (m Measurement) ids(s DedupeStrategy) (ids []string) {
+	switch s {
+	case DedupeAllIndices:
+		// Composite ids are built from every index name, and every index
+		// value, in order, such that a single index produces the same id as
+		// DedupePerIndex would
+		keys := slices.Sorted(maps.Keys(m.Indices))
+		values := make([]string, 0, len(keys))
+
+		for _, k := range keys {
+			values = append(values, m.Indices[k])
+		}
+
+		return []string{m.id(strings.Join(keys, "\x00"), strings.Join(values, "\x00"))}
+
+	case DedupeTimestamp:
+		return []string{m.id("", "")}
+	}
+
+	ids = make([]string, 0, len(m.Indices))
 
 	for iK, iV := range m.Indices {
-		ids = append(ids, base64.StdEncoding.EncodeToString(slices.Concat(
-			[]byte(m.Name),
-			nulBytes,
-			[]byte(iK),
-			nulBytes,
-			[]byte(iV),
-			nulBytes,
-			nsBuf,
-			nulBytes,
-		)))
+		ids = append(ids, m.id(iK, iV))
 	}
 
 	return
 }
 
+func (m Measurement) id(iK, iV string) string {
+	// We encode the timestamp as a fixed width, big endian, integer so
+	// that every timestamp produces a distinct, unambiguous, id
+	nsBuf := binary.BigEndian.AppendUint64(nil, uint64(m.When.UnixNano()))
+
+	nulBytes := []byte{'\x00'}
+
+	return base64.StdEncoding.EncodeToString(slices.Concat(
+		[]byte(m.Name),
+		nulBytes,
+		[]byte(iK),
+		nulBytes,
+		[]byte(iV),
+		nulBytes,
+		nsBuf,
+		nulBytes,
+	))
+}
+
 func (m Measurement) fields() (f map[string]measurementFieldType, err error) {
 	f = make(map[string]measurementFieldType)
 
@@ -121,6 +337,32 @@ func (m Measurement) fields() (f map[string]measurementFieldType, err error) {
 		f[k] = dimension
 	}
 
+	if m.dimensions32 != nil {
+		for _, k := range m.dimensions32.keys {
+			f[k] = dimension
+		}
+	}
+
+	for k := range m.IntDimensions {
+		if _, ok := f[k]; ok {
+			err = ErrFieldInUse
+
+			return
+		}
+
+		f[k] = intDimension
+	}
+
+	for k := range m.States {
+		if _, ok := f[k]; ok {
+			err = ErrFieldInUse
+
+			return
+		}
+
+		f[k] = state
+	}
+
 	for k := range m.Indices {
 		if _, ok := f[k]; ok {
 			err = ErrFieldInUse
@@ -143,3 +385,15 @@ func (m Measurement) fields() (f map[string]measurementFieldType, err error) {
 
 	return
 }
+
+// checkFieldTypes returns an error wrapping ErrFieldTypeConflict where
+// any field in received has a different type in existing
+func checkFieldTypes(name string, existing, received map[string]measurementFieldType) error {
+	for _, k := range slices.Sorted(maps.Keys(received)) {
+		if t, ok := existing[k]; ok && t != received[k] {
+			return fmt.Errorf("%w: %s.%s is a %s, not a %s", ErrFieldTypeConflict, name, k, t, received[k])
+		}
+	}
+
+	return nil
+}
@@ -4,6 +4,31 @@ const (
 	dimension measurementFieldType = iota
 	label
 	index
+	intDimension
+	state
 )
 
 type measurementFieldType uint8
+
+// String returns the name of a measurementFieldType, as exposed by
+// QueryFieldTypes
+func (t measurementFieldType) String() string {
+	switch t {
+	case dimension:
+		return "dimension"
+
+	case label:
+		return "label"
+
+	case index:
+		return "index"
+
+	case intDimension:
+		return "int_dimension"
+
+	case state:
+		return "state"
+	}
+
+	return "unknown"
+}
@@ -9,15 +9,18 @@ func TestMeasurement_DTS(t *testing.T) {
 	ts := time.Unix(1731874198, 0)
 
 	for _, test := range []struct {
-		name   string
-		when   time.Time
-		expect string
+		name        string
+		when        time.Time
+		granularity Granularity
+		expect      string
 	}{
-		{"empty/ zero timestamp", time.Time{}, "0001-01-01_00"},
-		{"arbitrary timestamp", ts, "2024-11-17_20"},
+		{"empty/ zero timestamp", time.Time{}, GranularityHour, "0001-01-01_00"},
+		{"arbitrary timestamp", ts, GranularityHour, "2024-11-17_20"},
+		{"minute granularity", ts, GranularityMinute, "2024-11-17_20:09"},
+		{"day granularity", ts, GranularityDay, "2024-11-17"},
 	} {
 		t.Run(test.name, func(t *testing.T) {
-			rcvd := Measurement{When: test.when}.dts()
+			rcvd := Measurement{When: test.when}.dts(test.granularity)
 
 			if test.expect != rcvd {
 				t.Errorf("expected %q, received %q", test.expect, rcvd)
@@ -25,3 +28,63 @@ func TestMeasurement_DTS(t *testing.T) {
 		})
 	}
 }
+
+func TestMeasurement_ids(t *testing.T) {
+	for _, ts := range []time.Time{
+		time.Unix(0, 0),
+		time.Unix(1731874198, 0),
+		time.Unix(1731874198, 999_999_999),
+		time.Unix(0, 1<<7-1),
+		time.Unix(0, 1<<14-1),
+		time.Unix(0, 1<<56-1),
+		time.Unix(0, -1),
+	} {
+		t.Run(ts.String(), func(t *testing.T) {
+			seen := make(map[string]time.Time)
+
+			for i := 0; i < 1_000; i++ {
+				when := ts.Add(time.Duration(i))
+
+				ids := Measurement{Name: "test", When: when, Indices: map[string]string{"idx": "value"}}.ids(DedupePerIndex)
+				if len(ids) != 1 {
+					t.Fatalf("expected 1 id, received %d", len(ids))
+				}
+
+				if prev, ok := seen[ids[0]]; ok {
+					t.Fatalf("%s and %s share id %q", prev, when, ids[0])
+				}
+
+				seen[ids[0]] = when
+			}
+		})
+	}
+}
+
+func TestMeasurement_ids_strategies(t *testing.T) {
+	m := Measurement{Name: "test", When: time.Unix(1731874198, 0), Indices: map[string]string{"host": "a", "region": "eu"}}
+	single := Measurement{Name: "test", When: time.Unix(1731874198, 0), Indices: map[string]string{"host": "a"}}
+
+	for _, test := range []struct {
+		name        string
+		strategy    DedupeStrategy
+		expectCount int
+	}{
+		{"per index produces an id per index", DedupePerIndex, 2},
+		{"all indices produces a single id", DedupeAllIndices, 1},
+		{"timestamp produces a single id", DedupeTimestamp, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ids := m.ids(test.strategy)
+			if test.expectCount != len(ids) {
+				t.Errorf("expected %d ids, received %d", test.expectCount, len(ids))
+			}
+		})
+	}
+
+	t.Run("single indices produce the same id for per index and all indices", func(t *testing.T) {
+		perIndex, allIndices := single.ids(DedupePerIndex), single.ids(DedupeAllIndices)
+		if perIndex[0] != allIndices[0] {
+			t.Errorf("expected %q, received %q", perIndex[0], allIndices[0])
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package jdb
+
+//go:generate protoc --go_out=. --go_opt=module=github.com/jspc/jdb measurement.proto
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/jspc/jdb/jdbpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrInvalidProto returns when UnmarshalProto is passed bytes which aren't
+// a valid protobuf encoding of the Measurements message
+var ErrInvalidProto = errors.New("invalid protobuf encoding")
+
+// QueryAllProto works identically to `QueryAll` but returns Measurements as a
+// protobuf encoded `Measurements` message, as defined in measurement.proto.
+//
+// Within this encoding `When` is represented as nanoseconds since the unix epoch, and
+// the various maps are encoded as protobuf maps with their keys sorted, so that output
+// is deterministic.
+//
+// This is useful when serving data from jdb to other services, such as behind a gRPC
+// API, where protobuf is both more compact and quicker to decode than JSON or CSV.
+func (j *JDB) QueryAllProto(name string, opts *Options) (b []byte, err error) {
+	measurements, err := j.QueryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	pb := &jdbpb.Measurements{
+		Measurements: make([]*jdbpb.Measurement, len(measurements)),
+	}
+
+	for i, m := range measurements {
+		pb.Measurements[i] = &jdbpb.Measurement{
+			When:          m.When.UnixNano(),
+			Name:          m.Name,
+			Dimensions:    m.Dimensions,
+			Labels:        m.Labels,
+			Indices:       m.Indices,
+			IntDimensions: m.IntDimensions,
+			States:        m.States,
+		}
+	}
+
+	return proto.MarshalOptions{Deterministic: true}.Marshal(pb)
+}
+
+// UnmarshalProto decodes the output of `QueryAllProto` back into Measurements.
+//
+// Unknown fields are skipped, as per the protobuf spec, so that this function
+// remains compatible with future additions to measurement.proto
+func UnmarshalProto(b []byte) (m []*Measurement, err error) {
+	pb := new(jdbpb.Measurements)
+
+	err = proto.Unmarshal(b, pb)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProto, err)
+	}
+
+	m = make([]*Measurement, len(pb.GetMeasurements()))
+	for i, measurement := range pb.GetMeasurements() {
+		m[i] = &Measurement{
+			When:          time.Unix(0, measurement.GetWhen()),
+			Name:          measurement.GetName(),
+			Dimensions:    make(map[string]float64, len(measurement.GetDimensions())),
+			Labels:        make(map[string]string, len(measurement.GetLabels())),
+			Indices:       make(map[string]string, len(measurement.GetIndices())),
+			IntDimensions: measurement.GetIntDimensions(),
+			States:        measurement.GetStates(),
+		}
+
+		maps.Copy(m[i].Dimensions, measurement.GetDimensions())
+		maps.Copy(m[i].Labels, measurement.GetLabels())
+		maps.Copy(m[i].Indices, measurement.GetIndices())
+	}
+
+	return
+}
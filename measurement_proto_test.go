@@ -0,0 +1,230 @@
+package jdb_test
+
+import (
+	"maps"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+	"github.com/jspc/jdb/jdbpb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestJDB_QueryAllProto(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i * 17),
+			},
+			Indices: map[string]string{
+				"wibbler": "0xabadbabe",
+			},
+			States: map[string]bool{
+				"wibbling": i%2 == 0,
+			},
+			Labels: map[string]string{
+				"version": "v0.1.1",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		expectCount int
+		expectErr   bool
+	}{
+		{"Querying non-existent measurement should fail", "floops", 0, true},
+		{"Querying valid measurement round trips", "wibbles", 10, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := db.QueryAllProto(test.measurement, nil)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			m, err := jdb.UnmarshalProto(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Fatalf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+
+			for i, rcvd := range m {
+				if !rcvd.When.Equal(now.Add(time.Minute * time.Duration(i))) {
+					t.Errorf("%d: unexpected timestamp %s", i, rcvd.When)
+				}
+
+				if rcvd.Dimensions["wobble_count"] != float64(i*17) {
+					t.Errorf("%d: expected %d, received %f", i, i*17, rcvd.Dimensions["wobble_count"])
+				}
+
+				if rcvd.Indices["wibbler"] != "0xabadbabe" {
+					t.Errorf("%d: unexpected index value %q", i, rcvd.Indices["wibbler"])
+				}
+
+				if rcvd.Labels["version"] != "v0.1.1" {
+					t.Errorf("%d: unexpected label value %q", i, rcvd.Labels["version"])
+				}
+
+				if v, ok := rcvd.States["wibbling"]; !ok || v != (i%2 == 0) {
+					t.Errorf("%d: expected %v, received %v (ok: %v)", i, i%2 == 0, v, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestUnmarshalProto(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		b           []byte
+		expectCount int
+		expectErr   bool
+	}{
+		{"Empty input returns no measurements", []byte{}, 0, false},
+		{"Truncated input fails", []byte{0x0a, 0x05, 0x08}, 0, true},
+		{"Unknown wire types fail", []byte{0x0f}, 0, true},
+		{"Hand encoded measurement decodes", []byte{0x0a, 0x05, 0x08, 0x01, 0x12, 0x01, 'a'}, 1, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := jdb.UnmarshalProto(test.b)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if !test.expectErr && test.expectCount != len(m) {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+		})
+	}
+
+	t.Run("Encoding matches the protobuf wire format", func(t *testing.T) {
+		m, err := jdb.UnmarshalProto([]byte{0x0a, 0x05, 0x08, 0x01, 0x12, 0x01, 'a'})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m[0].Name != "a" || m[0].When.UnixNano() != 1 {
+			t.Errorf("unexpected measurement %#v", m[0])
+		}
+	})
+}
+
+func TestProto_RoundTrip(t *testing.T) {
+	now := time.Now().Round(0)
+
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	expect := &jdb.Measurement{
+		Name:          "wibbles",
+		When:          now,
+		Dimensions:    map[string]float64{"wobble_count": 17.5},
+		IntDimensions: map[string]int64{"wobble_total": -1 << 60},
+		States:        map[string]bool{"wibbling": true, "wobbling": false},
+		Labels:        map[string]string{"version": "v0.1.1"},
+		Indices:       map[string]string{"wibbler": "0xabadbabe"},
+	}
+
+	err = db.Insert(expect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Output decodes with the protobuf runtime", func(t *testing.T) {
+		b, err := db.QueryAllProto("wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pb := new(jdbpb.Measurements)
+
+		err = proto.Unmarshal(b, pb)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(pb.Measurements) != 1 {
+			t.Fatalf("expected 1 measurements, received %d", len(pb.Measurements))
+		}
+
+		rcvd := pb.Measurements[0]
+		if rcvd.When != now.UnixNano() || rcvd.Name != expect.Name {
+			t.Errorf("expected %v and %q, received %v and %q", now.UnixNano(), expect.Name, rcvd.When, rcvd.Name)
+		}
+
+		if !maps.Equal(expect.Dimensions, rcvd.Dimensions) ||
+			!maps.Equal(expect.IntDimensions, rcvd.IntDimensions) ||
+			!maps.Equal(expect.States, rcvd.States) ||
+			!maps.Equal(expect.Labels, rcvd.Labels) ||
+			!maps.Equal(expect.Indices, rcvd.Indices) {
+			t.Errorf("expected %#v, received %#v", expect, rcvd)
+		}
+	})
+
+	t.Run("Output of the protobuf runtime decodes", func(t *testing.T) {
+		b, err := proto.Marshal(&jdbpb.Measurements{
+			Measurements: []*jdbpb.Measurement{{
+				When:          now.UnixNano(),
+				Name:          expect.Name,
+				Dimensions:    expect.Dimensions,
+				IntDimensions: expect.IntDimensions,
+				States:        expect.States,
+				Labels:        expect.Labels,
+				Indices:       expect.Indices,
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := jdb.UnmarshalProto(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 1 {
+			t.Fatalf("expected 1 measurements, received %d", len(m))
+		}
+
+		rcvd := m[0]
+		if !rcvd.When.Equal(now) || rcvd.Name != expect.Name {
+			t.Errorf("expected %v and %q, received %v and %q", now, expect.Name, rcvd.When, rcvd.Name)
+		}
+
+		if !maps.Equal(expect.Dimensions, rcvd.Dimensions) ||
+			!maps.Equal(expect.IntDimensions, rcvd.IntDimensions) ||
+			!maps.Equal(expect.States, rcvd.States) ||
+			!maps.Equal(expect.Labels, rcvd.Labels) ||
+			!maps.Equal(expect.Indices, rcvd.Indices) {
+			t.Errorf("expected %#v, received %#v", expect, rcvd)
+		}
+	})
+}
@@ -1,7 +1,11 @@
 package jdb_test
 
 import (
+	"errors"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jspc/jdb"
 )
@@ -14,7 +18,23 @@ func TestMeasurement_Validate(t *testing.T) {
 	}{
 		{"Empty measurement name should fail", jdb.Measurement{}, true},
 		{"Empty dimensions should fail", jdb.Measurement{Name: "My Measurement"}, true},
+		{"Dimensions in both Dimensions and IntDimensions should fail", jdb.Measurement{Name: "My Measurement", Dimensions: map[string]float64{"counter": 100}, IntDimensions: map[string]int64{"counter": 100}}, true},
+		{"NaN dimensions should fail", jdb.Measurement{Name: "My Measurement", Dimensions: map[string]float64{"counter": math.NaN()}}, true},
+		{"Positive infinity dimensions should fail", jdb.Measurement{Name: "My Measurement", Dimensions: map[string]float64{"counter": math.Inf(1)}}, true},
+		{"Negative infinity dimensions should fail", jdb.Measurement{Name: "My Measurement", Dimensions: map[string]float64{"counter": math.Inf(-1)}}, true},
 		{"When specified fields are set, validation succedes", jdb.Measurement{Name: "My Measurement", Dimensions: map[string]float64{"counter": 100}}, false},
+		{"When only IntDimensions are set, validation succedes", jdb.Measurement{Name: "My Measurement", IntDimensions: map[string]int64{"counter": 100}}, false},
+		{"States in Dimensions too should fail", jdb.Measurement{Name: "My Measurement", Dimensions: map[string]float64{"running": 1}, States: map[string]bool{"running": true}}, true},
+		{"States in IntDimensions too should fail", jdb.Measurement{Name: "My Measurement", IntDimensions: map[string]int64{"running": 1}, States: map[string]bool{"running": true}}, true},
+		{"When only States are set, validation succedes", jdb.Measurement{Name: "My Measurement", States: map[string]bool{"running": true}}, false},
+		{"Names containing NUL should fail", jdb.Measurement{Name: "My\x00Measurement", Dimensions: map[string]float64{"counter": 100}}, true},
+		{"Names containing control characters should fail", jdb.Measurement{Name: "My\nMeasurement", Dimensions: map[string]float64{"counter": 100}}, true},
+		{"Overly long names should fail", jdb.Measurement{Name: strings.Repeat("a", jdb.MaxNameLength+1), Dimensions: map[string]float64{"counter": 100}}, true},
+		{"Names of MaxNameLength succeed", jdb.Measurement{Name: strings.Repeat("a", jdb.MaxNameLength), Dimensions: map[string]float64{"counter": 100}}, false},
+		{"Dimension names containing NUL should fail", jdb.Measurement{Name: "My Measurement", Dimensions: map[string]float64{"count\x00er": 100}}, true},
+		{"Label names containing control characters should fail", jdb.Measurement{Name: "My Measurement", Dimensions: map[string]float64{"counter": 100}, Labels: map[string]string{"\tlabel": "value"}}, true},
+		{"Overly long index names should fail", jdb.Measurement{Name: "My Measurement", Dimensions: map[string]float64{"counter": 100}, Indices: map[string]string{strings.Repeat("i", jdb.MaxNameLength+1): "value"}}, true},
+		{"Non-ASCII names succeed", jdb.Measurement{Name: "Température", Dimensions: map[string]float64{"°C": 21}}, false},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			err := test.m.Validate()
@@ -25,3 +45,62 @@ func TestMeasurement_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestMeasurement_Validate_MaxNameLength(t *testing.T) {
+	defer func(l int) {
+		jdb.MaxNameLength = l
+	}(jdb.MaxNameLength)
+
+	m := func() *jdb.Measurement {
+		return &jdb.Measurement{Name: strings.Repeat("a", 10), Dimensions: map[string]float64{"counter": 100}}
+	}
+
+	jdb.MaxNameLength = 5
+
+	err := m().Validate()
+	if !errors.Is(err, jdb.ErrInvalidName) {
+		t.Errorf("expected %#v, received %#v", jdb.ErrInvalidName, err)
+	}
+
+	jdb.MaxNameLength = 0
+
+	err = m().Validate()
+	if err != nil {
+		t.Errorf("unexpected error: %#v", err)
+	}
+}
+
+func TestMeasurement_Validate_When(t *testing.T) {
+	epoch := time.Unix(0, 0)
+
+	for _, test := range []struct {
+		name      string
+		when      time.Time
+		expectNow bool
+	}{
+		{"Zero timestamps are set to now", time.Time{}, true},
+		{"Explicit timestamps are kept", epoch, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := jdb.Measurement{Name: "My Measurement", When: test.when, Dimensions: map[string]float64{"counter": 100}}
+
+			err := m.Validate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectNow && time.Since(m.When) > time.Minute {
+				t.Errorf("expected a recent timestamp, received %v", m.When)
+			}
+
+			// Monotonic clock readings would otherwise leak into == comparisons
+			if test.expectNow && m.When != m.When.Round(0) {
+				t.Errorf("expected a timestamp without a monotonic clock reading, received %v", m.When)
+			}
+
+			if !test.expectNow && !test.when.Equal(m.When) {
+				t.Errorf("expected: %v, received %v", test.when, m.When)
+			}
+		})
+	}
+}
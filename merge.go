@@ -0,0 +1,169 @@
+package jdb
+
+import (
+	"maps"
+	"os"
+	"slices"
+)
+
+// Merge inserts every Measurement from other into this database, such as when
+// consolidating data collected on several devices, returning the number of
+// Measurements inserted, and the number skipped.
+//
+// Measurements which already exist in this database, by id, are skipped rather
+// than causing an error, so that merging the same data twice is harmless. Only
+// the latest version of upserted Measurements is merged.
+//
+// Where a Measurement from other has fields which conflict with the types of
+// existing fields, Merge returns an error wrapping ErrFieldTypeConflict, and
+// nothing is inserted
+func (j *JDB) Merge(other *JDB) (inserted, skipped int, err error) {
+	// Gather everything from other before taking our own lock, so that
+	// merging a database into itself doesn't deadlock
+	other.saveMutex.RLock()
+
+	incoming := make([]*Measurement, 0)
+	err = other.liveMeasurements(func(m *Measurement) error {
+		incoming = append(incoming, expand(m.clone()))
+
+		return nil
+	})
+
+	other.saveMutex.RUnlock()
+
+	if err != nil {
+		return
+	}
+
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		err = ErrReadOnly
+
+		return
+	}
+
+	toInsert := make([]*Measurement, 0, len(incoming))
+	ids := make([][]string, 0, len(incoming))
+	fields := make([]map[string]measurementFieldType, 0, len(incoming))
+	batchFields := make(map[string]map[string]measurementFieldType)
+	seen := make(map[string]bool)
+
+	for _, m := range incoming {
+		j.shrink(m)
+
+		mIDs := m.ids(j.dedupe)
+		if slices.ContainsFunc(mIDs, func(id string) bool {
+			_, ok := j.ids[id]
+
+			return ok || seen[id]
+		}) {
+			skipped++
+
+			continue
+		}
+
+		var mFields map[string]measurementFieldType
+
+		mFields, err = m.fields()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for _, existing := range []map[string]measurementFieldType{j.measurementFields[m.Name], batchFields[m.Name]} {
+			err = checkFieldTypes(m.Name, existing, mFields)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+
+		if _, ok := batchFields[m.Name]; !ok {
+			batchFields[m.Name] = make(map[string]measurementFieldType)
+		}
+
+		maps.Copy(batchFields[m.Name], mFields)
+
+		for _, id := range mIDs {
+			seen[id] = true
+		}
+
+		toInsert = append(toInsert, m)
+		ids = append(ids, mIDs)
+		fields = append(fields, mFields)
+	}
+
+	affected := make(map[shardKey]bool)
+	for i, m := range toInsert {
+		j.addMeasurement(m, ids[i], fields[i])
+
+		for _, k := range j.shardKeys(m) {
+			affected[k] = true
+		}
+	}
+
+	j.saveBuffer = append(j.saveBuffer, toInsert...)
+	j.sortShards(slices.Collect(maps.Keys(affected)))
+	j.evictOldest(toInsert...)
+
+	return len(toInsert), skipped, j.maybeFlush()
+}
+
+// MergeFiles merges the database files at srcs into the database file at dst, as
+// per `Merge`, creating dst if it doesn't already exist.
+//
+// This is a convenience for batch jobs consolidating several databases at once.
+// Unlike dst, each of srcs must already exist. Sources are opened with `OpenReadOnly`,
+// and so are never written to, and can be merged while another process has them open.
+//
+// Where either the sources or the destination need options, such as an encryption
+// key, use `MergeFilesWithOptions`
+func MergeFiles(dst string, srcs ...string) error {
+	return MergeFilesWithOptions(dst, srcs, nil)
+}
+
+// MergeFilesWithOptions works identically to `MergeFiles`, but additionally accepts
+// srcOpts, which configure how every source is opened, such as `WithEncryptionKey`
+// for encrypted sources, and dstOpts, which configure the destination database
+func MergeFilesWithOptions(dst string, srcs []string, srcOpts []OpenOption, dstOpts ...OpenOption) (err error) {
+	for _, src := range srcs {
+		_, err = os.Stat(src)
+		if err != nil {
+			return
+		}
+	}
+
+	d, err := New(dst, dstOpts...)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		closeErr := d.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	for _, src := range srcs {
+		var s *JDB
+
+		s, err = OpenReadOnly(src, srcOpts...)
+		if err != nil {
+			return
+		}
+
+		_, _, err = d.Merge(s)
+
+		closeErr := s.Close()
+		if err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
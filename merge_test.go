@@ -0,0 +1,265 @@
+package jdb_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func mergeSource(t *testing.T, start time.Time, count int) *jdb.JDB {
+	t.Helper()
+
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < count; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+			Indices:    map[string]string{"sensor": "a"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+func TestJDB_Merge(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+
+	for _, test := range []struct {
+		name           string
+		dst            *jdb.JDB
+		src            *jdb.JDB
+		expectInserted int
+		expectSkipped  int
+		expectTotal    int
+		expectErr      error
+	}{
+		{"Merging into an empty database inserts everything", mergeSource(t, start, 0), mergeSource(t, start, 10), 10, 0, 10, nil},
+		{"Merging overlapping databases skips duplicates", mergeSource(t, start, 5), mergeSource(t, start, 10), 5, 5, 10, nil},
+		{"Merging identical databases inserts nothing", mergeSource(t, start, 10), mergeSource(t, start, 10), 0, 10, 10, nil},
+		{"Merging an empty database inserts nothing", mergeSource(t, start, 10), mergeSource(t, start, 0), 0, 0, 10, nil},
+		{"Conflicting field types fail", mergeSource(t, start, 5), func() *jdb.JDB {
+			db := mergeSource(t, start, 0)
+
+			err := db.Insert(&jdb.Measurement{
+				Name:       "wibbles",
+				When:       start.Add(time.Hour),
+				Dimensions: map[string]float64{"wobble_count": 1},
+				Labels:     map[string]string{"sensor": "b"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return db
+		}(), 0, 0, 5, jdb.ErrFieldTypeConflict},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			inserted, skipped, err := test.dst.Merge(test.src)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectInserted != inserted {
+				t.Errorf("expected %d inserted, received %d", test.expectInserted, inserted)
+			}
+
+			if test.expectSkipped != skipped {
+				t.Errorf("expected %d skipped, received %d", test.expectSkipped, skipped)
+			}
+
+			m, err := test.dst.QueryAll("wibbles", nil)
+			if err != nil && !errors.Is(err, jdb.ErrNoSuchMeasurement) {
+				t.Fatal(err)
+			}
+
+			if test.expectTotal != len(m) {
+				t.Errorf("expected %d measurements, received %d", test.expectTotal, len(m))
+			}
+		})
+	}
+
+	t.Run("Merging a database into itself inserts nothing", func(t *testing.T) {
+		db := mergeSource(t, start, 5)
+
+		inserted, skipped, err := db.Merge(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if inserted != 0 || skipped != 5 {
+			t.Errorf("expected 0 inserted and 5 skipped, received %d and %d", inserted, skipped)
+		}
+	})
+}
+
+func TestMergeFiles(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+
+	srcs := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		f, err := os.CreateTemp("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		db, err := jdb.New(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Each source overlaps the next by 5 measurements
+		for j := 0; j < 10; j++ {
+			err = db.Insert(&jdb.Measurement{
+				Name:       "wibbles",
+				When:       start.Add(time.Minute * time.Duration(i*5+j)),
+				Dimensions: map[string]float64{"wobble_count": float64(j)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srcs = append(srcs, f.Name())
+	}
+
+	dst, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst.Close()
+
+	t.Run("Missing sources fail", func(t *testing.T) {
+		err := jdb.MergeFiles(dst.Name(), append(srcs, "/this/file/does/not/exist")...)
+		if err == nil {
+			t.Error("expected error, received none")
+		}
+	})
+
+	t.Run("Merging files writes every unique measurement", func(t *testing.T) {
+		err := jdb.MergeFiles(dst.Name(), srcs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := jdb.New(dst.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		m, err := db.QueryAll("wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 20 {
+			t.Errorf("expected %d measurements, received %d", 20, len(m))
+		}
+	})
+}
+
+func TestMergeFilesWithOptions(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 32)
+	start := time.Now().Add(-time.Hour)
+
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Keep the source open, and so locked, throughout
+	src, err := jdb.New(f.Name(), jdb.WithEncryptionKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer src.Close()
+
+	for i := 0; i < 10; i++ {
+		err = src.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = src.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst.Close()
+
+	t.Run("Encrypted sources fail without a key", func(t *testing.T) {
+		err := jdb.MergeFiles(dst.Name(), f.Name())
+		if err == nil {
+			t.Error("expected error, received none")
+		}
+	})
+
+	t.Run("Locked, encrypted, sources can be merged with a key", func(t *testing.T) {
+		err := jdb.MergeFilesWithOptions(dst.Name(), []string{f.Name()}, []jdb.OpenOption{jdb.WithEncryptionKey(key)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := jdb.New(dst.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		m, err := db.QueryAll("wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 10 {
+			t.Errorf("expected %d measurements, received %d", 10, len(m))
+		}
+	})
+
+	t.Run("Sources are never written to", func(t *testing.T) {
+		after, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(before, after) {
+			t.Error("expected source file to be untouched")
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package jdb
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+)
+
+// ErrNoSuchField returns when trying to set metadata for a field which
+// doesn't exist for the specified Measurement
+var ErrNoSuchField = errors.New("unknown field")
+
+// fieldMetadataPrefix marks a line in a database file as field metadata, rather
+// than a Measurement. As with headerPrefix, '@' isn't in the base64 alphabet,
+// and so can't be mistaken for a Measurement
+const fieldMetadataPrefix = '@'
+
+// FieldMeta describes a field of a Measurement, such as the unit a dimension
+// is measured in, for the sake of self-documenting exports
+type FieldMeta struct {
+	// Unit is the unit a field is measured in, such as "celsius" or "bytes"
+	Unit string `json:"unit,omitempty"`
+
+	// Description is a human readable description of a field
+	Description string `json:"description,omitempty"`
+}
+
+// help returns a description of a field suitable for a Prometheus HELP
+// line, such as "Room temperature (celsius)"
+func (f FieldMeta) help() string {
+	switch {
+	case f.Unit == "":
+		return f.Description
+
+	case f.Description == "":
+		return "(" + f.Unit + ")"
+
+	default:
+		return f.Description + " (" + f.Unit + ")"
+	}
+}
+
+// fieldMetadata is how FieldMeta is persisted to disk
+type fieldMetadata struct {
+	Name  string    `json:"name"`
+	Field string    `json:"field"`
+	Meta  FieldMeta `json:"meta"`
+}
+
+// SetFieldMetadata attaches metadata, such as a unit, to a field of a Measurement,
+// replacing any metadata previously set for that field.
+//
+// Metadata is used by `WriteCSV` (where `CSVOptions.Units` is set) and by
+// `WritePrometheus` to describe fields, and is persisted immediately to the database
+// file so that it survives reopening the database.
+//
+// SetFieldMetadata returns ErrNoSuchMeasurement or ErrNoSuchField where either
+// haven't been inserted yet
+func (j *JDB) SetFieldMetadata(name, field string, meta FieldMeta) (err error) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		return ErrReadOnly
+	}
+
+	fields, ok := j.measurementFields[name]
+	if !ok {
+		return ErrNoSuchMeasurement
+	}
+
+	if _, ok = fields[field]; !ok {
+		return ErrNoSuchField
+	}
+
+	j.setFieldMetadata(name, field, meta)
+
+	if j.store == nil {
+		return
+	}
+
+	err = j.checkStore()
+	if err != nil {
+		return
+	}
+
+	return j.writeFieldMetadata(j.store, name, field, meta)
+}
+
+// FieldMetadata returns the metadata set for a field of a Measurement, as per
+// `SetFieldMetadata`. Fields without metadata return an empty FieldMeta.
+//
+// FieldMetadata returns ErrNoSuchMeasurement or ErrNoSuchField where either
+// haven't been inserted yet
+func (j *JDB) FieldMetadata(name, field string) (meta FieldMeta, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	fields, ok := j.measurementFields[name]
+	if !ok {
+		return meta, ErrNoSuchMeasurement
+	}
+
+	if _, ok = fields[field]; !ok {
+		return meta, ErrNoSuchField
+	}
+
+	return j.fieldMeta[name][field], nil
+}
+
+// setFieldMetadata stores metadata in memory. Callers must hold saveMutex
+func (j *JDB) setFieldMetadata(name, field string, meta FieldMeta) {
+	// Transform scans files with a bare JDB, and so this may not have
+	// been initialised
+	if j.fieldMeta == nil {
+		j.fieldMeta = make(map[string]map[string]FieldMeta)
+	}
+
+	if _, ok := j.fieldMeta[name]; !ok {
+		j.fieldMeta[name] = make(map[string]FieldMeta)
+	}
+
+	j.fieldMeta[name][field] = meta
+}
+
+// isFieldMetadata returns true when a line from a database file is
+// field metadata
+func isFieldMetadata(line []byte) bool {
+	return len(line) > 0 && line[0] == fieldMetadataPrefix
+}
+
+// readFieldMetadata parses a line written by writeFieldMetadata, storing the
+// metadata within. Where a field has several metadata lines, the last wins
+func (j *JDB) readFieldMetadata(line []byte) (err error) {
+	b, err := j.decodeLine(line[1:])
+	if err != nil {
+		return
+	}
+
+	fm := new(fieldMetadata)
+
+	err = json.Unmarshal(b, fm)
+	if err != nil {
+		return
+	}
+
+	j.setFieldMetadata(fm.Name, fm.Field, fm.Meta)
+
+	return
+}
+
+// writeFieldMetadata writes metadata to w, encoded in the same way as
+// Measurements, and prefixed with fieldMetadataPrefix
+func (j *JDB) writeFieldMetadata(w io.Writer, name, field string, meta FieldMeta) (err error) {
+	b, err := json.Marshal(fieldMetadata{Name: name, Field: field, Meta: meta})
+	if err != nil {
+		return
+	}
+
+	line, err := j.encodeLine(b)
+	if err != nil {
+		return
+	}
+
+	_, err = w.Write(append([]byte{fieldMetadataPrefix}, line...))
+
+	return
+}
+
+// writeAllFieldMetadata writes every piece of metadata to w, such as when
+// rewriting the database file
+func (j *JDB) writeAllFieldMetadata(w io.Writer) (err error) {
+	for _, name := range slices.Sorted(maps.Keys(j.fieldMeta)) {
+		for _, field := range slices.Sorted(maps.Keys(j.fieldMeta[name])) {
+			err = j.writeFieldMetadata(w, name, field, j.fieldMeta[name][field])
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
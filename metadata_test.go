@@ -0,0 +1,142 @@
+package jdb_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_SetFieldMetadata(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	key := bytes.Repeat([]byte{'k'}, 32)
+
+	db, err := jdb.New(f.Name(), jdb.WithEncryptionKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.UnixMilli(1556813561098)
+	for i := 0; i < 5; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "environment",
+			When:       now.Add(0 - time.Minute*time.Duration(i)),
+			Dimensions: map[string]float64{"temperature": float64(i), "humidity": 50},
+			Indices:    map[string]string{"location": "kitchen"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	celsius := jdb.FieldMeta{Unit: "celsius", Description: "Room temperature"}
+
+	for _, test := range []struct {
+		name      string
+		mName     string
+		field     string
+		meta      jdb.FieldMeta
+		expectErr error
+	}{
+		{"Unknown measurements fail", "zimzams", "temperature", celsius, jdb.ErrNoSuchMeasurement},
+		{"Unknown fields fail", "environment", "pressure", celsius, jdb.ErrNoSuchField},
+		{"Known fields succeed", "environment", "temperature", jdb.FieldMeta{Unit: "fahrenheit"}, nil},
+		{"Setting metadata again replaces it", "environment", "temperature", celsius, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := db.SetFieldMetadata(test.mName, test.field, test.meta)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+		})
+	}
+
+	t.Run("CSV headers include units", func(t *testing.T) {
+		b, err := db.QueryAllCSV("environment", &jdb.Options{CSV: jdb.CSVOptions{Units: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := "timestamp,measure,humidity,location,temperature (celsius)\n"
+		if header, _, _ := strings.Cut(string(b), "\n"); header+"\n" != expect {
+			t.Errorf("expected: %q, received %q", expect, header)
+		}
+	})
+
+	t.Run("Prometheus output includes HELP lines", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+
+		err := db.WritePrometheus(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := "# HELP environment_temperature Room temperature (celsius)\n# TYPE environment_temperature gauge\n"
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("expected output to contain %q, received %q", expect, buf.String())
+		}
+
+		if strings.Contains(buf.String(), "# HELP environment_humidity") {
+			t.Errorf("expected no HELP line for humidity, received %q", buf.String())
+		}
+	})
+
+	for _, test := range []struct {
+		name    string
+		compact bool
+	}{
+		{"Metadata survives reopening", false},
+		{"Metadata survives compaction", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.compact {
+				err := db.Compact()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := db.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err = jdb.New(f.Name(), jdb.WithEncryptionKey(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			meta, err := db.FieldMetadata("environment", "temperature")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if meta != celsius {
+				t.Errorf("expected: %#v, received %#v", celsius, meta)
+			}
+
+			m, err := db.QueryAll("environment", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m) != 5 {
+				t.Errorf("expected %d measurements, received %d", 5, len(m))
+			}
+		})
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,50 @@
+package jdb
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// WriteNDJSON writes the Measurements returned by `QueryAll` to w as newline delimited
+// JSON, with one JSON Measurement per line, which makes it easy to pipe data into
+// `jq` and other JSON tooling.
+//
+// This is distinct from the database file format, which wraps each line in base64 (and
+// optionally compression and encryption) unless `WithPlainJSON` is set, and shouldn't be
+// loaded by `New`; use `Backup` to export data for reloading.
+//
+// As with WriteCSV, the lock is only held while gathering data, and opts is honoured
+// in the same way as QueryAll, including Limit and Offset
+func (j *JDB) WriteNDJSON(w io.Writer, name string, opts *Options) (err error) {
+	start := time.Now()
+
+	j.saveMutex.RLock()
+
+	measurements, err := j.queryAll(name, opts)
+
+	defer logSlowQuery("WriteNDJSON", name, opts, start, &measurements)
+
+	j.saveMutex.RUnlock()
+
+	if err != nil {
+		return
+	}
+
+	if opts != nil {
+		measurements = opts.paginate(measurements)
+	}
+
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+
+	for _, m := range measurements {
+		err = enc.Encode(m)
+		if err != nil {
+			return
+		}
+	}
+
+	return buf.Flush()
+}
@@ -0,0 +1,83 @@
+package jdb_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_WriteNDJSON(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	start := time.Now().Add(0 - time.Hour).Truncate(time.Minute)
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+			Indices:    map[string]string{"sensor": "a"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		opts        *jdb.Options
+		expectCount int
+		expectFirst float64
+		expectErr   error
+	}{
+		{"Unknown measurements fail", "zimzams", nil, 0, 0, jdb.ErrNoSuchMeasurement},
+		{"Every measurement is written", "wibbles", nil, 10, 0, nil},
+		{"Time ranges are honoured", "wibbles", &jdb.Options{From: start.Add(time.Minute * 4), To: start.Add(time.Minute * 6)}, 3, 4, nil},
+		{"Pagination is honoured", "wibbles", &jdb.Options{Offset: 2, Limit: 5}, 5, 2, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+
+			err := db.WriteNDJSON(buf, test.measurement, test.opts)
+			if !errors.Is(err, test.expectErr) {
+				t.Fatalf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectErr != nil {
+				return
+			}
+
+			m := make([]*jdb.Measurement, 0)
+
+			scanner := bufio.NewScanner(buf)
+			for scanner.Scan() {
+				rcvd := new(jdb.Measurement)
+
+				err = json.Unmarshal(scanner.Bytes(), rcvd)
+				if err != nil {
+					t.Fatalf("line %d is not a json Measurement: %v", len(m)+1, err)
+				}
+
+				m = append(m, rcvd)
+			}
+
+			if test.expectCount != len(m) {
+				t.Fatalf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+
+			if m[0].Dimensions["wobble_count"] != test.expectFirst {
+				t.Errorf("expected: %v, received %v", test.expectFirst, m[0].Dimensions["wobble_count"])
+			}
+		})
+	}
+}
@@ -1,9 +1,20 @@
 package jdb
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"time"
 )
 
+// ErrInvalidOptions returns from Query* functions when passed Options which
+// contradict themselves, such as From being after To, and so could never
+// match anything.
+//
+// Returned errors wrap ErrInvalidOptions with details of the contradiction, and
+// so should be checked with errors.Is
+var ErrInvalidOptions = errors.New("invalid options")
+
 // Options can be passed to Query* functions on Database
 // and allow for slicing Measurements based on timestamps
 // according to the rules below
@@ -17,7 +28,9 @@ type Options struct {
 	// and To is set then From implies "All data from the start of time"
 	From time.Time `json:"from" form:"from"`
 
-	// To defines the latest timestamp to return Measurements for.
+	// To defines the latest timestamp to return Measurements for. As
+	// with From, it is inclusive.
+	//
 	// Similarly to From, if this field is empty and From is set, then
 	// the implication is "All records from `From` to the end".
 	//
@@ -42,39 +55,209 @@ type Options struct {
 	// know that you're likely to have reused the same measure+timestamp+index
 	// combination, and you don't want to have to deduplicate yourself
 	Deduplicate bool `json:"deduplicate" form:"deduplicate"`
+
+	// DeduplicateKeep decides which of a set of duplicates is kept when
+	// Deduplicate is set; by default, the latest version of a Measurement,
+	// as per `Upsert`, though the earliest can be kept instead, such as
+	// for auditing what was first recorded (see KeepEarliest for caveats)
+	DeduplicateKeep DedupeKeep `json:"deduplicate_keep" form:"deduplicate_keep"`
+
+	// Limit caps the number of Measurements returned, for paging through large
+	// results, and is applied after Offset. Zero means no limit.
+	//
+	// Limit and Offset are honoured by `QueryAll`, `QueryAllIndex`, `QueryAllIndexIn`,
+	// `QueryAllPaged`, `QueryAllProto`, `QueryWithStats`, `QueryMany`, `WriteNDJSON`,
+	// and the CSV functions, and are ignored elsewhere, such as by aggregations and TopK
+	Limit int `json:"limit" form:"limit"`
+
+	// Offset skips this many Measurements, after time slicing and deduplication,
+	// before applying Limit
+	Offset int `json:"offset" form:"offset"`
+
+	// DimensionFilters restricts results to Measurements whose dimensions fall
+	// within a DimRange, keyed by dimension name, such as only those where
+	// temperature is above 30. Measurements must match every filter, and
+	// Measurements without a filtered dimension are excluded.
+	//
+	// Filters are applied after time slicing, and are a linear scan of every
+	// Measurement in range, rather than an index; they save returning and
+	// filtering results, but not the cost of visiting them. Filters are ignored
+	// by `QueryNearest`
+	DimensionFilters map[string]DimRange `json:"dimension_filters" form:"dimension_filters"`
+
+	// CSV controls the formatting of output from the CSV functions, such
+	// as `QueryAllCSV` and `WriteCSV`, and is ignored elsewhere
+	CSV CSVOptions `json:"csv" form:"csv"`
+}
+
+// DimRange is an inclusive range of values for a dimension, as used by
+// Options.DimensionFilters. A nil Min or Max leaves that side of the range
+// unbounded, such that `DimRange{Min: &thirty}` matches any value of 30 or more
+type DimRange struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// contains returns true when v sits within this DimRange
+func (d DimRange) contains(v float64) bool {
+	return (d.Min == nil || v >= *d.Min) && (d.Max == nil || v <= *d.Max)
+}
+
+// DedupeKeep decides which version of a Measurement deduplicated queries
+// return, as per Options.DeduplicateKeep
+type DedupeKeep int
+
+const (
+	// KeepLatest returns the most recently written version of a Measurement,
+	// which is to say the one which replaced the others via `Upsert`. This is
+	// the default
+	KeepLatest DedupeKeep = iota
+
+	// KeepEarliest returns the first version of a Measurement written,
+	// ignoring anything which has since replaced it.
+	//
+	// Superseded versions are dropped as a database is opened, and by
+	// `Compact`, and so KeepEarliest only considers versions written since
+	// the database was opened or last compacted; before then, only the
+	// latest version remains
+	KeepEarliest
+)
+
+// CSVOptions control how CSV output is formatted.
+//
+// The zero value produces comma separated output, with RFC3339 timestamps,
+// and every field as a column
+type CSVOptions struct {
+	// Delimiter separates fields, and defaults to ','. This can be set
+	// to '\t' to produce TSV
+	Delimiter rune `json:"delimiter" form:"delimiter"`
+
+	// TimeFormat is the layout, as per `time.Time.Format`, used to format
+	// timestamps, and defaults to `time.RFC3339`.
+	//
+	// Where Measurements are closer together than a second, this should be
+	// set to something like `time.RFC3339Nano`, otherwise timestamps look
+	// duplicated
+	TimeFormat string `json:"time_format" form:"time_format"`
+
+	// OmitLabels excludes label columns from the output
+	OmitLabels bool `json:"omit_labels" form:"omit_labels"`
+
+	// OmitIndices excludes index columns from the output. Along with OmitLabels,
+	// this leaves only timestamp, measure, and dimension columns
+	OmitIndices bool `json:"omit_indices" form:"omit_indices"`
+
+	// Units appends the unit of each field, as set by `JDB.SetFieldMetadata`, to
+	// its column header, such as `temperature (celsius)`
+	Units bool `json:"units" form:"units"`
+
+	// Pivot, when set to the name of an index, produces a wide table with a row
+	// per timestamp, and a column per combination of dimension and index value,
+	// such as `temperature[kitchen]`, rather than a row per Measurement.
+	//
+	// Cells for timestamps where there is no Measurement for an index value are
+	// left blank. Labels, and any other indices, are omitted, as are Measurements
+	// without the index in question
+	Pivot string `json:"pivot" form:"pivot"`
+
+	// Gzip compresses the output, such that it can be written straight to a
+	// `.csv.gz` file, without a separate compression pass afterwards
+	Gzip bool `json:"gzip" form:"gzip"`
+}
+
+// Validate returns an error wrapping ErrInvalidOptions where these Options could
+// never match anything; that is, where Since, Limit, or Offset are negative, where
+// both From and To are set and From is after To, where a DimensionFilter's Min is
+// greater than its Max, or where DeduplicateKeep is unknown.
+//
+// Because From is ignored when Since is set, From being after To is only an
+// error when Since is unset. The zero value of Options is always valid.
+//
+// Query* functions call Validate themselves, and so callers only need to call it
+// where they want to check Options ahead of time, such as when parsing user input
+func (o Options) Validate() error {
+	if o.Since < 0 {
+		return fmt.Errorf("%w: since (%s) must not be negative; since counts back from to, or from now when to is unset", ErrInvalidOptions, o.Since)
+	}
+
+	if o.Limit < 0 || o.Offset < 0 {
+		return fmt.Errorf("%w: limit (%d) and offset (%d) must not be negative; a limit of zero means no limit", ErrInvalidOptions, o.Limit, o.Offset)
+	}
+
+	if o.Since == 0 && !o.From.IsZero() && !o.To.IsZero() && o.From.After(o.To) {
+		return fmt.Errorf("%w: from (%s) is after to (%s); from must be before to, unless since is set, in which case from is ignored", ErrInvalidOptions, o.From.Format(time.RFC3339Nano), o.To.Format(time.RFC3339Nano))
+	}
+
+	if o.DeduplicateKeep < KeepLatest || o.DeduplicateKeep > KeepEarliest {
+		return fmt.Errorf("%w: deduplicate keep (%d) must be either KeepLatest or KeepEarliest", ErrInvalidOptions, o.DeduplicateKeep)
+	}
+
+	for dim, r := range o.DimensionFilters {
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return fmt.Errorf("%w: dimension filter %s has a min (%g) greater than its max (%g)", ErrInvalidOptions, dim, *r.Min, *r.Max)
+		}
+	}
+
+	return nil
+}
+
+// timeFormat returns the configured time format, or the default
+func (c CSVOptions) timeFormat() string {
+	if c.TimeFormat == "" {
+		return time.RFC3339
+	}
+
+	return c.TimeFormat
 }
 
+// paginate applies Offset and Limit to m
+func (o Options) paginate(m []*Measurement) []*Measurement {
+	m = m[min(o.Offset, len(m)):]
+	if o.Limit > 0 && o.Limit < len(m) {
+		m = m[:o.Limit]
+	}
+
+	return m
+}
+
+// mRange returns the inclusive range of timestamps these Options cover.
+//
+// Both ends of the range are stripped of monotonic clock readings, so that
+// Measurements are always compared by wall clock. Otherwise, a Measurement
+// inserted with `time.Now()` compares differently to one loaded from disk
+// with the same timestamp, and Measurements exactly on a boundary may be
+// excluded
 func (o Options) mRange() (from, to time.Time) {
-	now := time.Now()
+	now := time.Now().Round(0)
+
+	from, to = o.From.Round(0), o.To.Round(0)
 
 	if o.Since > 0 {
-		if o.To.IsZero() {
+		if to.IsZero() {
 			return now.Add(0 - o.Since), now
 		}
 
-		return o.To.Add(0 - o.Since), o.To
+		return to.Add(0 - o.Since), to
 	}
 
-	to = o.To
-	if o.To.IsZero() {
+	if to.IsZero() {
 		to = now
 	}
 
-	return o.From, to
+	return
 }
 
-// validMeasurements iterates through a shard and returns the measurements
-// that sit within the range defined in these options
-func (o Options) validMeasurements(shard []*Measurement) (out []*Measurement) {
+// shardInRange iterates through a shard and returns the measurements that
+// sit between from and to, inclusively, as returned by mRange
+func shardInRange(shard []*Measurement, from, to time.Time) (out []*Measurement) {
 	// Because shards are pre-sorted, we can be clever and rule out a shard
 	// without even needing to iterate through it if:
-	//  1. The first element is after o.To; or
-	//  2. The last element is before o.From
+	//  1. The first element is after to; or
+	//  2. The last element is before from
 	if len(shard) == 0 {
 		return nil
 	}
 
-	from, to := o.mRange()
 	if shard[0].When.After(to) || shard[len(shard)-1].When.Before(from) {
 		return nil
 	}
@@ -84,10 +267,40 @@ func (o Options) validMeasurements(shard []*Measurement) (out []*Measurement) {
 	// slice as we go
 	out = make([]*Measurement, 0, len(shard))
 	for _, m := range shard {
-		if (m.When == from || m.When.After(from)) && (m.When == to || m.When.Before(to)) {
+		if inRange(m.When, from, to) {
 			out = append(out, m)
 		}
 	}
 
 	return
 }
+
+// matchesDimensions returns true when m satisfies every one of
+// DimensionFilters, which is always the case where there are none
+func (o Options) matchesDimensions(m *Measurement) bool {
+	for dim, r := range o.DimensionFilters {
+		v, ok := m.dimension(dim)
+		if !ok || !r.contains(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filterDimensions removes every Measurement from shard which doesn't satisfy
+// DimensionFilters, in place, as per slices.DeleteFunc
+func (o Options) filterDimensions(shard []*Measurement) []*Measurement {
+	if len(o.DimensionFilters) == 0 {
+		return shard
+	}
+
+	return slices.DeleteFunc(shard, func(m *Measurement) bool {
+		return !o.matchesDimensions(m)
+	})
+}
+
+// inRange returns true when t sits between from and to, inclusively
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && !t.After(to)
+}
@@ -0,0 +1,106 @@
+package jdb
+
+import (
+	"encoding/csv"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// writePivotCSV writes measurements to cw as a wide table, pivoted on the
+// index csvOpts.Pivot, as per `CSVOptions.Pivot`.
+//
+// measurements must be sorted by When, as returned by queryAll
+func writePivotCSV(cw *csv.Writer, measurements []*Measurement, fields map[string]measurementFieldType, meta map[string]FieldMeta, csvOpts CSVOptions) (err error) {
+	if fields[csvOpts.Pivot] != index {
+		return ErrNoSuchIndex
+	}
+
+	dimensions := make([]string, 0, len(fields))
+	for f, t := range fields {
+		if t == dimension || t == intDimension {
+			dimensions = append(dimensions, f)
+		}
+	}
+
+	slices.Sort(dimensions)
+
+	// Gather each distinct index value, and each distinct timestamp, in order,
+	// along with the cells for each timestamp, keyed by column
+	values := make(map[string]bool)
+	times := make([]time.Time, 0)
+	rows := make(map[int64]map[string]string)
+
+	for _, m := range measurements {
+		v, ok := m.Indices[csvOpts.Pivot]
+		if !ok {
+			continue
+		}
+
+		values[v] = true
+
+		// Measurements with the same instant may have different locations, and
+		// so don't compare equal as map keys; key rows by instant instead
+		when := m.When.UnixNano()
+		if _, ok := rows[when]; !ok {
+			times = append(times, m.When)
+			rows[when] = make(map[string]string)
+		}
+
+		for _, d := range dimensions {
+			if f, ok := m.Dimensions[d]; ok {
+				rows[when][pivotColumn(d, v)] = strconv.FormatFloat(f, 'g', -1, 64)
+			}
+
+			if i, ok := m.IntDimensions[d]; ok {
+				rows[when][pivotColumn(d, v)] = strconv.FormatInt(i, 10)
+			}
+		}
+	}
+
+	header := []string{"timestamp"}
+	columns := make([]string, 0, len(dimensions)*len(values))
+
+	for _, d := range dimensions {
+		for _, v := range slices.Sorted(maps.Keys(values)) {
+			column := pivotColumn(d, v)
+			columns = append(columns, column)
+
+			if unit := meta[d].Unit; csvOpts.Units && unit != "" {
+				column += " (" + unit + ")"
+			}
+
+			header = append(header, column)
+		}
+	}
+
+	err = cw.Write(header)
+	if err != nil {
+		return
+	}
+
+	for _, when := range times {
+		line := make([]string, 0, len(header))
+		line = append(line, when.Format(csvOpts.timeFormat()))
+
+		for _, column := range columns {
+			line = append(line, rows[when.UnixNano()][column])
+		}
+
+		err = cw.Write(line)
+		if err != nil {
+			return
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// pivotColumn returns the name of the column for a dimension and
+// index value, such as `temperature[kitchen]`
+func pivotColumn(dimension, value string) string {
+	return dimension + "[" + value + "]"
+}
@@ -0,0 +1,76 @@
+package jdb_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_WriteCSV_Pivot(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	start := time.Date(2024, 11, 22, 11, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		for _, location := range []string{"living room", "bedroom"} {
+			// Leave a gap in the bedroom readings
+			if location == "bedroom" && i == 1 {
+				continue
+			}
+
+			err = db.Insert(&jdb.Measurement{
+				Name:          "environment",
+				When:          start.Add(time.Minute * time.Duration(i)),
+				Dimensions:    map[string]float64{"temperature": 20 + float64(i)},
+				IntDimensions: map[string]int64{"co2": int64(400 + i)},
+				Labels:        map[string]string{"device_id": "RP2040"},
+				Indices:       map[string]string{"location": location},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	err = db.SetFieldMetadata("environment", "temperature", jdb.FieldMeta{Unit: "celsius"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name      string
+		opts      jdb.CSVOptions
+		expect    string
+		expectErr error
+	}{
+		{"Pivoting on an unknown index fails", jdb.CSVOptions{Pivot: "room"}, "", jdb.ErrNoSuchIndex},
+		{"Pivoting on a label fails", jdb.CSVOptions{Pivot: "device_id"}, "", jdb.ErrNoSuchIndex},
+		{"Pivoting produces a column per dimension and index value", jdb.CSVOptions{Pivot: "location"}, `timestamp,co2[bedroom],co2[living room],temperature[bedroom],temperature[living room]
+2024-11-22T11:00:00Z,400,400,20,20
+2024-11-22T11:01:00Z,,401,,21
+2024-11-22T11:02:00Z,402,402,22,22
+`, nil},
+		{"Pivoting with units includes units", jdb.CSVOptions{Pivot: "location", Units: true, Delimiter: ';'}, `timestamp;co2[bedroom];co2[living room];temperature[bedroom] (celsius);temperature[living room] (celsius)
+2024-11-22T11:00:00Z;400;400;20;20
+2024-11-22T11:01:00Z;;401;;21
+2024-11-22T11:02:00Z;402;402;22;22
+`, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := db.QueryAllCSV("environment", &jdb.Options{CSV: test.opts})
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expect != string(b) {
+				t.Errorf("expected: %q, received %q", test.expect, string(b))
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package jdb
+
+import (
+	"bufio"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// WritePrometheus writes the latest value of every dimension to w in the Prometheus
+// text exposition format, which allows Prometheus to scrape jdb directly, such as
+// by serving this from a `/metrics` endpoint.
+//
+// For each Measurement name, WritePrometheus finds the latest Measurement for each
+// distinct combination of indices, and writes a sample per dimension, as per:
+//
+//	measurement_dimension{index="value",...} number timestamp
+//
+// Measurement names and dimension names are sanitised to valid Prometheus metric
+// names, and indices become Prometheus labels (with the exception of `_default_index`,
+// which jdb adds internally). Timestamps are written in milliseconds, as Prometheus
+// expects.
+//
+// `Measurement.States` are written as 1 or 0.
+//
+// `Measurement.Labels` are not written; they tend to be high cardinality, free text,
+// values which make for poor Prometheus labels. Every metric is typed as a gauge.
+//
+// Where a dimension has metadata, set via `SetFieldMetadata`, its description and unit
+// are written as the metric's HELP line.
+func (j *JDB) WritePrometheus(w io.Writer) (err error) {
+	// As with WriteCSV, only hold the lock while gathering data
+	j.saveMutex.RLock()
+
+	latest := make(map[string]*Measurement)
+	for _, shards := range j.measurements {
+		for _, shard := range shards {
+			for _, m := range shard {
+				k := m.Name + "\x00" + prometheusLabels(m.Indices)
+
+				// Shards are sorted, and upserted Measurements land after
+				// the Measurements they replace, so ties go to the latter
+				if l, ok := latest[k]; !ok || !m.When.Before(l.When) {
+					latest[k] = m
+				}
+			}
+		}
+	}
+
+	help := make(map[string]string)
+	for name, fields := range j.fieldMeta {
+		for field, meta := range fields {
+			if h := meta.help(); h != "" {
+				help[prometheusName(name+"_"+field)] = h
+			}
+		}
+	}
+
+	j.saveMutex.RUnlock()
+
+	// Samples for a metric must be written together, and so we group
+	// them by metric name before writing
+	metrics := make(map[string][]string)
+	for _, m := range latest {
+		m = expand(m)
+		labels := prometheusLabels(m.Indices)
+		ts := strconv.FormatInt(m.When.UnixMilli(), 10)
+
+		for k, v := range m.Dimensions {
+			name := prometheusName(m.Name + "_" + k)
+			metrics[name] = append(metrics[name], labels+" "+strconv.FormatFloat(v, 'g', -1, 64)+" "+ts)
+		}
+
+		for k, v := range m.IntDimensions {
+			name := prometheusName(m.Name + "_" + k)
+			metrics[name] = append(metrics[name], labels+" "+strconv.FormatInt(v, 10)+" "+ts)
+		}
+
+		// Prometheus has no booleans, and so States are written as 1 and 0
+		for k, v := range m.States {
+			name := prometheusName(m.Name + "_" + k)
+
+			sample := "0"
+			if v {
+				sample = "1"
+			}
+
+			metrics[name] = append(metrics[name], labels+" "+sample+" "+ts)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, name := range slices.Sorted(maps.Keys(metrics)) {
+		samples := metrics[name]
+		slices.Sort(samples)
+
+		if h, ok := help[name]; ok {
+			_, err = bw.WriteString("# HELP " + name + " " + prometheusHelp.Replace(h) + "\n")
+			if err != nil {
+				return
+			}
+		}
+
+		_, err = bw.WriteString("# TYPE " + name + " gauge\n")
+		if err != nil {
+			return
+		}
+
+		for _, sample := range samples {
+			_, err = bw.WriteString(name + sample + "\n")
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// prometheusLabels formats indices as a Prometheus label set, such as
+// `{location="kitchen"}`, sorted by label name
+func prometheusLabels(indices map[string]string) string {
+	labels := make([]string, 0, len(indices))
+	for _, k := range slices.Sorted(maps.Keys(indices)) {
+		if k == DefaultIndexName {
+			continue
+		}
+
+		labels = append(labels, prometheusName(k)+`="`+prometheusLabelValue.Replace(indices[k])+`"`)
+	}
+
+	if len(labels) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+var prometheusLabelValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+var prometheusHelp = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// prometheusName replaces any character which isn't valid in a Prometheus
+// metric or label name with an underscore
+func prometheusName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
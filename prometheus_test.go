@@ -0,0 +1,85 @@
+package jdb_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_WritePrometheus(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.UnixMilli(1556813561098)
+	for i := 0; i < 10; i++ {
+		for _, location := range []string{"kitchen", "bed\"room"} {
+			err = db.Insert(&jdb.Measurement{
+				Name: "environment",
+				When: now.Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"temperature": float64(i) + 0.5,
+				},
+				IntDimensions: map[string]int64{
+					"door.opens": int64(i),
+				},
+				Labels: map[string]string{
+					"note": "not exported",
+				},
+				Indices: map[string]string{
+					"location": location,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = db.Insert(&jdb.Measurement{
+			Name: "app.requests",
+			When: now.Add(0 - time.Minute*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"count": float64(i * 10),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Upserted values replace the originals
+	err = db.Upsert(&jdb.Measurement{
+		Name: "app.requests",
+		When: now,
+		Dimensions: map[string]float64{
+			"count": 1234,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `# TYPE app_requests_count gauge
+app_requests_count 1234 1556813561098
+# TYPE environment_door_opens gauge
+environment_door_opens{location="bed\"room"} 0 1556813561098
+environment_door_opens{location="kitchen"} 0 1556813561098
+# TYPE environment_temperature gauge
+environment_temperature{location="bed\"room"} 0.5 1556813561098
+environment_temperature{location="kitchen"} 0.5 1556813561098
+`
+
+	buf := new(bytes.Buffer)
+
+	err = db.WritePrometheus(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect != buf.String() {
+		t.Errorf("expected:\n%s\nreceived:\n%s", expect, buf.String())
+	}
+}
@@ -0,0 +1,760 @@
+package jdb
+
+import (
+	"container/heap"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// QueryLatestPerIndex returns, for each value of a specific index, the most recent
+// Measurement which fits within opts.
+//
+// This is useful for views such as "list all sensors along with their latest reading",
+// where fetching the entire history of each sensor just to discard all but one
+// point is wasteful.
+//
+// Results are ordered by index value. Index values with no Measurements within
+// the time range are omitted.
+//
+// For the purposes of time slicing, setting opts to nil has identical behaviour to
+// setting it to empty, such as `&jdb.Options{}`, or `new(jdb.Options)`- though setting
+// opts as nil saves a chunk of cycles and is, therefore, marginallty more efficient
+func (j *JDB) QueryLatestPerIndex(name, index string, opts *Options) (m []*Measurement, err error) {
+	if opts != nil {
+		err = opts.Validate()
+		if err != nil {
+			return
+		}
+	}
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.indices[name]
+	if !ok {
+		err = ErrNoSuchMeasurement
+
+		return
+	}
+
+	idx, ok := measurement[index]
+	if !ok {
+		err = ErrNoSuchIndex
+
+		return
+	}
+
+	m = make([]*Measurement, 0, len(idx))
+	for _, value := range slices.Sorted(maps.Keys(idx)) {
+		latest := latestInShards(idx[value], opts)
+		if latest != nil {
+			m = append(m, expand(latest))
+		}
+	}
+
+	return
+}
+
+// QueryLatest returns the most recent Measurement for each value of a specific
+// index, keyed by index value.
+//
+// This is ideal for "current status" views, such as the latest reading per hostname.
+// Because shards are kept sorted, this is cheap; it only ever needs to look at the
+// last Measurement of the newest shard for each value.
+func (j *JDB) QueryLatest(name, index string) (m map[string]*Measurement, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.indices[name]
+	if !ok {
+		err = ErrNoSuchMeasurement
+
+		return
+	}
+
+	idx, ok := measurement[index]
+	if !ok {
+		err = ErrNoSuchIndex
+
+		return
+	}
+
+	m = make(map[string]*Measurement, len(idx))
+	for value, shards := range idx {
+		if latest := latestInShards(shards, nil); latest != nil {
+			m[value] = expand(latest)
+		}
+	}
+
+	return
+}
+
+// QueryMany works identically to `QueryAll`, but queries several Measurement names
+// at once, returning a single slice of Measurements sorted by When.
+//
+// Where Measurements from different names share a timestamp, they are returned in
+// the order their names appear in names.
+//
+// Every name must exist; should any not then QueryMany returns an error wrapping
+// ErrNoSuchMeasurement, which names the missing Measurement, rather than silently
+// returning partial data.
+//
+// opts.Deduplicate is applied per name, as per `QueryAll`, while opts.Limit and
+// opts.Offset are applied to the combined results
+func (j *JDB) QueryMany(names []string, opts *Options) (m []*Measurement, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m = make([]*Measurement, 0)
+	for _, name := range names {
+		var measurements []*Measurement
+
+		measurements, err = j.queryAll(name, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, name)
+		}
+
+		m = append(m, measurements...)
+	}
+
+	slices.SortStableFunc(m, func(a, b *Measurement) int {
+		return a.When.Compare(b.When)
+	})
+
+	if opts != nil {
+		m = opts.paginate(m)
+	}
+
+	return
+}
+
+// QueryAllIndexIn works identically to `QueryAllIndex`, but returns Measurements where
+// the index has any of values, such as every Measurement whose location is either the
+// kitchen or the living room, sorted by When.
+//
+// Values which appear more than once are only queried once, and values which don't
+// exist contribute nothing. As with QueryAllIndex, an index which doesn't exist returns
+// ErrNoSuchIndex.
+//
+// Because a Measurement only has one value for any index, results never contain the
+// same Measurement twice
+func (j *JDB) QueryAllIndexIn(name, index string, values []string, opts *Options) (m []*Measurement, err error) {
+	defer logSlowQuery("QueryAllIndexIn", name, opts, time.Now(), &m)
+
+	if opts != nil {
+		err = opts.Validate()
+		if err != nil {
+			return
+		}
+	}
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.indices[name]
+	if !ok {
+		return nil, ErrNoSuchMeasurement
+	}
+
+	idx, ok := measurement[index]
+	if !ok {
+		return nil, ErrNoSuchIndex
+	}
+
+	shards := make([][]*Measurement, 0)
+	seen := make(map[string]bool, len(values))
+
+	for _, value := range values {
+		if seen[value] {
+			continue
+		}
+
+		seen[value] = true
+
+		shards = append(shards, scanShards(idx[value], opts)...)
+	}
+
+	m = mergeShards(shards)
+
+	expandAll(m)
+
+	if opts != nil {
+		m = opts.paginate(m)
+	}
+
+	return
+}
+
+// ForEach calls fn for every Measurement of a specific name, in time order, without
+// building a slice of results first, which makes it suitable for custom reductions
+// over large ranges.
+//
+// Should fn return an error, ForEach stops and returns that error.
+//
+// When opts is not nil, the specified time slicing options are used, as per `QueryAll`,
+// and shards outside of the specified range are skipped entirely. opts.Deduplicate is
+// ignored.
+//
+// ForEach holds the read lock while it runs, and so fn must not write to the database,
+// such as via Insert, or it will deadlock
+func (j *JDB) ForEach(name string, opts *Options, fn func(*Measurement) error) (err error) {
+	if opts != nil {
+		err = opts.Validate()
+		if err != nil {
+			return
+		}
+	}
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.measurements[name]
+	if !ok {
+		return ErrNoSuchMeasurement
+	}
+
+	mergeRuns(scanShards(measurement, opts), func(run []*Measurement) bool {
+		for _, m := range run {
+			err = fn(expand(m))
+			if err != nil {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	return
+}
+
+// Reduce folds every Measurement of a specific name into a single value, in time order,
+// by calling fn with the result so far (starting with init) and each Measurement in turn,
+// which allows arbitrary aggregations, such as correlations between dimensions, without
+// building a slice of results first.
+//
+// Measurements are visited exactly as per `ForEach`, including opts being honoured in
+// the same way, and the same restriction on writing to the database from within fn.
+// Where the Measurement doesn't exist, Reduce returns init, along with ErrNoSuchMeasurement
+func Reduce[T any](j *JDB, name string, opts *Options, init T, fn func(T, *Measurement) T) (acc T, err error) {
+	acc = init
+
+	err = j.ForEach(name, opts, func(m *Measurement) error {
+		acc = fn(acc, m)
+
+		return nil
+	})
+
+	return
+}
+
+// QueryPrefix returns Measurements for every Measurement name beginning with prefix,
+// grouped by full Measurement name, which makes it easy to query hierarchically named
+// Measurements such as `app.http.requests` and `app.http.errors` via the prefix `app.http.`
+//
+// An empty prefix matches every Measurement, which is useful for exports. Where no
+// Measurement names match, QueryPrefix returns an empty map rather than an error.
+//
+// opts is applied to each Measurement name as per `QueryAll`
+func (j *JDB) QueryPrefix(prefix string, opts *Options) (m map[string][]*Measurement, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m = make(map[string][]*Measurement)
+	for name := range j.measurements {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		m[name], err = j.queryAll(name, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// QueryNearest returns the Measurement with a timestamp closest to t, such as when
+// answering "what was the temperature at 3pm?" where there's no Measurement at
+// precisely 3pm. Where two Measurements are equally close, the earlier is returned.
+//
+// When opts is not nil, only Measurements within the specified range are considered,
+// and where there are none QueryNearest returns ErrNoData.
+//
+// Because shards are sorted, QueryNearest only needs to binary search the shards
+// either side of t, rather than looking at every Measurement
+func (j *JDB) QueryNearest(name string, t time.Time, opts *Options) (m *Measurement, err error) {
+	if opts != nil {
+		err = opts.Validate()
+		if err != nil {
+			return
+		}
+	}
+
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	shards, ok := j.measurements[name]
+	if !ok {
+		return nil, ErrNoSuchMeasurement
+	}
+
+	// Where t is outside of opts then the nearest Measurement will be
+	// the closest to whichever end of opts t is beyond
+	before, after := t, t
+	from, to := time.Time{}, time.Time{}
+
+	if opts != nil {
+		from, to = opts.mRange()
+		if before.After(to) {
+			before = to
+		}
+
+		if after.Before(from) {
+			after = from
+		}
+	}
+
+	// As per queryAll, order shards by their contents, rather than their keys,
+	// which sort differently where Measurements are in different time zones
+	sorted := slices.SortedFunc(maps.Values(shards), func(a, b []*Measurement) int {
+		return a[0].When.Compare(b[0].When)
+	})
+
+	prev := nearestBefore(sorted, before)
+	if prev != nil && opts != nil && prev.When.Before(from) {
+		prev = nil
+	}
+
+	next := nearestAfter(sorted, after)
+	if next != nil && opts != nil && next.When.After(to) {
+		next = nil
+	}
+
+	switch {
+	case prev == nil && next == nil:
+		return nil, ErrNoData
+
+	case prev == nil:
+		return expand(next), nil
+
+	case next == nil:
+		return expand(prev), nil
+
+	case t.Sub(prev.When) <= next.When.Sub(t):
+		return expand(prev), nil
+
+	default:
+		return expand(next), nil
+	}
+}
+
+// nearestBefore returns the latest Measurement at or before t, or nil if there
+// are none. shards must be sorted by time
+func nearestBefore(shards [][]*Measurement, t time.Time) *Measurement {
+	// Find the first shard starting after t; the shards before it are
+	// where we'll find our Measurement
+	i, _ := slices.BinarySearchFunc(shards, t, func(shard []*Measurement, t time.Time) int {
+		if shard[0].When.After(t) {
+			return 1
+		}
+
+		return -1
+	})
+
+	for i--; i >= 0; i-- {
+		shard := shards[i]
+
+		// Similarly, find the first Measurement after t; the Measurement before
+		// it, if there is one, is the one we want
+		k, _ := slices.BinarySearchFunc(shard, t, func(m *Measurement, t time.Time) int {
+			if m.When.After(t) {
+				return 1
+			}
+
+			return -1
+		})
+
+		if k > 0 {
+			return shard[k-1]
+		}
+	}
+
+	return nil
+}
+
+// nearestAfter returns the earliest Measurement at or after t, or nil if there
+// are none. shards must be sorted by time.
+//
+// Where several Measurements share that timestamp, such as via Upsert, the latest
+// is returned
+func nearestAfter(shards [][]*Measurement, t time.Time) *Measurement {
+	// Find the first shard ending at or after t
+	i, _ := slices.BinarySearchFunc(shards, t, func(shard []*Measurement, t time.Time) int {
+		if shard[len(shard)-1].When.Before(t) {
+			return -1
+		}
+
+		return 1
+	})
+
+	for ; i < len(shards); i++ {
+		shard := shards[i]
+
+		k, _ := slices.BinarySearchFunc(shard, t, func(m *Measurement, t time.Time) int {
+			if m.When.Before(t) {
+				return -1
+			}
+
+			return 1
+		})
+
+		if k < len(shard) {
+			for k+1 < len(shard) && shard[k+1].When.Equal(shard[k].When) {
+				k++
+			}
+
+			return shard[k]
+		}
+	}
+
+	return nil
+}
+
+// TopK returns the k Measurements with the largest values of a dimension, such as
+// for "top 10 busiest endpoints", or the smallest values where ascending is true.
+//
+// Results are ordered best first; where values tie, earlier Measurements rank higher.
+// Measurements which don't contain the dimension are ignored.
+//
+// TopK keeps a bounded heap of k Measurements as it goes, rather than sorting every
+// Measurement in range, and so remains cheap over large ranges
+func (j *JDB) TopK(name, dimension string, k int, ascending bool, opts *Options) (m []*Measurement, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurements, err := j.queryAll(name, opts)
+	if err != nil {
+		return
+	}
+
+	h := &topKHeap{dimension: dimension, ascending: ascending}
+	for _, measurement := range measurements {
+		if _, ok := measurement.dimension(dimension); !ok {
+			continue
+		}
+
+		if k <= 0 {
+			break
+		}
+
+		if h.Len() < k {
+			heap.Push(h, measurement)
+
+			continue
+		}
+
+		// The root of the heap is the worst Measurement we're keeping
+		if h.better(measurement, h.measurements[0]) {
+			h.measurements[0] = measurement
+			heap.Fix(h, 0)
+		}
+	}
+
+	m = make([]*Measurement, h.Len())
+	for i := len(m) - 1; i >= 0; i-- {
+		m[i] = heap.Pop(h).(*Measurement)
+	}
+
+	return
+}
+
+// topKHeap implements heap.Interface, keeping the worst Measurement at
+// the root so that it can be replaced cheaply
+type topKHeap struct {
+	measurements []*Measurement
+	dimension    string
+	ascending    bool
+}
+
+// better returns true where a ranks above b
+func (h *topKHeap) better(a, b *Measurement) bool {
+	av, _ := a.dimension(h.dimension)
+	bv, _ := b.dimension(h.dimension)
+
+	switch {
+	case av == bv:
+		return a.When.Before(b.When)
+
+	case h.ascending:
+		return av < bv
+
+	default:
+		return av > bv
+	}
+}
+
+func (h *topKHeap) Len() int           { return len(h.measurements) }
+func (h *topKHeap) Less(i, j int) bool { return h.better(h.measurements[j], h.measurements[i]) }
+func (h *topKHeap) Swap(i, j int) {
+	h.measurements[i], h.measurements[j] = h.measurements[j], h.measurements[i]
+}
+func (h *topKHeap) Push(x any) { h.measurements = append(h.measurements, x.(*Measurement)) }
+
+func (h *topKHeap) Pop() any {
+	last := h.measurements[len(h.measurements)-1]
+	h.measurements = h.measurements[:len(h.measurements)-1]
+
+	return last
+}
+
+// GetByID returns the Measurement with a specific id, as returned by `Measurement.ID`
+// (or `Measurement.IDs`, for databases using a DedupeStrategy other than the default),
+// and whether that Measurement exists.
+//
+// Because ids are indexed directly, this is the cheapest possible lookup, and
+// so is ideal for building secondary indexes externally. Where a Measurement has
+// been upserted, GetByID returns the latest version
+func (j *JDB) GetByID(id string) (m *Measurement, ok bool) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	m, ok = j.ids[id]
+
+	return expand(m), ok
+}
+
+// ListIndices returns the names of every index set on a Measurement, sorted
+// alphabetically.
+//
+// Measurements inserted without any indices are given the index `_default_index`,
+// as per `Measurement.Validate`, and so this index may appear here too
+func (j *JDB) ListIndices(name string) (indices []string, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.indices[name]
+	if !ok {
+		err = ErrNoSuchMeasurement
+
+		return
+	}
+
+	return slices.Sorted(maps.Keys(measurement)), nil
+}
+
+// ListIndexValues returns every distinct value of an index on a Measurement,
+// sorted alphabetically
+func (j *JDB) ListIndexValues(name, index string) (values []string, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.indices[name]
+	if !ok {
+		err = ErrNoSuchMeasurement
+
+		return
+	}
+
+	idx, ok := measurement[index]
+	if !ok {
+		err = ErrNoSuchIndex
+
+		return
+	}
+
+	return slices.Sorted(maps.Keys(idx)), nil
+}
+
+// Cardinality returns the number of distinct values of an index on a Measurement.
+//
+// High cardinality indices, such as request IDs, use a lot of memory for little
+// benefit, and so this is useful both for diagnosing memory use and for deciding
+// whether a label is worth promoting to an index
+func (j *JDB) Cardinality(name, index string) (n int, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.indices[name]
+	if !ok {
+		return 0, ErrNoSuchMeasurement
+	}
+
+	idx, ok := measurement[index]
+	if !ok {
+		return 0, ErrNoSuchIndex
+	}
+
+	return len(idx), nil
+}
+
+// CardinalityAll returns the cardinality of every index on a Measurement, keyed
+// by index name, as per `Cardinality`
+func (j *JDB) CardinalityAll(name string) (c map[string]int, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.indices[name]
+	if !ok {
+		return nil, ErrNoSuchMeasurement
+	}
+
+	c = make(map[string]int, len(measurement))
+	for index, values := range measurement {
+		c[index] = len(values)
+	}
+
+	return
+}
+
+// IndexFacets returns the number of Measurements with each value of each index on a
+// Measurement, keyed by index name and then value, such as for showing "12 results
+// for location=kitchen" in a faceted search.
+//
+// Counts are the lengths of each index value's shards, and so are cheap to compute,
+// but include Measurements superseded by `Upsert` until the database is compacted.
+// As with `ListIndices`, `_default_index` may appear here too
+func (j *JDB) IndexFacets(name string) (f map[string]map[string]int, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.indices[name]
+	if !ok {
+		return nil, ErrNoSuchMeasurement
+	}
+
+	f = make(map[string]map[string]int, len(measurement))
+	for index, values := range measurement {
+		f[index] = make(map[string]int, len(values))
+
+		for value, shards := range values {
+			for _, shard := range shards {
+				f[index][value] += len(shard)
+			}
+		}
+	}
+
+	return
+}
+
+// TimeRange returns the timestamps of the oldest and newest Measurements with a
+// specific name, such as for setting the bounds of a chart's axis.
+//
+// Shards are sorted, and so TimeRange only reads the first and last Measurement of
+// each shard, rather than scanning every Measurement. TimeRange returns ErrNoData
+// where every Measurement has been deleted
+func (j *JDB) TimeRange(name string) (oldest, newest time.Time, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	shards, ok := j.measurements[name]
+	if !ok {
+		err = ErrNoSuchMeasurement
+
+		return
+	}
+
+	return timeRange(shards)
+}
+
+// TimeRangeIndex works identically to `TimeRange`, but only considers Measurements
+// with a specific index value, and returns ErrNoData where there are none
+func (j *JDB) TimeRangeIndex(name, index, indexValue string) (oldest, newest time.Time, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	measurement, ok := j.indices[name]
+	if !ok {
+		err = ErrNoSuchMeasurement
+
+		return
+	}
+
+	idx, ok := measurement[index]
+	if !ok {
+		err = ErrNoSuchIndex
+
+		return
+	}
+
+	return timeRange(idx[indexValue])
+}
+
+// timeRange returns the earliest and latest timestamps across a set of shards,
+// each of which must be sorted
+func timeRange(shards map[string][]*Measurement) (oldest, newest time.Time, err error) {
+	found := false
+
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			continue
+		}
+
+		if first := shard[0].When; !found || first.Before(oldest) {
+			oldest = first
+		}
+
+		if last := shard[len(shard)-1].When; !found || last.After(newest) {
+			newest = last
+		}
+
+		found = true
+	}
+
+	if !found {
+		err = ErrNoData
+	}
+
+	return
+}
+
+// latestInShards walks a set of shards from newest to oldest, returning the
+// latest Measurement which fits within opts, or nil if none do
+func latestInShards(shards map[string][]*Measurement, opts *Options) (latest *Measurement) {
+	// As per QueryNearest, order shards by their contents, rather than their keys,
+	// which sort differently where Measurements are in different time zones
+	sorted := make([][]*Measurement, 0, len(shards))
+	for _, shard := range shards {
+		if len(shard) > 0 {
+			sorted = append(sorted, shard)
+		}
+	}
+
+	slices.SortFunc(sorted, func(a, b []*Measurement) int {
+		return b[len(b)-1].When.Compare(a[len(a)-1].When)
+	})
+
+	var from, to time.Time
+	if opts != nil {
+		from, to = opts.mRange()
+	}
+
+	for _, shard := range sorted {
+		// Shards in different time zones may overlap, and so we can only stop
+		// once no remaining shard ends after what we've already found
+		if latest != nil && !shard[len(shard)-1].When.After(latest.When) {
+			break
+		}
+
+		for k := len(shard) - 1; k >= 0; k-- {
+			if opts == nil || (inRange(shard[k].When, from, to) && opts.matchesDimensions(shard[k])) {
+				if latest == nil || shard[k].When.After(latest.When) {
+					latest = shard[k]
+				}
+
+				break
+			}
+
+			// Shards are sorted, and so once we've passed From there's
+			// nothing else in range in this shard
+			if shard[k].When.Before(from) {
+				break
+			}
+		}
+	}
+
+	return
+}
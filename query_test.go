@@ -0,0 +1,1200 @@
+package jdb_test
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_QueryLatestPerIndex(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		for _, location := range []string{"kitchen", "bedroom"} {
+			err = db.Insert(&jdb.Measurement{
+				Name: "environment",
+				When: now.Add(0 - time.Hour*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"temperature": float64(i),
+				},
+				Indices: map[string]string{
+					"location": location,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		index       string
+		opts        *jdb.Options
+		expectCount int
+		expectValue float64
+		expectErr   bool
+	}{
+		{"Unknown measurement fails", "zimzams", "location", nil, 0, 0, true},
+		{"Unknown index fails", "environment", "wazzles", nil, 0, 0, true},
+
+		{"Nil options returns latest per value", "environment", "location", nil, 2, 0, false},
+		{"Time range returns latest within range", "environment", "location", &jdb.Options{To: now.Add(0 - time.Hour*3)}, 2, 3, false},
+		{"Time range with no data returns nothing", "environment", "location", &jdb.Options{To: now.Add(0 - time.Hour*24)}, 0, 0, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryLatestPerIndex(test.measurement, test.index, test.opts)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Fatalf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+
+			for _, rcvd := range m {
+				if test.expectValue != rcvd.Dimensions["temperature"] {
+					t.Errorf("expected %f, received %f", test.expectValue, rcvd.Dimensions["temperature"])
+				}
+			}
+		})
+	}
+}
+
+func TestJDB_QueryLatestPerIndex_mixed_locations(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	// Shards are keyed by wall clock, and so the earlier of these Measurements
+	// lands in a shard whose key sorts after the later one's
+	aest := time.FixedZone("AEST", 10*60*60)
+	start := time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC)
+
+	for i, when := range []time.Time{start.In(aest), start.Add(time.Hour * 5)} {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "environment",
+			When:       when,
+			Dimensions: map[string]float64{"temperature": float64(i + 1)},
+			Indices:    map[string]string{"location": "kitchen"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		opts        *jdb.Options
+		expectCount int
+		expectValue float64
+	}{
+		{"Nil options returns the latest", nil, 1, 2},
+		{"Time range returns the latest within range", &jdb.Options{From: start.Add(time.Hour * 3), To: start.Add(time.Hour * 6)}, 1, 2},
+		{"Time range before the latest returns the earlier", &jdb.Options{From: start, To: start.Add(time.Hour * 3)}, 1, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryLatestPerIndex("environment", "location", test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Fatalf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+
+			if test.expectValue != m[0].Dimensions["temperature"] {
+				t.Errorf("expected %f, received %f", test.expectValue, m[0].Dimensions["temperature"])
+			}
+		})
+	}
+
+	t.Run("Compacted output is in time order", func(t *testing.T) {
+		f, err := os.CreateTemp("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		err = db.CompactTo(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := os.Open(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer r.Close()
+
+		m, err := jdb.Decode(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 2 {
+			t.Fatalf("expected %d measurements, received %d", 2, len(m))
+		}
+
+		if m[0].When.After(m[1].When) {
+			t.Errorf("expected measurements in order, received %v before %v", m[0].When, m[1].When)
+		}
+	})
+}
+
+func TestJDB_QueryLatest(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		for h, hostname := range []string{"alpha", "bravo", "charlie"} {
+			err = db.Insert(&jdb.Measurement{
+				Name: "load",
+				When: now.Add(0 - time.Hour*time.Duration(i+h)),
+				Dimensions: map[string]float64{
+					"load": float64(i + h),
+				},
+				Indices: map[string]string{
+					"hostname": hostname,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		index       string
+		expect      map[string]float64
+		expectErr   bool
+	}{
+		{"Unknown measurement fails", "zimzams", "hostname", map[string]float64{}, true},
+		{"Unknown index fails", "load", "wazzles", map[string]float64{}, true},
+		{"Valid index returns latest per value", "load", "hostname", map[string]float64{"alpha": 0, "bravo": 1, "charlie": 2}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryLatest(test.measurement, test.index)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if len(test.expect) != len(m) {
+				t.Fatalf("expected %d measurements, received %d", len(test.expect), len(m))
+			}
+
+			for k, v := range test.expect {
+				if m[k].Dimensions["load"] != v {
+					t.Errorf("%s: expected %f, received %f", k, v, m[k].Dimensions["load"])
+				}
+			}
+		})
+	}
+}
+
+func TestJDB_QueryLatest_mixed_locations(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	// Shards are keyed by wall clock, and so the earlier of these Measurements
+	// lands in a shard whose key sorts after the later one's
+	aest := time.FixedZone("AEST", 10*60*60)
+	start := time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC)
+
+	for i, when := range []time.Time{start.In(aest), start.Add(time.Hour * 5)} {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "load",
+			When:       when,
+			Dimensions: map[string]float64{"load": float64(i + 1)},
+			Indices:    map[string]string{"hostname": "alpha"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := db.QueryLatest("load", "hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := m["alpha"].Dimensions["load"]; v != 2 {
+		t.Errorf("expected %f, received %f", 2.0, v)
+	}
+}
+
+func TestJDB_ListIndices(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for i, location := range []string{"kitchen", "bedroom", "kitchen", "attic"} {
+		err = db.Insert(&jdb.Measurement{
+			Name: "environment",
+			When: time.Now().Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"temperature": 19.23,
+			},
+			Indices: map[string]string{
+				"location": location,
+				"sensor":   "RP2040",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		expect      []string
+		expectErr   bool
+	}{
+		{"Unknown measurement fails", "zimzams", nil, true},
+		{"Valid measurement returns sorted indices", "environment", []string{"location", "sensor"}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			indices, err := db.ListIndices(test.measurement)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if !slices.Equal(test.expect, indices) {
+				t.Errorf("expected %v, received %v", test.expect, indices)
+			}
+		})
+	}
+}
+
+func TestJDB_ListIndexValues(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for i, location := range []string{"kitchen", "bedroom", "kitchen", "attic"} {
+		err = db.Insert(&jdb.Measurement{
+			Name: "environment",
+			When: time.Now().Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"temperature": 19.23,
+			},
+			Indices: map[string]string{
+				"location": location,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		index       string
+		expect      []string
+		expectErr   bool
+	}{
+		{"Unknown measurement fails", "zimzams", "location", nil, true},
+		{"Unknown index fails", "environment", "wazzles", nil, true},
+		{"Valid index returns sorted, distinct, values", "environment", "location", []string{"attic", "bedroom", "kitchen"}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := db.ListIndexValues(test.measurement, test.index)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if !slices.Equal(test.expect, values) {
+				t.Errorf("expected %v, received %v", test.expect, values)
+			}
+		})
+	}
+}
+
+func TestJDB_QueryMany(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		for _, name := range []string{"app.http.requests", "app.http.errors"} {
+			err = db.Insert(&jdb.Measurement{
+				Name: name,
+				When: now.Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"count": float64(i),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		names       []string
+		opts        *jdb.Options
+		expectCount int
+		expectErr   bool
+	}{
+		{"Unknown measurement fails", []string{"app.http.requests", "zimzams"}, nil, 0, true},
+		{"No names returns nothing", nil, nil, 0, false},
+		{"Single name returns that name", []string{"app.http.requests"}, nil, 10, false},
+		{"Multiple names are merged", []string{"app.http.requests", "app.http.errors"}, nil, 20, false},
+		{"Options are respected", []string{"app.http.requests", "app.http.errors"}, &jdb.Options{Since: time.Minute * 4}, 8, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryMany(test.names, test.opts)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectErr && !errors.Is(err, jdb.ErrNoSuchMeasurement) {
+				t.Errorf("expected jdb.ErrNoSuchMeasurement, received %#v", err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+
+			sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
+				return a.When.Compare(b.When)
+			})
+
+			if !sorted {
+				t.Error("Results are not sorted")
+			}
+		})
+	}
+}
+
+func TestJDB_QueryAllIndexIn(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		for _, location := range []string{"kitchen", "living room", "garage"} {
+			err = db.Insert(&jdb.Measurement{
+				Name: "environment",
+				When: now.Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"temperature": float64(i),
+				},
+				Indices: map[string]string{
+					"location": location,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		index       string
+		values      []string
+		opts        *jdb.Options
+		expectCount int
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", "location", []string{"kitchen"}, nil, 0, jdb.ErrNoSuchMeasurement},
+		{"Unknown index fails", "environment", "sensor", []string{"kitchen"}, nil, 0, jdb.ErrNoSuchIndex},
+		{"No values returns nothing", "environment", "location", nil, nil, 0, nil},
+		{"Unknown values return nothing", "environment", "location", []string{"attic"}, nil, 0, nil},
+		{"Single value returns that value", "environment", "location", []string{"kitchen"}, nil, 10, nil},
+		{"Multiple values are merged", "environment", "location", []string{"kitchen", "living room"}, nil, 20, nil},
+		{"Repeated values are only returned once", "environment", "location", []string{"kitchen", "kitchen", "attic"}, nil, 10, nil},
+		{"Options are respected", "environment", "location", []string{"kitchen", "living room"}, &jdb.Options{Since: time.Minute * 4, Limit: 5}, 5, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryAllIndexIn(test.measurement, test.index, test.values, test.opts)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+
+			sorted := slices.IsSortedFunc(m, func(a, b *jdb.Measurement) int {
+				return a.When.Compare(b.When)
+			})
+
+			if !sorted {
+				t.Error("Results are not sorted")
+			}
+
+			for _, m := range m {
+				if m.Indices["location"] == "garage" {
+					t.Errorf("unexpected measurement %#v", m)
+				}
+			}
+		})
+	}
+}
+
+func TestJDB_QueryPrefix(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		for _, name := range []string{"app.http.requests", "app.http.errors", "app.db.queries"} {
+			err = db.Insert(&jdb.Measurement{
+				Name: name,
+				When: now.Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"count": float64(i),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		prefix string
+		opts   *jdb.Options
+		expect map[string]int
+	}{
+		{"Unknown prefix returns nothing", "zimzams", nil, map[string]int{}},
+		{"Empty prefix returns everything", "", nil, map[string]int{"app.http.requests": 10, "app.http.errors": 10, "app.db.queries": 10}},
+		{"Prefix returns matching names", "app.http.", nil, map[string]int{"app.http.requests": 10, "app.http.errors": 10}},
+		{"Full names match themselves", "app.db.queries", nil, map[string]int{"app.db.queries": 10}},
+		{"Options are respected", "app.db", &jdb.Options{Since: time.Minute * 4}, map[string]int{"app.db.queries": 4}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryPrefix(test.prefix, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(test.expect) != len(m) {
+				t.Errorf("expected %d names, received %d", len(test.expect), len(m))
+			}
+
+			for name, count := range test.expect {
+				if count != len(m[name]) {
+					t.Errorf("%s: expected %d measurements, received %d", name, count, len(m[name]))
+				}
+			}
+		})
+	}
+}
+
+func TestJDB_GetByID(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	indexed := &jdb.Measurement{
+		Name: "environment",
+		When: now,
+		Dimensions: map[string]float64{
+			"temperature": 19.23,
+		},
+		Indices: map[string]string{
+			"location": "kitchen",
+			"sensor":   "RP2040",
+		},
+	}
+
+	unindexed := &jdb.Measurement{
+		Name: "counters",
+		When: now,
+		Dimensions: map[string]float64{
+			"counter": 1234,
+		},
+	}
+
+	for _, m := range []*jdb.Measurement{indexed, unindexed} {
+		err = db.Insert(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Upserting replaces the value returned by GetByID
+	upserted := *indexed
+	upserted.Dimensions = map[string]float64{"temperature": 21}
+
+	err = db.Upsert(&upserted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		id       string
+		expect   float64
+		expectOK bool
+	}{
+		{"Unknown ids return nothing", "wibbles", 0, false},
+		{"Unset indices return nothing", indexed.ID("wazzles"), 0, false},
+		{"Location index returns the Measurement", indexed.ID("location"), 21, true},
+		{"Sensor index returns the Measurement", indexed.ID("sensor"), 21, true},
+		{"Unindexed Measurements use the default index", unindexed.ID(jdb.DefaultIndexName), 1234, true},
+		{"ids are deterministic", (&jdb.Measurement{Name: "environment", When: now, Indices: map[string]string{"location": "kitchen"}}).ID("location"), 21, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, ok := db.GetByID(test.id)
+			if test.expectOK != ok {
+				t.Fatalf("expected: %v, received %v", test.expectOK, ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			v := m.Dimensions["temperature"] + m.Dimensions["counter"]
+			if test.expect != v {
+				t.Errorf("expected: %v, received %v", test.expect, v)
+			}
+		})
+	}
+}
+
+func TestJDB_QueryNearest(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Readings every 40 minutes, so that shards contain gaps
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "environment",
+			When: start.Add(time.Minute * time.Duration(i*40)),
+			Dimensions: map[string]float64{
+				"temperature": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Upsert a replacement for the fourth reading
+	err = db.Upsert(&jdb.Measurement{
+		Name: "environment",
+		When: start.Add(time.Minute * 120),
+		Dimensions: map[string]float64{
+			"temperature": 100,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		t           time.Time
+		opts        *jdb.Options
+		expect      float64
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", start, nil, 0, jdb.ErrNoSuchMeasurement},
+		{"Empty range has no data", "environment", start, &jdb.Options{To: start.Add(0 - time.Hour)}, 0, jdb.ErrNoData},
+		{"Exact matches are returned", "environment", start.Add(time.Minute * 80), nil, 2, nil},
+		{"Closest earlier measurement is returned", "environment", start.Add(time.Minute * 90), nil, 2, nil},
+		{"Closest later measurement is returned", "environment", start.Add(time.Minute * 110), nil, 100, nil},
+		{"Ties return the earlier measurement", "environment", start.Add(time.Minute * 60), nil, 1, nil},
+		{"Times before all data return the first measurement", "environment", start.Add(0 - time.Hour*24), nil, 0, nil},
+		{"Times after all data return the last measurement", "environment", start.Add(time.Hour * 24), nil, 9, nil},
+		{"Upserted measurements return the latest version", "environment", start.Add(time.Minute * 120), nil, 100, nil},
+		{"Options bound the search", "environment", start, &jdb.Options{From: start.Add(time.Minute * 200), To: start.Add(time.Minute * 300)}, 5, nil},
+		{"Options bound the search from above", "environment", start.Add(time.Hour * 24), &jdb.Options{From: start.Add(time.Minute * 200), To: start.Add(time.Minute * 300)}, 7, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.QueryNearest(test.measurement, test.t, test.opts)
+			if !errors.Is(err, test.expectErr) {
+				t.Fatalf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if test.expect != m.Dimensions["temperature"] {
+				t.Errorf("expected: %v, received %v", test.expect, m.Dimensions["temperature"])
+			}
+		})
+	}
+}
+
+func TestJDB_TopK(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i, v := range []float64{5, 1, 9, 3, 9, 7, 2} {
+		err = db.Insert(&jdb.Measurement{
+			Name: "requests",
+			When: start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"count": v,
+			},
+			Labels: map[string]string{
+				"position": strconv.Itoa(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A Measurement without the dimension, which should be ignored
+	err = db.Insert(&jdb.Measurement{
+		Name: "requests",
+		When: start.Add(time.Hour),
+		Dimensions: map[string]float64{
+			"errors": 100,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		k           int
+		ascending   bool
+		opts        *jdb.Options
+		expect      []string
+		expectErr   bool
+	}{
+		{"Unknown measurement fails", "zimzams", 3, false, nil, nil, true},
+		{"Zero k returns nothing", "requests", 0, false, nil, []string{}, false},
+		{"Largest values are returned, ties by time", "requests", 3, false, nil, []string{"2", "4", "5"}, false},
+		{"Smallest values are returned", "requests", 3, true, nil, []string{"1", "6", "3"}, false},
+		{"Large k returns everything", "requests", 100, true, nil, []string{"1", "6", "3", "0", "5", "2", "4"}, false},
+		{"Options are respected", "requests", 2, false, &jdb.Options{From: start.Add(time.Minute * 3), To: start.Add(time.Minute * 6)}, []string{"4", "5"}, false},
+		{"Limit and Offset are ignored", "requests", 3, false, &jdb.Options{Limit: 2, Offset: 1}, []string{"2", "4", "5"}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := db.TopK(test.measurement, "count", test.k, test.ascending, test.opts)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectErr {
+				return
+			}
+
+			rcvd := make([]string, 0, len(m))
+			for _, measurement := range m {
+				rcvd = append(rcvd, measurement.Labels["position"])
+			}
+
+			if !slices.Equal(test.expect, rcvd) {
+				t.Errorf("expected: %v, received %v", test.expect, rcvd)
+			}
+		})
+	}
+}
+
+func TestJDB_Cardinality(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "requests",
+			When: time.Now().Add(0 - time.Minute*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"duration": float64(i),
+			},
+			Indices: map[string]string{
+				"request_id": strconv.Itoa(i),
+				"endpoint":   []string{"/", "/login", "/logout"}[i%3],
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		index       string
+		expect      int
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", "endpoint", 0, jdb.ErrNoSuchMeasurement},
+		{"Unknown index fails", "requests", "wazzles", 0, jdb.ErrNoSuchIndex},
+		{"Low cardinality index", "requests", "endpoint", 3, nil},
+		{"High cardinality index", "requests", "request_id", 10, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			n, err := db.Cardinality(test.measurement, test.index)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if test.expect != n {
+				t.Errorf("expected: %d, received %d", test.expect, n)
+			}
+		})
+	}
+
+	t.Run("CardinalityAll", func(t *testing.T) {
+		_, err := db.CardinalityAll("zimzams")
+		if !errors.Is(err, jdb.ErrNoSuchMeasurement) {
+			t.Errorf("expected jdb.ErrNoSuchMeasurement, received %#v", err)
+		}
+
+		c, err := db.CardinalityAll("requests")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := map[string]int{"endpoint": 3, "request_id": 10}
+		if !maps.Equal(expect, c) {
+			t.Errorf("expected: %v, received %v", expect, c)
+		}
+	})
+
+	t.Run("IndexFacets", func(t *testing.T) {
+		_, err := db.IndexFacets("zimzams")
+		if !errors.Is(err, jdb.ErrNoSuchMeasurement) {
+			t.Errorf("expected jdb.ErrNoSuchMeasurement, received %#v", err)
+		}
+
+		f, err := db.IndexFacets("requests")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := map[string]map[string]int{
+			"endpoint":   {"/": 4, "/login": 3, "/logout": 3},
+			"request_id": make(map[string]int),
+		}
+
+		for i := 0; i < 10; i++ {
+			expect["request_id"][strconv.Itoa(i)] = 1
+		}
+
+		if !maps.EqualFunc(expect, f, maps.Equal) {
+			t.Errorf("expected: %v, received %v", expect, f)
+		}
+	})
+}
+
+func TestJDB_ForEach(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: start.Add(time.Minute * time.Duration(i*20)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errStop := errors.New("stop")
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		opts        *jdb.Options
+		stopAfter   int
+		expect      []float64
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", nil, 0, []float64{}, jdb.ErrNoSuchMeasurement},
+		{"Every measurement is visited in order", "wibbles", nil, 0, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, nil},
+		{"Options are respected", "wibbles", &jdb.Options{From: start.Add(time.Minute * 50), To: start.Add(time.Minute * 120)}, 0, []float64{3, 4, 5, 6}, nil},
+		{"Errors stop iteration", "wibbles", nil, 3, []float64{0, 1, 2}, errStop},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rcvd := make([]float64, 0)
+
+			err := db.ForEach(test.measurement, test.opts, func(m *jdb.Measurement) error {
+				rcvd = append(rcvd, m.Dimensions["wobble_count"])
+				if len(rcvd) == test.stopAfter {
+					return errStop
+				}
+
+				return nil
+			})
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if !slices.Equal(test.expect, rcvd) {
+				t.Errorf("expected: %v, received %v", test.expect, rcvd)
+			}
+		})
+	}
+}
+
+func TestReduce(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: start.Add(time.Minute * time.Duration(i*20)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sum := func(acc float64, m *jdb.Measurement) float64 {
+		return acc + m.Dimensions["wobble_count"]
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		opts        *jdb.Options
+		expect      float64
+		expectErr   error
+	}{
+		{"Unknown measurement returns init", "zimzams", nil, 100, jdb.ErrNoSuchMeasurement},
+		{"Every measurement is folded", "wibbles", nil, 145, nil},
+		{"Options are respected", "wibbles", &jdb.Options{From: start.Add(time.Minute * 50), To: start.Add(time.Minute * 120)}, 118, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := jdb.Reduce(db, test.measurement, test.opts, 100, sum)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if test.expect != v {
+				t.Errorf("expected: %v, received %v", test.expect, v)
+			}
+		})
+	}
+
+	t.Run("Measurements are folded in order", func(t *testing.T) {
+		order, err := jdb.Reduce(db, "wibbles", nil, []time.Time{}, func(acc []time.Time, m *jdb.Measurement) []time.Time {
+			return append(acc, m.When)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(order) != 10 || !slices.IsSortedFunc(order, time.Time.Compare) {
+			t.Errorf("expected 10 ordered timestamps, received %v", order)
+		}
+	})
+}
+
+func TestJDB_TimeRange(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	// Spread across several shards, inserted out of order
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for _, i := range []int{5, 0, 9, 3, 7, 1} {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i*25)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+			Indices:    map[string]string{"sensor": []string{"a", "b"}[i%2]},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.Insert(&jdb.Measurement{
+		Name:       "deleted",
+		When:       start,
+		Dimensions: map[string]float64{"wobble_count": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.DeleteByTimeRange("deleted", start, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name         string
+		f            func() (time.Time, time.Time, error)
+		expectOldest time.Time
+		expectNewest time.Time
+		expectErr    error
+	}{
+		{"Unknown measurement fails", func() (time.Time, time.Time, error) { return db.TimeRange("zimzams") }, time.Time{}, time.Time{}, jdb.ErrNoSuchMeasurement},
+		{"Deleted measurements have no data", func() (time.Time, time.Time, error) { return db.TimeRange("deleted") }, time.Time{}, time.Time{}, jdb.ErrNoData},
+		{"Every shard is considered", func() (time.Time, time.Time, error) { return db.TimeRange("wibbles") }, start, start.Add(time.Minute * 225), nil},
+		{"Unknown measurement fails by index", func() (time.Time, time.Time, error) { return db.TimeRangeIndex("zimzams", "sensor", "a") }, time.Time{}, time.Time{}, jdb.ErrNoSuchMeasurement},
+		{"Unknown index fails", func() (time.Time, time.Time, error) { return db.TimeRangeIndex("wibbles", "wibbler", "a") }, time.Time{}, time.Time{}, jdb.ErrNoSuchIndex},
+		{"Unknown index value has no data", func() (time.Time, time.Time, error) { return db.TimeRangeIndex("wibbles", "sensor", "c") }, time.Time{}, time.Time{}, jdb.ErrNoData},
+		{"Only the index value is considered", func() (time.Time, time.Time, error) { return db.TimeRangeIndex("wibbles", "sensor", "b") }, start.Add(time.Minute * 25), start.Add(time.Minute * 225), nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			oldest, newest, err := test.f()
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+
+			if !test.expectOldest.Equal(oldest) || !test.expectNewest.Equal(newest) {
+				t.Errorf("expected: %v - %v, received %v - %v", test.expectOldest, test.expectNewest, oldest, newest)
+			}
+		})
+	}
+}
+
+func TestJDB_queries_with_mixed_locations(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	// Shards are keyed by the wall clock of each Measurement, and so Measurements
+	// in different locations land in shards which overlap one another
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	for _, when := range []time.Time{
+		start.Add(time.Minute * 30),
+		start.Add(time.Minute * 55),
+		start.Add(time.Minute * 45).In(ist),
+		start.Add(time.Minute * 50).In(ist),
+		start.Add(time.Minute * 70),
+	} {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       when,
+			Dimensions: map[string]float64{"wobble_count": 1},
+			Indices:    map[string]string{"sensor": "a"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		f    func() ([]*jdb.Measurement, error)
+	}{
+		{"QueryAll", func() ([]*jdb.Measurement, error) { return db.QueryAll("wibbles", nil) }},
+		{"QueryAll with options", func() ([]*jdb.Measurement, error) {
+			return db.QueryAll("wibbles", &jdb.Options{From: start, To: start.Add(time.Hour * 2)})
+		}},
+		{"QueryAllIndex", func() ([]*jdb.Measurement, error) { return db.QueryAllIndex("wibbles", "sensor", "a", nil) }},
+		{"ForEach", func() (m []*jdb.Measurement, err error) {
+			err = db.ForEach("wibbles", nil, func(measurement *jdb.Measurement) error {
+				m = append(m, measurement)
+
+				return nil
+			})
+
+			return
+		}},
+	} {
+		t.Run(test.name+" returns measurements in order", func(t *testing.T) {
+			m, err := test.f()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m) != 5 {
+				t.Fatalf("expected %d measurements, received %d", 5, len(m))
+			}
+
+			for i := 1; i < len(m); i++ {
+				if m[i].When.Before(m[i-1].When) {
+					t.Errorf("expected measurements in order, received %v before %v", m[i-1].When, m[i].When)
+				}
+			}
+		})
+	}
+}
+
+func TestJDB_QueryAll_DimensionFilters(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		m := &jdb.Measurement{
+			Name: "environment",
+			When: start.Add(time.Hour * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"temperature": float64(i * 5),
+			},
+			Indices: map[string]string{
+				"location": "kitchen",
+			},
+		}
+
+		// Only some Measurements have humidity, so filtering on it must
+		// exclude those without
+		if i%2 == 0 {
+			m.Dimensions["humidity"] = float64(i * 10)
+		}
+
+		err = db.Insert(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := func(v float64) *float64 { return &v }
+
+	for _, test := range []struct {
+		name    string
+		filters map[string]jdb.DimRange
+		expect  []float64
+	}{
+		{"No filters return everything", nil, []float64{0, 5, 10, 15, 20, 25, 30, 35, 40, 45}},
+		{"Min is inclusive", map[string]jdb.DimRange{"temperature": {Min: f(30)}}, []float64{30, 35, 40, 45}},
+		{"Max is inclusive", map[string]jdb.DimRange{"temperature": {Max: f(10)}}, []float64{0, 5, 10}},
+		{"Ranges are bounded both sides", map[string]jdb.DimRange{"temperature": {Min: f(12), Max: f(22)}}, []float64{15, 20}},
+		{"Unbounded filters exclude missing dimensions", map[string]jdb.DimRange{"humidity": {}}, []float64{0, 10, 20, 30, 40}},
+		{"Every filter must match", map[string]jdb.DimRange{"temperature": {Min: f(15)}, "humidity": {Max: f(60)}}, []float64{20, 30}},
+		{"Unknown dimensions match nothing", map[string]jdb.DimRange{"pressure": {}}, []float64{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := &jdb.Options{From: start, To: start.Add(time.Hour * 10), DimensionFilters: test.filters}
+
+			for _, q := range []func() ([]*jdb.Measurement, error){
+				func() ([]*jdb.Measurement, error) { return db.QueryAll("environment", opts) },
+				func() ([]*jdb.Measurement, error) {
+					return db.QueryAllIndex("environment", "location", "kitchen", opts)
+				},
+			} {
+				m, err := q()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				received := make([]float64, len(m))
+				for i, m := range m {
+					received[i] = m.Dimensions["temperature"]
+				}
+
+				if !slices.Equal(test.expect, received) {
+					t.Errorf("expected: %v, received %#v", test.expect, received)
+				}
+			}
+
+			latest, err := db.QueryLatestPerIndex("environment", "location", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch {
+			case len(test.expect) == 0 && len(latest) != 0:
+				t.Errorf("expected no measurements, received %d", len(latest))
+
+			case len(test.expect) > 0 && (len(latest) != 1 || latest[0].Dimensions["temperature"] != test.expect[len(test.expect)-1]):
+				t.Errorf("expected latest temperature %v, received %#v", test.expect[len(test.expect)-1], latest)
+			}
+		})
+	}
+}
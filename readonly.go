@@ -0,0 +1,47 @@
+package jdb
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrReadOnly returns when trying to write to a JDB opened with `OpenReadOnly`
+var ErrReadOnly = errors.New("database is read-only")
+
+// OpenReadOnly returns a JDB from a database file on disk, as per `New`, but which
+// can never modify that file.
+//
+// The file is opened read-only, and so OpenReadOnly works for files which the current
+// user can't write to, such as replicas or archived databases, and returns an error
+// where the file doesn't exist rather than creating it.
+//
+// Queries work exactly as they do for databases opened with New. Anything which would
+// change the database, such as `Insert`, `Upsert`, `Flush`, `Compact`, or deletions,
+// returns ErrReadOnly instead.
+//
+// OpenReadOnly accepts the same OpenOptions as New, such as `WithEncryptionKey`, which
+// are needed to read files written with them; `WithAsyncFlush` is ignored
+func OpenReadOnly(file string, opts ...OpenOption) (j *JDB, err error) {
+	Logger.Info("Creating new read-only JDB instance from disk", "stage", "boot", "file", file)
+
+	// #nosec: G304
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+
+	j, err = NewWithStore(&fileStore{File: f}, append(opts, readOnly)...)
+	if err != nil {
+		_ = f.Close()
+	}
+
+	return
+}
+
+// readOnly is the OpenOption used by OpenReadOnly, and is set before the
+// database is loaded so that loading doesn't write anything either
+func readOnly(j *JDB) error {
+	j.readOnly = true
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package jdb_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "ro.db")
+
+	db, err := jdb.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(0 - time.Hour).Truncate(time.Hour)
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+			Indices:    map[string]string{"sensor": "a"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chmod(f, 0o444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := jdb.OpenReadOnly(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Queries work as normal", func(t *testing.T) {
+		m, err := ro.QueryAllIndex("wibbles", "sensor", "a", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 10 {
+			t.Errorf("expected %d measurements, received %d", 10, len(m))
+		}
+	})
+
+	m := &jdb.Measurement{
+		Name:       "wibbles",
+		When:       start.Add(time.Minute * 30),
+		Dimensions: map[string]float64{"wobble_count": 100},
+		Indices:    map[string]string{"sensor": "a"},
+	}
+
+	for _, test := range []struct {
+		name string
+		f    func() error
+	}{
+		{"Insert", func() error { return ro.Insert(m) }},
+		{"InsertNow", func() error { return ro.InsertNow(m) }},
+		{"Upsert", func() error { return ro.Upsert(m) }},
+		{"InsertBatch", func() error { return ro.InsertBatch([]*jdb.Measurement{m}) }},
+		{"Flush", ro.Flush},
+		{"Compact", ro.Compact},
+		{"SetFieldMetadata", func() error {
+			return ro.SetFieldMetadata("wibbles", "wobble_count", jdb.FieldMeta{Unit: "wobbles"})
+		}},
+		{"DeleteByTimeRange", func() error {
+			_, err := ro.DeleteByTimeRange("wibbles", start, start.Add(time.Hour))
+
+			return err
+		}},
+		{"DeleteByID", func() error {
+			_, err := ro.DeleteByID(m.ID("sensor"))
+
+			return err
+		}},
+		{"PromoteLabelToIndex", func() error { return ro.PromoteLabelToIndex("wibbles", "sensor") }},
+		{"RenameIndex", func() error { return ro.RenameIndex("wibbles", "sensor", "sensor_id") }},
+	} {
+		t.Run(test.name+" returns ErrReadOnly", func(t *testing.T) {
+			err := test.f()
+			if !errors.Is(err, jdb.ErrReadOnly) {
+				t.Errorf("expected %#v, received %#v", jdb.ErrReadOnly, err)
+			}
+		})
+	}
+
+	t.Run("Database is unchanged after writes are refused", func(t *testing.T) {
+		m, err := ro.QueryAll("wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 10 {
+			t.Errorf("expected %d measurements, received %d", 10, len(m))
+		}
+	})
+
+	t.Run("Closing succeeds, and leaves the file untouched", func(t *testing.T) {
+		err := ro.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(before, after) {
+			t.Error("expected file to be unchanged")
+		}
+	})
+
+	t.Run("Opening an empty file doesn't write a header", func(t *testing.T) {
+		empty := filepath.Join(t.TempDir(), "empty.db")
+
+		err := os.WriteFile(empty, nil, 0o444)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := jdb.OpenReadOnly(empty)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(empty)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fi.Size() != 0 {
+			t.Errorf("expected empty file, received %d bytes", fi.Size())
+		}
+	})
+
+	t.Run("Opening a missing file fails", func(t *testing.T) {
+		_, err := jdb.OpenReadOnly(filepath.Join(t.TempDir(), "missing.db"))
+		if err == nil {
+			t.Error("expected error, received nil")
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package jdb
+
+import (
+	"errors"
+	"slices"
+)
+
+// ErrInvalidMaxPoints returns when WithMaxPointsPerIndex is passed a limit of
+// zero, or less
+var ErrInvalidMaxPoints = errors.New("max points per index must be greater than zero")
+
+// WithMaxPointsPerIndex configures a JDB to keep, at most, n Measurements for each
+// value of each index, such that memory is bounded by the number of distinct index
+// values rather than by ingest rate. This turns each index value into a ring buffer.
+//
+// When an insert takes an index value over n, the oldest Measurements for that value
+// are dropped from every index, and from the save buffer. Measurements without indices
+// are indexed by `_default_index`, and so are limited to n per Measurement name.
+//
+// Note that a Measurement inserted with a timestamp older than everything else for
+// an index value which is already full is dropped straight away.
+//
+// Limits are applied when loading a database too, but the file itself is append-only,
+// and so dropped Measurements are only removed from disk by `Compact`
+func WithMaxPointsPerIndex(n int) OpenOption {
+	return func(j *JDB) error {
+		if n <= 0 {
+			return ErrInvalidMaxPoints
+		}
+
+		j.maxPointsPerIndex = n
+
+		return nil
+	}
+}
+
+// evictOldest drops the oldest Measurements for every index value of ms which
+// has more than maxPointsPerIndex Measurements.
+//
+// Callers must hold saveMutex, and must have sorted any shards ms were added to
+func (j *JDB) evictOldest(ms ...*Measurement) {
+	if j.maxPointsPerIndex == 0 {
+		return
+	}
+
+	for _, m := range ms {
+		for k, v := range m.Indices {
+			j.evictIndexValue(m.Name, k, v)
+		}
+	}
+}
+
+// evictAll applies maxPointsPerIndex to every index value, such as after
+// loading a database from disk. Callers must hold saveMutex
+func (j *JDB) evictAll() {
+	if j.maxPointsPerIndex == 0 {
+		return
+	}
+
+	for name, idx := range j.indices {
+		for k, values := range idx {
+			for v := range values {
+				j.evictIndexValue(name, k, v)
+			}
+		}
+	}
+}
+
+// evictIndexValue drops the oldest Measurements for a specific index value until
+// there are no more than maxPointsPerIndex
+func (j *JDB) evictIndexValue(name, k, v string) {
+	shards := j.indices[name][k][v]
+
+	count := 0
+	for _, shard := range shards {
+		count += len(shard)
+	}
+
+	for ; count > j.maxPointsPerIndex; count-- {
+		// Shards are sorted, so the oldest Measurement is the first
+		// Measurement of whichever shard starts earliest
+		var oldest *Measurement
+		for _, shard := range shards {
+			if oldest == nil || shard[0].When.Before(oldest.When) {
+				oldest = shard[0]
+			}
+		}
+
+		j.evict(oldest)
+	}
+}
+
+// evict removes a single Measurement from j.measurements, j.indices, j.ids, and
+// the save buffer.
+//
+// Unlike deleteWhere, evict only looks at the shards m sits in, which keeps inserts
+// cheap when every insert evicts something
+func (j *JDB) evict(m *Measurement) {
+	dts := m.dts(j.granularity)
+
+	removeFromShard(j.measurements[m.Name], dts, m)
+
+	for k, v := range m.Indices {
+		values := j.indices[m.Name][k]
+
+		removeFromShard(values[v], dts, m)
+		if len(values[v]) == 0 {
+			delete(values, v)
+		}
+	}
+
+	for _, id := range m.ids(j.dedupe) {
+		if j.ids[id] == m {
+			delete(j.ids, id)
+		}
+	}
+
+	buffered := len(j.saveBuffer)
+
+	j.saveBuffer = slices.DeleteFunc(j.saveBuffer, func(b *Measurement) bool {
+		return b == m
+	})
+
+	if len(j.saveBuffer) != buffered {
+		j.resetBuffered()
+	}
+}
+
+// removeFromShard removes m from shards[dts], removing the shard entirely
+// where it ends up empty
+func removeFromShard(shards map[string][]*Measurement, dts string, m *Measurement) {
+	shard := slices.DeleteFunc(shards[dts], func(s *Measurement) bool {
+		return s == m
+	})
+
+	if len(shard) == 0 {
+		delete(shards, dts)
+
+		return
+	}
+
+	shards[dts] = shard
+}
@@ -0,0 +1,131 @@
+package jdb_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestWithMaxPointsPerIndex(t *testing.T) {
+	t.Run("Invalid limits fail", func(t *testing.T) {
+		_, err := jdb.NewInMemory(jdb.WithMaxPointsPerIndex(0))
+		if !errors.Is(err, jdb.ErrInvalidMaxPoints) {
+			t.Errorf("expected: %v, received %#v", jdb.ErrInvalidMaxPoints, err)
+		}
+	})
+
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name(), jdb.WithMaxPointsPerIndex(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Add(0 - time.Hour)
+	for i := 0; i < 10; i++ {
+		for _, location := range []string{"kitchen", "bedroom"} {
+			err = db.Insert(&jdb.Measurement{
+				Name:       "environment",
+				When:       now.Add(time.Minute * time.Duration(i)),
+				Dimensions: map[string]float64{"temperature": float64(i)},
+				Indices:    map[string]string{"location": location},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Batches, and Measurements without indices, are limited too
+	batch := make([]*jdb.Measurement, 0)
+	for i := 0; i < 5; i++ {
+		batch = append(batch, &jdb.Measurement{
+			Name:       "requests",
+			When:       now.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"count": float64(i)},
+		})
+	}
+
+	err = db.InsertBatch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		db          func() *jdb.JDB
+		expectFirst float64
+	}{
+		{"Limits apply on insert", func() *jdb.JDB { return db }, 7},
+		{"Limits apply on load", func() *jdb.JDB {
+			err := db.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Reopen with a smaller limit, to ensure limits are applied
+			// to what's loaded
+			db, err = jdb.New(f.Name(), jdb.WithMaxPointsPerIndex(2))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return db
+		}, 8},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db := test.db()
+			limit := int(10 - test.expectFirst)
+
+			for _, location := range []string{"kitchen", "bedroom"} {
+				m, err := db.QueryAllIndex("environment", "location", location, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(m) != limit {
+					t.Fatalf("expected %d measurements, received %d", limit, len(m))
+				}
+
+				if m[0].Dimensions["temperature"] != test.expectFirst {
+					t.Errorf("expected: %v, received %v", test.expectFirst, m[0].Dimensions["temperature"])
+				}
+			}
+
+			m, err := db.QueryAll("environment", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m) != limit*2 {
+				t.Errorf("expected %d measurements, received %d", limit*2, len(m))
+			}
+
+			m, err = db.QueryAll("requests", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m) != limit {
+				t.Errorf("expected %d measurements, received %d", limit, len(m))
+			}
+
+			_, err = db.Verify()
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,163 @@
+package jdb
+
+import (
+	"container/heap"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// parallelScanShards is the number of shards a query must cover before
+// scanShards spreads the work across goroutines; below this, starting
+// goroutines costs more than it saves
+var parallelScanShards = 64
+
+// scanShards returns the Measurements within each shard which fit within opts,
+// including its DimensionFilters, omitting shards with none. Where opts is nil, every shard is returned as-is.
+//
+// Where there are enough shards, they're scanned across up to GOMAXPROCS
+// goroutines. Callers must hold saveMutex, which is held for the duration
+func scanShards(shards map[string][]*Measurement, opts *Options) (out [][]*Measurement) {
+	in := make([][]*Measurement, 0, len(shards))
+	for _, shard := range shards {
+		if len(shard) > 0 {
+			in = append(in, shard)
+		}
+	}
+
+	if opts == nil {
+		return in
+	}
+
+	// Every shard is scanned against the same range, rather than one
+	// recalculated against the current time per shard
+	from, to := opts.mRange()
+
+	workers := min(runtime.GOMAXPROCS(0), len(in)/parallelScanShards)
+	if workers <= 1 {
+		out = in[:0]
+		for _, shard := range in {
+			if v := opts.filterDimensions(shardInRange(shard, from, to)); len(v) > 0 {
+				out = append(out, v)
+			}
+		}
+
+		return
+	}
+
+	// Each worker scans a contiguous chunk of shards, writing results
+	// back to the same position, and so no further locking is needed
+	var wg sync.WaitGroup
+
+	chunk := (len(in) + workers - 1) / workers
+	for start := 0; start < len(in); start += chunk {
+		wg.Add(1)
+
+		go func(shards [][]*Measurement) {
+			defer wg.Done()
+
+			for i, shard := range shards {
+				shards[i] = opts.filterDimensions(shardInRange(shard, from, to))
+			}
+		}(in[start:min(start+chunk, len(in))])
+	}
+
+	wg.Wait()
+
+	out = in[:0]
+	for _, shard := range in {
+		if len(shard) > 0 {
+			out = append(out, shard)
+		}
+	}
+
+	return
+}
+
+// mergeShards merges a set of shards, each sorted by When, into a single
+// sorted slice, as per mergeRuns
+func mergeShards(shards [][]*Measurement) (m []*Measurement) {
+	n := 0
+	for _, shard := range shards {
+		n += len(shard)
+	}
+
+	m = make([]*Measurement, 0, n)
+
+	mergeRuns(shards, func(run []*Measurement) bool {
+		m = append(m, run...)
+
+		return true
+	})
+
+	return
+}
+
+// mergeRuns walks a set of shards, each sorted by When, in order, using a
+// k-way merge, and calls fn with each run of Measurements in turn until fn
+// returns false.
+//
+// Shards rarely overlap, since each covers a distinct period of time, and so
+// rather than merging a Measurement at a time, each run is every Measurement
+// from the earliest shard which comes before the next shard starts; for shards
+// which don't overlap, that's the whole shard
+func mergeRuns(shards [][]*Measurement, fn func(run []*Measurement) bool) {
+	h := make(shardHeap, 0, len(shards))
+	for _, shard := range shards {
+		if len(shard) > 0 {
+			h = append(h, shard)
+		}
+	}
+
+	heap.Init(&h)
+
+	for len(h) > 1 {
+		shard := h[0]
+
+		// The next shard to start is whichever child of the head of
+		// the heap starts first
+		next := h[1][0]
+		if len(h) > 2 && h[2][0].When.Before(next.When) {
+			next = h[2][0]
+		}
+
+		k := sort.Search(len(shard), func(i int) bool {
+			return shard[i].When.After(next.When)
+		})
+
+		if !fn(shard[:k]) {
+			return
+		}
+
+		if k == len(shard) {
+			heap.Pop(&h)
+
+			continue
+		}
+
+		h[0] = shard[k:]
+		heap.Fix(&h, 0)
+	}
+
+	if len(h) == 1 {
+		fn(h[0])
+	}
+}
+
+// shardHeap is a min-heap of non-empty shards, ordered by the When of
+// their first Measurement
+type shardHeap [][]*Measurement
+
+func (h shardHeap) Len() int           { return len(h) }
+func (h shardHeap) Less(i, j int) bool { return h[i][0].When.Before(h[j][0].When) }
+func (h shardHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *shardHeap) Push(x any)        { *h = append(*h, x.([]*Measurement)) }
+
+func (h *shardHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+
+	return x
+}
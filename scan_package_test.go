@@ -0,0 +1,159 @@
+package jdb
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMergeShards(t *testing.T) {
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	shard := func(minutes ...int) (s []*Measurement) {
+		for _, m := range minutes {
+			s = append(s, &Measurement{When: start.Add(time.Minute * time.Duration(m))})
+		}
+
+		return
+	}
+
+	for _, test := range []struct {
+		name   string
+		shards [][]*Measurement
+		expect []int
+	}{
+		{"No shards", nil, []int{}},
+		{"Empty shards are skipped", [][]*Measurement{shard(), shard(1, 2), shard()}, []int{1, 2}},
+		{"Disjoint shards are concatenated in order", [][]*Measurement{shard(7, 8, 9), shard(1, 2, 3), shard(4, 5, 6)}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"Overlapping shards are interleaved", [][]*Measurement{shard(1, 4, 7), shard(2, 5, 8), shard(3, 6, 9)}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"Partially overlapping shards are merged", [][]*Measurement{shard(5, 6, 7, 20), shard(1, 2, 8), shard(3, 9, 10)}, []int{1, 2, 3, 5, 6, 7, 8, 9, 10, 20}},
+		{"Duplicate timestamps are kept", [][]*Measurement{shard(1, 1, 2), shard(2, 3)}, []int{1, 1, 2, 2, 3}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := mergeShards(test.shards)
+
+			rcvd := make([]int, 0, len(m))
+			for _, measurement := range m {
+				rcvd = append(rcvd, int(measurement.When.Sub(start)/time.Minute))
+			}
+
+			if !slices.Equal(test.expect, rcvd) {
+				t.Errorf("expected: %v, received %v", test.expect, rcvd)
+			}
+		})
+	}
+}
+
+func TestScanShards_parallel(t *testing.T) {
+	j := benchmarkJDB(t, 10_000)
+
+	from := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC).Add(time.Minute * 1234)
+	opts := &Options{From: from, To: from.Add(time.Hour * 20)}
+
+	serial := mergeShards(scanShards(j.measurements["wibbles"], opts))
+
+	// Force the parallel path, even on machines with a single CPU
+	defer func(n, procs int) {
+		parallelScanShards = n
+		runtime.GOMAXPROCS(procs)
+	}(parallelScanShards, runtime.GOMAXPROCS(4))
+
+	parallelScanShards = 1
+
+	parallel := mergeShards(scanShards(j.measurements["wibbles"], opts))
+
+	if len(serial) != 1201 {
+		t.Errorf("expected %d measurements, received %d", 1201, len(serial))
+	}
+
+	if !slices.Equal(serial, parallel) {
+		t.Errorf("expected %d measurements, received %d", len(serial), len(parallel))
+	}
+}
+
+// benchmarkJDB returns a JDB containing n Measurements, a minute apart
+func benchmarkJDB(tb testing.TB, n int) *JDB {
+	j, err := NewInMemory()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	batch := make([]*Measurement, 0, n)
+	for i := 0; i < n; i++ {
+		batch = append(batch, &Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+		})
+	}
+
+	err = j.InsertBatch(batch)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return j
+}
+
+// serialQueryAll is how queryAll gathered shards before scanShards and
+// mergeShards, and is kept as a baseline for BenchmarkQueryAll
+func serialQueryAll(shards map[string][]*Measurement, opts *Options) (m []*Measurement) {
+	tmpM := make([][]*Measurement, 0)
+	for _, shard := range shards {
+		from, to := opts.mRange()
+
+		if v := shardInRange(shard, from, to); len(v) > 0 {
+			tmpM = append(tmpM, v)
+		}
+	}
+
+	slices.SortFunc(tmpM, func(a, b []*Measurement) int {
+		return a[0].When.Compare(b[0].When)
+	})
+
+	m = make([]*Measurement, 0)
+	for _, t := range tmpM {
+		m = append(m, t...)
+	}
+
+	return
+}
+
+func BenchmarkQueryAll(b *testing.B) {
+	// A million points, a minute apart, which is nearly two years'
+	// worth of hourly shards
+	j := benchmarkJDB(b, 1_000_000)
+	shards := j.measurements["wibbles"]
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	for _, r := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"one day", time.Hour * 24},
+		{"one month", time.Hour * 24 * 30},
+		{"one year", time.Hour * 24 * 365},
+	} {
+		// Start partway through a shard, so that the first and last
+		// shards need scanning
+		from := start.Add(time.Hour*24*30 + time.Minute*30)
+		opts := &Options{From: from, To: from.Add(r.d)}
+
+		b.Run(fmt.Sprintf("serial sort, %s", r.name), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				serialQueryAll(shards, opts)
+			}
+		})
+
+		b.Run(fmt.Sprintf("parallel merge, %s", r.name), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				mergeShards(scanShards(shards, opts))
+			}
+		})
+	}
+}
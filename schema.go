@@ -0,0 +1,279 @@
+package jdb
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+var (
+	// ErrNoSuchLabel returns when trying to promote a label which doesn't exist
+	// for the specified Measurement
+	ErrNoSuchLabel = errors.New("unknown label")
+
+	// ErrDefaultIndex returns when trying to demote `_default_index`, which jdb
+	// relies on for deduplication
+	ErrDefaultIndex = errors.New("the default index can't be demoted")
+
+	// ErrEmptyIndexName returns when trying to rename an index to an empty name
+	ErrEmptyIndexName = errors.New("index name must not be empty")
+)
+
+// Schema returns the field types of every Measurement, keyed by Measurement name
+// and then field name, as per `QueryFieldTypes`, which is useful for getting an
+// overview of a whole database at once.
+//
+// The returned maps are a copy, and so are safe to modify
+func (j *JDB) Schema() (s map[string]map[string]string) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	s = make(map[string]map[string]string, len(j.measurementFields))
+	for name, fm := range j.measurementFields {
+		s[name] = make(map[string]string, len(fm))
+		for f, t := range fm {
+			s[name][f] = t.String()
+		}
+	}
+
+	return
+}
+
+// PromoteLabelToIndex turns a label into an index for every Measurement of a specific
+// name, allowing Measurements to be queried by a field which was originally stored as
+// a label to save memory.
+//
+// Measurements without the label are left as they are. PromoteLabelToIndex returns
+// ErrNoSuchLabel where no Measurement has the label, and an error wrapping
+// ErrFieldTypeConflict where the field is already an index or dimension.
+//
+// Promotion rewrites the Measurements in question, and then compacts the database so
+// that the change survives reopening. As with `Compact`, inserts will block until it is
+// finished
+func (j *JDB) PromoteLabelToIndex(name, field string) (err error) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		return ErrReadOnly
+	}
+
+	fields, ok := j.measurementFields[name]
+	if !ok {
+		return ErrNoSuchMeasurement
+	}
+
+	t, ok := fields[field]
+	if !ok {
+		return ErrNoSuchLabel
+	}
+
+	if t != label {
+		return fmt.Errorf("%w: %s.%s is a %s, not a label", ErrFieldTypeConflict, name, field, t)
+	}
+
+	return j.rewriteMeasurements(name, func(m *Measurement) {
+		v, ok := m.Labels[field]
+		if !ok {
+			return
+		}
+
+		delete(m.Labels, field)
+		m.Indices[field] = v
+	})
+}
+
+// DemoteIndexToLabel turns an index into a label for every Measurement of a specific
+// name, reclaiming the memory used to index that field.
+//
+// Measurements left without any indices are given `_default_index`, as per `Validate`,
+// so that deduplication continues to work. Where demotion would leave two Measurements
+// indistinguishable from one another (which is to say, where they differ only by the
+// demoted index), DemoteIndexToLabel returns an error wrapping ErrDuplicateMeasurement
+// and leaves the database untouched.
+//
+// Demotion can only be reversed with `PromoteLabelToIndex`; until then, queries against
+// the index return ErrNoSuchIndex. As with promotion, demotion compacts the database so
+// that the change survives reopening
+func (j *JDB) DemoteIndexToLabel(name, field string) (err error) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		return ErrReadOnly
+	}
+
+	if _, ok := j.indices[name]; !ok {
+		return ErrNoSuchMeasurement
+	}
+
+	if _, ok := j.indices[name][field]; !ok {
+		return ErrNoSuchIndex
+	}
+
+	if field == DefaultIndexName {
+		return ErrDefaultIndex
+	}
+
+	demote := func(m *Measurement) {
+		v, ok := m.Indices[field]
+		if !ok {
+			return
+		}
+
+		delete(m.Indices, field)
+		if len(m.Indices) == 0 {
+			m.Indices[DefaultIndexName] = m.Name
+		}
+
+		if m.Labels == nil {
+			m.Labels = make(map[string]string)
+		}
+
+		m.Labels[field] = v
+	}
+
+	// Check that demotion won't cause any Measurements to clash before
+	// actually doing anything
+	seen := make(map[string]bool)
+	for _, shard := range j.measurements[name] {
+		for _, m := range shard {
+			if !j.isLive(m) {
+				continue
+			}
+
+			m = m.clone()
+			demote(m)
+
+			for _, id := range m.ids(j.dedupe) {
+				if seen[id] {
+					return fmt.Errorf("%w: demoting %s.%s would merge Measurements at %s", ErrDuplicateMeasurement, name, field, m.When)
+				}
+
+				seen[id] = true
+			}
+		}
+	}
+
+	return j.rewriteMeasurements(name, demote)
+}
+
+// RenameIndex renames an index of every Measurement of a specific name, such as from
+// "host" to "hostname", without losing any data.
+//
+// Because index names form part of Measurement ids (see `Measurement.ID`), ids are
+// re-derived for every Measurement, and so ids derived from oldIndex before renaming no
+// longer refer to anything. Any field metadata set for oldIndex moves to newIndex.
+//
+// RenameIndex returns ErrEmptyIndexName where newIndex is empty, ErrNoSuchMeasurement or
+// ErrNoSuchIndex where either don't exist, and ErrFieldInUse where newIndex is already
+// the name of a field of this Measurement.
+//
+// As with `PromoteLabelToIndex`, renaming compacts the database so that the change
+// survives reopening, and inserts will block until it is finished
+func (j *JDB) RenameIndex(measurement, oldIndex, newIndex string) (err error) {
+	if len(newIndex) == 0 {
+		return ErrEmptyIndexName
+	}
+
+	err = validateName(newIndex)
+	if err != nil {
+		return
+	}
+
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	if j.readOnly {
+		return ErrReadOnly
+	}
+
+	fields, ok := j.measurementFields[measurement]
+	if !ok {
+		return ErrNoSuchMeasurement
+	}
+
+	if t, ok := fields[oldIndex]; !ok || t != index {
+		return ErrNoSuchIndex
+	}
+
+	if oldIndex == newIndex {
+		return
+	}
+
+	if _, ok := fields[newIndex]; ok {
+		return ErrFieldInUse
+	}
+
+	// Metadata is written as part of the rewrite, and so must be moved first
+	if meta, ok := j.fieldMeta[measurement][oldIndex]; ok {
+		delete(j.fieldMeta[measurement], oldIndex)
+		j.setFieldMetadata(measurement, newIndex, meta)
+	}
+
+	return j.rewriteMeasurements(measurement, func(m *Measurement) {
+		v, ok := m.Indices[oldIndex]
+		if !ok {
+			return
+		}
+
+		delete(m.Indices, oldIndex)
+		m.Indices[newIndex] = v
+	})
+}
+
+// rewriteMeasurements replaces every live Measurement of a specific name with a
+// copy modified by fn, rebuilding every index, id, and field of that name from
+// scratch, before compacting the database to persist the change.
+//
+// Measurements are copied, rather than modified in place, because callers may still
+// hold Measurements returned from earlier queries.
+//
+// Callers must hold saveMutex
+func (j *JDB) rewriteMeasurements(name string, fn func(*Measurement)) (err error) {
+	err = j.flush()
+	if err != nil {
+		return
+	}
+
+	live := make([]*Measurement, 0)
+	for _, shard := range j.measurements[name] {
+		for _, m := range shard {
+			if j.isLive(m) {
+				live = append(live, m)
+			}
+
+			for _, id := range m.ids(j.dedupe) {
+				if j.ids[id] == m {
+					delete(j.ids, id)
+				}
+			}
+		}
+	}
+
+	delete(j.measurements, name)
+	delete(j.indices, name)
+	delete(j.measurementFields, name)
+
+	keys := make(map[shardKey]bool)
+	for _, m := range live {
+		m = m.clone()
+		fn(m)
+
+		fields, _ := m.fields()
+		j.addMeasurement(m, m.ids(j.dedupe), fields)
+
+		for _, k := range j.shardKeys(m) {
+			keys[k] = true
+		}
+	}
+
+	j.sortShards(slices.Collect(maps.Keys(keys)))
+
+	if j.store == nil {
+		return
+	}
+
+	return j.store.Rewrite(j.writeLive)
+}
@@ -0,0 +1,565 @@
+package jdb_test
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_Schema(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := db.Schema(); len(s) != 0 {
+		t.Errorf("expected empty schema, received %#v", s)
+	}
+
+	now := time.Now()
+	for _, m := range []*jdb.Measurement{
+		{
+			Name:       "environment",
+			When:       now,
+			Dimensions: map[string]float64{"temperature": 21.5},
+			Indices:    map[string]string{"location": "kitchen"},
+			Labels:     map[string]string{"sensor": "RP2040"},
+		},
+		{
+			Name:          "deployments",
+			When:          now,
+			IntDimensions: map[string]int64{"replicas": 3},
+			States:        map[string]bool{"healthy": true},
+		},
+	} {
+		err = db.Insert(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect := map[string]map[string]string{
+		"environment": {"temperature": "dimension", "location": "index", "sensor": "label"},
+		"deployments": {"replicas": "int_dimension", "healthy": "state", jdb.DefaultIndexName: "index"},
+	}
+
+	s := db.Schema()
+	if !maps.EqualFunc(expect, s, maps.Equal) {
+		t.Fatalf("expected: %v, received %#v", expect, s)
+	}
+
+	// Modifying the returned schema mustn't affect the database
+	s["environment"]["temperature"] = "label"
+	delete(s, "deployments")
+
+	if s = db.Schema(); !maps.EqualFunc(expect, s, maps.Equal) {
+		t.Errorf("expected: %v, received %#v", expect, s)
+	}
+}
+
+func TestJDB_PromoteLabelToIndex(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		m := &jdb.Measurement{
+			Name: "deployments",
+			When: now.Add(0 - time.Minute*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"duration": float64(i),
+			},
+			Labels: map[string]string{
+				"version": []string{"v1.0.0", "v1.1.0"}[i%2],
+			},
+			Indices: map[string]string{
+				"service": "api",
+			},
+		}
+
+		// The odd Measurement without the label
+		if i == 9 {
+			m.Labels = nil
+		}
+
+		err = db.Insert(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before, err := db.QueryAll("deployments", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		field       string
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", "version", jdb.ErrNoSuchMeasurement},
+		{"Unknown label fails", "deployments", "wazzles", jdb.ErrNoSuchLabel},
+		{"Dimensions can't be promoted", "deployments", "duration", jdb.ErrFieldTypeConflict},
+		{"Indices can't be promoted", "deployments", "service", jdb.ErrFieldTypeConflict},
+		{"Labels are promoted", "deployments", "version", nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := db.PromoteLabelToIndex(test.measurement, test.field)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+		})
+	}
+
+	check := func(t *testing.T, db *jdb.JDB) {
+		for _, test := range []struct {
+			value  string
+			expect int
+		}{
+			{"v1.0.0", 5},
+			{"v1.1.0", 4},
+		} {
+			m, err := db.QueryAllIndex("deployments", "version", test.value, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expect != len(m) {
+				t.Errorf("%s: expected %d measurements, received %d", test.value, test.expect, len(m))
+			}
+
+			for _, rcvd := range m {
+				if _, ok := rcvd.Labels["version"]; ok {
+					t.Errorf("%s: expected label to be removed", test.value)
+				}
+			}
+		}
+
+		m, err := db.QueryAllIndex("deployments", "service", "api", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 10 {
+			t.Errorf("expected 10 measurements, received %d", len(m))
+		}
+
+		types, err := db.QueryFieldTypes("deployments")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if types["version"] != "index" {
+			t.Errorf("expected: index, received %q", types["version"])
+		}
+	}
+
+	t.Run("Promoted labels are queryable", func(t *testing.T) {
+		check(t, db)
+	})
+
+	t.Run("Previously returned Measurements are untouched", func(t *testing.T) {
+		if _, ok := before[0].Indices["version"]; ok {
+			t.Error("expected previously returned Measurement to be unmodified")
+		}
+	})
+
+	t.Run("Promotion survives reopening", func(t *testing.T) {
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = jdb.New(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		check(t, db)
+	})
+}
+
+func TestJDB_DemoteIndexToLabel(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "requests",
+			When: now.Add(0 - time.Minute*time.Duration(i)),
+			Dimensions: map[string]float64{
+				"duration": float64(i),
+			},
+			Indices: map[string]string{
+				"request_id": string(rune('a' + i)),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, host := range []string{"alpha", "bravo"} {
+			err = db.Insert(&jdb.Measurement{
+				Name: "load",
+				When: now.Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"load": float64(i),
+				},
+				Indices: map[string]string{
+					"host": host,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		measurement string
+		field       string
+		expectErr   error
+	}{
+		{"Unknown measurement fails", "zimzams", "request_id", jdb.ErrNoSuchMeasurement},
+		{"Unknown index fails", "requests", "wazzles", jdb.ErrNoSuchIndex},
+		{"The default index can't be demoted", "requests", jdb.DefaultIndexName, jdb.ErrNoSuchIndex},
+		{"Demoting indices which would merge Measurements fails", "load", "host", jdb.ErrDuplicateMeasurement},
+		{"Indices are demoted", "requests", "request_id", nil},
+		{"The default index can't be demoted once added", "requests", jdb.DefaultIndexName, jdb.ErrDefaultIndex},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := db.DemoteIndexToLabel(test.measurement, test.field)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+		})
+	}
+
+	check := func(t *testing.T, db *jdb.JDB) {
+		_, err := db.QueryAllIndex("requests", "request_id", "a", nil)
+		if !errors.Is(err, jdb.ErrNoSuchIndex) {
+			t.Errorf("expected jdb.ErrNoSuchIndex, received %#v", err)
+		}
+
+		m, err := db.QueryAllIndex("requests", jdb.DefaultIndexName, "requests", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 10 {
+			t.Errorf("expected 10 measurements, received %d", len(m))
+		}
+
+		for _, rcvd := range m {
+			if rcvd.Labels["request_id"] == "" {
+				t.Error("expected request_id label")
+			}
+		}
+
+		m, err = db.QueryAllIndex("load", "host", "alpha", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 10 {
+			t.Errorf("expected 10 measurements, received %d", len(m))
+		}
+	}
+
+	t.Run("Demoted indices are labels", func(t *testing.T) {
+		check(t, db)
+	})
+
+	t.Run("Demotion survives reopening", func(t *testing.T) {
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = jdb.New(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		check(t, db)
+	})
+
+	t.Run("Demoted labels can be promoted again", func(t *testing.T) {
+		defer db.Close()
+
+		err = db.PromoteLabelToIndex("requests", "request_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := db.QueryAllIndex("requests", "request_id", "a", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 1 {
+			t.Errorf("expected 1 measurement, received %d", len(m))
+		}
+	})
+}
+
+func TestJDB_RenameIndex(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	measurement := func(i int, host string) *jdb.Measurement {
+		return &jdb.Measurement{
+			Name: "environment",
+			When: start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"temperature": float64(i),
+			},
+			Labels: map[string]string{
+				"unit": "celsius",
+			},
+			Indices: map[string]string{
+				"host":     host,
+				"location": "kitchen",
+			},
+		}
+	}
+
+	var original *jdb.Measurement
+	for i := 0; i < 10; i++ {
+		original = measurement(i, "sensor-1")
+
+		err = db.Insert(original)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Supersede the latest Measurement, which should remain superseded
+	upserted := measurement(9, "sensor-1")
+	upserted.Dimensions["temperature"] = 100
+
+	err = db.Upsert(upserted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldID := original.ID("host")
+
+	for _, test := range []struct {
+		name      string
+		oldIndex  string
+		newIndex  string
+		expectErr error
+	}{
+		{"Unknown index fails", "wazzles", "hostname", jdb.ErrNoSuchIndex},
+		{"Renaming a label fails", "unit", "hostname", jdb.ErrNoSuchIndex},
+		{"Renaming onto an existing index fails", "host", "location", jdb.ErrFieldInUse},
+		{"Renaming onto a dimension fails", "host", "temperature", jdb.ErrFieldInUse},
+		{"Renaming to nothing fails", "host", "", jdb.ErrEmptyIndexName},
+		{"Renaming to an invalid name fails", "host", "host\x00name", jdb.ErrInvalidName},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := db.RenameIndex("environment", test.oldIndex, test.newIndex)
+			if !errors.Is(err, test.expectErr) {
+				t.Errorf("expected %#v, received %#v", test.expectErr, err)
+			}
+		})
+	}
+
+	err = db.RenameIndex("zimzams", "host", "hostname")
+	if !errors.Is(err, jdb.ErrNoSuchMeasurement) {
+		t.Errorf("expected %#v, received %#v", jdb.ErrNoSuchMeasurement, err)
+	}
+
+	err = db.SetFieldMetadata("environment", "host", jdb.FieldMeta{Description: "Sensor hostname"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.RenameIndex("environment", "host", "hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Close and reopen, to ensure the rename was persisted
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	t.Run("Measurements already returned are untouched", func(t *testing.T) {
+		if _, ok := original.Indices["host"]; !ok {
+			t.Errorf("expected original Measurement to keep its index, received %#v", original.Indices)
+		}
+	})
+
+	t.Run("Old ids no longer exist", func(t *testing.T) {
+		if _, ok := db.GetByID(oldID); ok {
+			t.Errorf("expected %q to be gone", oldID)
+		}
+	})
+
+	t.Run("Ids are re-derived from the new index name", func(t *testing.T) {
+		renamed := measurement(8, "sensor-1")
+		renamed.Indices["hostname"] = renamed.Indices["host"]
+		delete(renamed.Indices, "host")
+
+		m, ok := db.GetByID(renamed.ID("hostname"))
+		if !ok {
+			t.Fatal("expected renamed id to exist")
+		}
+
+		if m.Indices["hostname"] != "sensor-1" {
+			t.Errorf("expected: %q, received %#v", "sensor-1", m.Indices)
+		}
+
+		err = db.Insert(renamed)
+		if !errors.Is(err, jdb.ErrDuplicateMeasurement) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrDuplicateMeasurement, err)
+		}
+	})
+
+	t.Run("Ids from other indices are unchanged", func(t *testing.T) {
+		if _, ok := db.GetByID(measurement(0, "sensor-1").ID("location")); !ok {
+			t.Error("expected location id to exist")
+		}
+	})
+
+	t.Run("Queries use the new index name", func(t *testing.T) {
+		_, err := db.QueryAllIndex("environment", "host", "sensor-1", nil)
+		if !errors.Is(err, jdb.ErrNoSuchIndex) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrNoSuchIndex, err)
+		}
+
+		m, err := db.QueryAllIndex("environment", "hostname", "sensor-1", &jdb.Options{Deduplicate: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 10 {
+			t.Fatalf("expected 10 measurements, received %d", len(m))
+		}
+
+		if v := m[9].Dimensions["temperature"]; v != 100 {
+			t.Errorf("expected: %v, received %v", 100, v)
+		}
+	})
+
+	t.Run("Field types are updated", func(t *testing.T) {
+		fields, err := db.QueryFieldTypes("environment")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := fields["host"]; ok {
+			t.Errorf("expected host to be gone, received %#v", fields)
+		}
+
+		if fields["hostname"] != "index" {
+			t.Errorf("expected: %q, received %#v", "index", fields)
+		}
+	})
+
+	t.Run("Field metadata moves to the new index", func(t *testing.T) {
+		meta, err := db.FieldMetadata("environment", "hostname")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if meta.Description != "Sensor hostname" {
+			t.Errorf("expected: %q, received %#v", "Sensor hostname", meta)
+		}
+	})
+}
+
+func TestJDB_RenameIndex_DedupeAllIndices(t *testing.T) {
+	db, err := jdb.NewInMemory(jdb.WithDedupeKey(jdb.DedupeAllIndices))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &jdb.Measurement{
+		Name: "environment",
+		When: time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC),
+		Dimensions: map[string]float64{
+			"temperature": 21,
+		},
+		Indices: map[string]string{
+			"host":     "sensor-1",
+			"location": "kitchen",
+		},
+	}
+
+	err = db.Insert(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldIDs := m.IDs(jdb.DedupeAllIndices)
+
+	err = db.RenameIndex("environment", "host", "hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := db.GetByID(oldIDs[0]); ok {
+		t.Errorf("expected %q to be gone", oldIDs[0])
+	}
+
+	renamed := &jdb.Measurement{
+		Name:       m.Name,
+		When:       m.When,
+		Dimensions: m.Dimensions,
+		Indices: map[string]string{
+			"hostname": "sensor-1",
+			"location": "kitchen",
+		},
+	}
+
+	newIDs := renamed.IDs(jdb.DedupeAllIndices)
+	if _, ok := db.GetByID(newIDs[0]); !ok {
+		t.Errorf("expected %q to exist", newIDs[0])
+	}
+}
@@ -0,0 +1,110 @@
+package jdb
+
+import (
+	"io"
+	"time"
+)
+
+// Snapshot is an immutable, point-in-time, view of a JDB, as returned by
+// `JDB.Snapshot`.
+//
+// Queries against a Snapshot return the same results no matter what is inserted into,
+// or deleted from, the JDB it was taken from afterwards. This makes Snapshots ideal for
+// long analytical scans which need a consistent view of the data, without holding up
+// writers for the duration.
+//
+// Snapshots are safe for concurrent use, and need no closing; they're freed once
+// no longer referenced
+type Snapshot struct {
+	db *JDB
+}
+
+// Snapshot returns an immutable, point-in-time, view of this JDB.
+//
+// Taking a Snapshot copies the shards of every Measurement name and index, but not
+// the Measurements within them, which are never modified once inserted. Snapshots, then,
+// cost a pointer per Measurement per shard, and block writers only while those pointers
+// are copied
+func (j *JDB) Snapshot() *Snapshot {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	return &Snapshot{db: j.copy()}
+}
+
+// QueryAll works identically to `JDB.QueryAll`, against this Snapshot
+func (s *Snapshot) QueryAll(name string, opts *Options) ([]*Measurement, error) {
+	return s.db.QueryAll(name, opts)
+}
+
+// QueryAllPaged works identically to `JDB.QueryAllPaged`, against this Snapshot
+func (s *Snapshot) QueryAllPaged(name string, opts *Options) ([]*Measurement, int, error) {
+	return s.db.QueryAllPaged(name, opts)
+}
+
+// QueryAllIndex works identically to `JDB.QueryAllIndex`, against this Snapshot
+func (s *Snapshot) QueryAllIndex(name, index, indexValue string, opts *Options) ([]*Measurement, error) {
+	return s.db.QueryAllIndex(name, index, indexValue, opts)
+}
+
+// QueryAllCSV works identically to `JDB.QueryAllCSV`, against this Snapshot
+func (s *Snapshot) QueryAllCSV(name string, opts *Options) ([]byte, error) {
+	return s.db.QueryAllCSV(name, opts)
+}
+
+// WriteCSV works identically to `JDB.WriteCSV`, against this Snapshot
+func (s *Snapshot) WriteCSV(w io.Writer, name string, opts *Options) error {
+	return s.db.WriteCSV(w, name, opts)
+}
+
+// WriteNDJSON works identically to `JDB.WriteNDJSON`, against this Snapshot
+func (s *Snapshot) WriteNDJSON(w io.Writer, name string, opts *Options) error {
+	return s.db.WriteNDJSON(w, name, opts)
+}
+
+// QueryMany works identically to `JDB.QueryMany`, against this Snapshot
+func (s *Snapshot) QueryMany(names []string, opts *Options) ([]*Measurement, error) {
+	return s.db.QueryMany(names, opts)
+}
+
+// QueryPrefix works identically to `JDB.QueryPrefix`, against this Snapshot
+func (s *Snapshot) QueryPrefix(prefix string, opts *Options) (map[string][]*Measurement, error) {
+	return s.db.QueryPrefix(prefix, opts)
+}
+
+// QueryLatest works identically to `JDB.QueryLatest`, against this Snapshot
+func (s *Snapshot) QueryLatest(name, index string) (map[string]*Measurement, error) {
+	return s.db.QueryLatest(name, index)
+}
+
+// QueryLatestPerIndex works identically to `JDB.QueryLatestPerIndex`, against this Snapshot
+func (s *Snapshot) QueryLatestPerIndex(name, index string, opts *Options) ([]*Measurement, error) {
+	return s.db.QueryLatestPerIndex(name, index, opts)
+}
+
+// QueryNearest works identically to `JDB.QueryNearest`, against this Snapshot
+func (s *Snapshot) QueryNearest(name string, t time.Time, opts *Options) (*Measurement, error) {
+	return s.db.QueryNearest(name, t, opts)
+}
+
+// QueryFields works identically to `JDB.QueryFields`, against this Snapshot
+func (s *Snapshot) QueryFields(measurement string) ([]string, error) {
+	return s.db.QueryFields(measurement)
+}
+
+// QueryFieldTypes works identically to `JDB.QueryFieldTypes`, against this Snapshot
+func (s *Snapshot) QueryFieldTypes(measurement string) (map[string]string, error) {
+	return s.db.QueryFieldTypes(measurement)
+}
+
+// ForEach works identically to `JDB.ForEach`, against this Snapshot.
+//
+// Unlike `JDB.ForEach`, fn may safely write to the JDB this Snapshot was taken from
+func (s *Snapshot) ForEach(name string, opts *Options, fn func(*Measurement) error) error {
+	return s.db.ForEach(name, opts, fn)
+}
+
+// GetByID works identically to `JDB.GetByID`, against this Snapshot
+func (s *Snapshot) GetByID(id string) (*Measurement, bool) {
+	return s.db.GetByID(id)
+}
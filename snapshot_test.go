@@ -0,0 +1,119 @@
+package jdb_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_Snapshot(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	start := time.Now().Add(0 - time.Hour).Truncate(time.Hour)
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i*2+1)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+			Indices:    map[string]string{"sensor": "a"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap := db.Snapshot()
+
+	expect, err := snap.QueryAll("wibbles", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Insert into the same shards, out of order, such that shards are
+	// re-sorted, and then delete and upsert a few things too
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i*2)),
+			Dimensions: map[string]float64{"wobble_count": float64(100 + i)},
+			Indices:    map[string]string{"sensor": "a"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.Upsert(&jdb.Measurement{
+		Name:       "wibbles",
+		When:       start.Add(time.Minute),
+		Dimensions: map[string]float64{"wobble_count": 1000},
+		Indices:    map[string]string{"sensor": "a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.DeleteByTimeRange("wibbles", start.Add(time.Minute*10), start.Add(time.Minute*15))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		query func() ([]*jdb.Measurement, error)
+	}{
+		{"QueryAll is unaffected by writes", func() ([]*jdb.Measurement, error) { return snap.QueryAll("wibbles", nil) }},
+		{"QueryAllIndex is unaffected by writes", func() ([]*jdb.Measurement, error) { return snap.QueryAllIndex("wibbles", "sensor", "a", nil) }},
+		{"ForEach is unaffected by writes", func() (m []*jdb.Measurement, err error) {
+			err = snap.ForEach("wibbles", nil, func(measurement *jdb.Measurement) error {
+				m = append(m, measurement)
+
+				return nil
+			})
+
+			return
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := test.query()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(expect, m) {
+				t.Errorf("expected: %v, received %v", expect, m)
+			}
+		})
+	}
+
+	t.Run("The database itself sees writes", func(t *testing.T) {
+		m, err := db.QueryAll("wibbles", &jdb.Options{Deduplicate: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 14 {
+			t.Errorf("expected %d measurements, received %d", 14, len(m))
+		}
+	})
+
+	t.Run("ForEach callbacks may write to the database", func(t *testing.T) {
+		err := snap.ForEach("wibbles", nil, func(m *jdb.Measurement) error {
+			return db.Upsert(&jdb.Measurement{
+				Name:       "wobbles",
+				When:       m.When,
+				Dimensions: m.Dimensions,
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package jdb
+
+import (
+	"os"
+	"time"
+)
+
+// Stats describes the size of a JDB, as returned by `JDB.Stats`
+type Stats struct {
+	// Measurements is the total number of Measurements held in memory,
+	// including any duplicates created by `Upsert` which have yet to be
+	// compacted away
+	Measurements int `json:"measurements"`
+
+	// Names is the number of distinct Measurement names
+	Names int `json:"names"`
+
+	// IndexEntries is the total number of Measurements held across every
+	// index; a Measurement with three indices counts three times
+	IndexEntries int `json:"index_entries"`
+
+	// SaveBuffer is the number of Measurements waiting to be flushed
+	SaveBuffer int `json:"save_buffer"`
+
+	// FileSize is the size, in bytes, of the database file on disk. This is
+	// zero for in-memory databases, and for Stores which aren't files
+	FileSize int64 `json:"file_size"`
+}
+
+// Stats returns counts describing the size of this JDB, which is useful for
+// capacity planning.
+//
+// Stats only ever counts slice lengths, and so is cheap enough to call
+// regularly, such as from a metrics endpoint
+func (j *JDB) Stats() (s Stats) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	s.Names = len(j.measurements)
+	s.SaveBuffer = len(j.saveBuffer)
+
+	for _, shards := range j.measurements {
+		for _, shard := range shards {
+			s.Measurements += len(shard)
+		}
+	}
+
+	for _, measurement := range j.indices {
+		for _, idx := range measurement {
+			for _, shards := range idx {
+				for _, shard := range shards {
+					s.IndexEntries += len(shard)
+				}
+			}
+		}
+	}
+
+	s.FileSize, _ = j.fileSize()
+
+	return
+}
+
+// BufferLen returns the number of Measurements waiting to be flushed, as per
+// `Stats.SaveBuffer`, without counting everything else Stats does, which makes it
+// suitable for gauges polled frequently
+func (j *JDB) BufferLen() int {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	return len(j.saveBuffer)
+}
+
+// LastFlush returns when the save buffer was last flushed, or when the database
+// was opened where it has yet to be flushed. For in-memory databases, this is when
+// the buffer was last discarded
+func (j *JDB) LastFlush() time.Time {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	return j.lastSave
+}
+
+// Path returns the path of the file backing this JDB, as passed to `New`. Path
+// returns an empty string for in-memory databases, and for Stores which aren't files
+func (j *JDB) Path() string {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	if f, ok := j.store.(interface{ Name() string }); ok {
+		return f.Name()
+	}
+
+	return ""
+}
+
+// FileSize returns the size, in bytes, of the file backing this JDB, as per
+// `Stats.FileSize`, but returns any error encountered in finding it out. FileSize
+// returns zero for in-memory databases, and for Stores which aren't files
+func (j *JDB) FileSize() (size int64, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	return j.fileSize()
+}
+
+// fileSize returns the size of the file backing this JDB, where there is one.
+//
+// Callers must hold saveMutex
+func (j *JDB) fileSize() (size int64, err error) {
+	f, ok := j.store.(interface{ Stat() (os.FileInfo, error) })
+	if !ok {
+		return
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	return fi.Size(), nil
+}
+
+// UniqueCount returns the number of distinct Measurements in the database, once
+// deduplicated, as opposed to `Stats.Measurements`, which includes every version of
+// each upserted Measurement. The difference between the two is the cost of upserting,
+// which `Compact` reclaims.
+//
+// Each Measurement has an id per index, as per `Measurement.ID`, and so this isn't
+// simply the number of ids; UniqueCount counts the Measurements those ids point to,
+// which is linear in the number of ids, though doesn't touch any shards
+func (j *JDB) UniqueCount() int {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	unique := make(map[*Measurement]struct{}, len(j.ids))
+	for _, m := range j.ids {
+		unique[m] = struct{}{}
+	}
+
+	return len(unique)
+}
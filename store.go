@@ -0,0 +1,346 @@
+package jdb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store is the persistence backend for a JDB.
+//
+// A JDB reads a Store from start to finish exactly once, as it is opened, and from
+// then on only ever appends to it via Write. The only exception to this is Rewrite,
+// which is used by `Compact` to replace the contents of a Store wholesale.
+//
+// Data written to a Store is in exactly the same line-based format, regardless of
+// Store, and so Stores needn't understand what they're storing.
+type Store interface {
+	io.ReadWriteCloser
+
+	// Rewrite replaces the entire contents of the Store with whatever fn
+	// writes. This should be atomic, where possible, such that a failure part
+	// way through leaves the Store's original contents intact
+	Rewrite(fn func(io.Writer) error) error
+}
+
+// defaultFileMode is the permissions database files are created with, unless
+// configured otherwise by WithFileMode
+const defaultFileMode os.FileMode = 0640
+
+// ErrInvalidFileMode returns when WithFileMode is passed anything other than
+// permission bits, such as os.ModeDir
+var ErrInvalidFileMode = errors.New("file mode must only contain permission bits")
+
+// WithFileMode sets the permissions, such as 0600, that `New` creates database files
+// with, in place of the default 0640, along with the files written by `CompactTo`.
+//
+// As with os.OpenFile, permissions are subject to the process' umask, and files which
+// already exist keep whatever permissions they already have, including across `Compact`
+func WithFileMode(mode os.FileMode) OpenOption {
+	return func(j *JDB) error {
+		if mode&^os.ModePerm != 0 {
+			return ErrInvalidFileMode
+		}
+
+		j.fileMode = mode
+
+		return nil
+	}
+}
+
+// ErrFileModified returns when writing to a database file which has changed size
+// since this JDB last read or wrote it, which almost always means another process
+// has the same file open for writing.
+//
+// Rather than interleaving writes with the other process, or dropping its data by
+// compacting over the top of it, the write is refused, and the Measurements being
+// written remain buffered in memory.
+var ErrFileModified = errors.New("database file was modified by another process")
+
+// ErrLocked returns from `New` where another JDB, usually in another process,
+// already has the database file open, as per `WithoutLock`
+var ErrLocked = errors.New("database file is locked by another process")
+
+// WithoutLock stops `New` from taking an advisory lock on the database file, such
+// that the file can be opened while another process has it open too.
+//
+// By default, New takes an exclusive advisory lock (via flock) on the database file,
+// which is released by `Close`, and returns ErrLocked where another process already
+// holds it. This stops two processes from writing to the same file, and corrupting
+// it. Where the file is only going to be read, such as for analysis, `OpenReadOnly`
+// doesn't take the lock, and so needn't be passed this option.
+//
+// Locks are advisory, and so only stop other processes which also lock the file,
+// and are only taken on unix-like systems
+func WithoutLock() OpenOption {
+	return func(j *JDB) error {
+		j.noLock = true
+
+		return nil
+	}
+}
+
+// fileStore is the Store used by `New`, and backs a JDB with a file
+// on disk
+type fileStore struct {
+	*os.File
+
+	// size is the size we expect the file to be, having read it as it was
+	// loaded and written to it since, which is used to detect other processes
+	// writing to the same file
+	size int64
+
+	// locked is set where the file is locked, and so needs locking again
+	// whenever it is replaced by Rewrite
+	locked bool
+}
+
+// Read implements io.Reader, keeping track of how much of the file has
+// been read
+func (s *fileStore) Read(p []byte) (n int, err error) {
+	n, err = s.File.Read(p)
+	s.size += int64(n)
+
+	return
+}
+
+// Write implements io.Writer, keeping track of how much has been written,
+// so that checkSize knows how large the file should be
+func (s *fileStore) Write(p []byte) (n int, err error) {
+	n, err = s.File.Write(p)
+	s.size += int64(n)
+
+	return
+}
+
+// checkSize returns ErrFileModified where the file is no longer the size
+// we expect it to be, which is to say where it has changed size since it was
+// last read from or written to.
+//
+// This costs a syscall, and so is called once before each batch of writes,
+// such as a flush, rather than for every line
+func (s *fileStore) checkSize() (err error) {
+	fi, err := s.Stat()
+	if err != nil {
+		return
+	}
+
+	if fi.Size() != s.size {
+		return fmt.Errorf("%w: expected %d bytes, found %d", ErrFileModified, s.size, fi.Size())
+	}
+
+	return
+}
+
+func openFileStore(path string, mode os.FileMode, lock bool) (s *fileStore, err error) {
+	// #nosec: G302,G304
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, mode)
+	if err != nil {
+		return
+	}
+
+	if lock {
+		err = lockFile(f)
+		if err != nil {
+			_ = f.Close()
+
+			return
+		}
+	}
+
+	return &fileStore{File: f, locked: lock}, nil
+}
+
+// Rewrite writes to a temporary file alongside the database file, before
+// atomically renaming it into place
+func (s *fileStore) Rewrite(fn func(io.Writer) error) (err error) {
+	path := s.Name()
+
+	// Rewriting a file another process has written to would silently drop
+	// whatever it wrote
+	err = s.checkSize()
+	if err != nil {
+		return
+	}
+
+	fi, err := s.Stat()
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".compact-*")
+	if err != nil {
+		return
+	}
+
+	// If we return early then the temporary file is garbage, so tidy it up.
+	// Once the rename has occurred, this is a no-op
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	err = writeTemp(tmp, fi.Mode(), fn)
+	if err != nil {
+		return
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return
+	}
+
+	// #nosec: G302,G304
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, fi.Mode())
+	if err != nil {
+		return
+	}
+
+	// The lock belongs to the file we've just replaced, and so the new file
+	// is locked before the old one is closed, releasing its lock
+	if s.locked {
+		err = lockFile(f)
+		if err != nil {
+			_ = f.Close()
+
+			return
+		}
+	}
+
+	err = s.File.Close()
+	s.File = f
+
+	if err != nil {
+		return
+	}
+
+	fi, err = s.Stat()
+	if err != nil {
+		return
+	}
+
+	s.size = fi.Size()
+
+	return
+}
+
+// checkStore returns ErrFileModified where the database file has been modified
+// by another process, as per fileStore.checkSize, and should be called before
+// writing to the Store. Stores other than files are never checked
+func (j *JDB) checkStore() error {
+	if s, ok := j.store.(interface{ checkSize() error }); ok {
+		return s.checkSize()
+	}
+
+	return nil
+}
+
+// writeTemp writes the output of fn to f, syncing and closing
+// it afterwards
+func writeTemp(f *os.File, mode os.FileMode, fn func(io.Writer) error) (err error) {
+	defer func() {
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+
+	err = fn(w)
+	if err != nil {
+		return
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return
+	}
+
+	err = f.Chmod(mode)
+	if err != nil {
+		return
+	}
+
+	return f.Sync()
+}
+
+// MemoryStore is a Store which keeps everything in memory.
+//
+// Unlike a JDB returned by `NewInMemory`, which persists nothing at all, a
+// MemoryStore holds the exact bytes a database file would, which makes it
+// useful for testing, or as a starting point for other Stores.
+//
+// The zero value is an empty Store, ready to use.
+type MemoryStore struct {
+	mutex sync.Mutex
+	data  []byte
+	off   int
+}
+
+// NewMemoryStore returns a MemoryStore containing b, which is useful for
+// loading an existing database into memory
+func NewMemoryStore(b []byte) *MemoryStore {
+	return &MemoryStore{data: bytes.Clone(b)}
+}
+
+// Read implements io.Reader
+func (s *MemoryStore) Read(p []byte) (n int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.off >= len(s.data) {
+		return 0, io.EOF
+	}
+
+	n = copy(p, s.data[s.off:])
+	s.off += n
+
+	return
+}
+
+// Write implements io.Writer, and always appends
+func (s *MemoryStore) Write(p []byte) (n int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.data = append(s.data, p...)
+
+	return len(p), nil
+}
+
+// Close implements io.Closer, and does nothing
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Rewrite implements Store, only replacing the contents of the MemoryStore
+// once fn has succeeded
+func (s *MemoryStore) Rewrite(fn func(io.Writer) error) (err error) {
+	buf := new(bytes.Buffer)
+
+	err = fn(buf)
+	if err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.data = buf.Bytes()
+	s.off = len(s.data)
+
+	return
+}
+
+// Bytes returns a copy of everything written to the MemoryStore
+func (s *MemoryStore) Bytes() []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return bytes.Clone(s.data)
+}
@@ -0,0 +1,271 @@
+package jdb_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestNewWithStore(t *testing.T) {
+	store := new(jdb.MemoryStore)
+
+	db, err := jdb.NewWithStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flushing between inserting and upserting ensures both versions of each
+	// Measurement are persisted; superseded Measurements which are still
+	// buffered are never written
+	now := time.Now()
+	for _, fn := range []func(*jdb.Measurement) error{db.Insert, db.Upsert} {
+		for i := 0; i < 10; i++ {
+			err = fn(&jdb.Measurement{
+				Name: "wibbles",
+				When: now.Add(0 - time.Minute*time.Duration(i)),
+				Dimensions: map[string]float64{
+					"wobble_count": float64(i * 17),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = db.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flushed := store.Bytes()
+
+	t.Run("Flushing persists to the store", func(t *testing.T) {
+		if lines := bytes.Count(flushed, []byte{'\n'}); lines != 20 {
+			t.Errorf("expected 20 lines, received %d", lines)
+		}
+	})
+
+	t.Run("Compacting rewrites the store", func(t *testing.T) {
+		err = db.Compact()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if lines := bytes.Count(store.Bytes(), []byte{'\n'}); lines != 10 {
+			t.Errorf("expected 10 lines, received %d", lines)
+		}
+	})
+
+	t.Run("Stores can be reloaded", func(t *testing.T) {
+		for _, b := range [][]byte{flushed, store.Bytes()} {
+			db, err := jdb.NewWithStore(jdb.NewMemoryStore(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := db.QueryAll("wibbles", &jdb.Options{Deduplicate: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m) != 10 {
+				t.Errorf("expected 10 measurements, received %d", len(m))
+			}
+		}
+	})
+
+	t.Run("Invalid stores fail to load", func(t *testing.T) {
+		_, err := jdb.NewWithStore(jdb.NewMemoryStore([]byte("not a database\n")))
+		if err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestNew_FileModified(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	start := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+	i := 0
+
+	// insert inserts and flushes a single Measurement, returning any error
+	// from flushing
+	insert := func(t *testing.T, db *jdb.JDB) error {
+		t.Helper()
+
+		err := db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       start.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		i++
+
+		return db.Flush()
+	}
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Writes succeed while the file is untouched", func(t *testing.T) {
+		for n := 0; n < 3; n++ {
+			err = insert(t, db)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = db.Compact()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = insert(t, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// A second JDB opened on the same file, as per another process
+	other, err := jdb.New(f.Name(), jdb.WithoutLock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = insert(t, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Flushing after another writer fails", func(t *testing.T) {
+		err = insert(t, db)
+		if !errors.Is(err, jdb.ErrFileModified) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrFileModified, err)
+		}
+
+		if n := db.BufferLen(); n != 1 {
+			t.Errorf("expected 1 buffered measurement, received %d", n)
+		}
+	})
+
+	t.Run("Compacting after another writer fails", func(t *testing.T) {
+		err = db.Compact()
+		if !errors.Is(err, jdb.ErrFileModified) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrFileModified, err)
+		}
+	})
+
+	t.Run("The other writer's data survives", func(t *testing.T) {
+		err = other.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := jdb.OpenReadOnly(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		m, err := db.QueryAll("wibbles", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 5 {
+			t.Errorf("expected 5 measurements, received %d", len(m))
+		}
+	})
+
+	t.Run("Closing after another writer still releases the lock", func(t *testing.T) {
+		err = db.Close()
+		if !errors.Is(err, jdb.ErrFileModified) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrFileModified, err)
+		}
+
+		db, err := jdb.New(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	})
+}
+
+func TestNew_Locked(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := jdb.New(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Opening a locked file fails", func(t *testing.T) {
+		_, err := jdb.New(f.Name())
+		if !errors.Is(err, jdb.ErrLocked) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrLocked, err)
+		}
+	})
+
+	t.Run("The lock survives compaction", func(t *testing.T) {
+		err := db.Compact()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = jdb.New(f.Name())
+		if !errors.Is(err, jdb.ErrLocked) {
+			t.Errorf("expected %#v, received %#v", jdb.ErrLocked, err)
+		}
+	})
+
+	for _, test := range []struct {
+		name string
+		open func() (*jdb.JDB, error)
+	}{
+		{"Opening a locked file read-only succeeds", func() (*jdb.JDB, error) { return jdb.OpenReadOnly(f.Name()) }},
+		{"Opening a locked file without locking succeeds", func() (*jdb.JDB, error) { return jdb.New(f.Name(), jdb.WithoutLock()) }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			other, err := test.open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			other.Close()
+		})
+	}
+
+	t.Run("Closing releases the lock", func(t *testing.T) {
+		err := db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := jdb.New(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	})
+}
@@ -0,0 +1,76 @@
+package jdb
+
+// SubscriptionBufferSize is the number of Measurements each channel returned by
+// `JDB.Subscribe` buffers before Measurements are dropped
+var SubscriptionBufferSize = 256
+
+// Subscribe returns a channel which receives every Measurement successfully
+// inserted via `Insert`, `InsertNow`, `Upsert`, or `InsertBatch` from now on,
+// such as for pushing new data to a websocket, along with a function which
+// unsubscribes, closing the channel.
+//
+// Measurements are sent without blocking, so that slow subscribers never hold up
+// inserts. Instead, each channel buffers up to SubscriptionBufferSize Measurements,
+// beyond which Measurements are dropped for that subscriber, and logged via Logger.
+// Subscribers which can't afford to miss anything should keep up, or fall back to
+// querying.
+//
+// Measurements loaded from disk, or added via `Merge`, aren't sent to subscribers.
+//
+// Closing the database closes every subscribed channel. Subscribing to a closed
+// database returns a closed channel. The unsubscribe function is safe to call more
+// than once, and after the database is closed
+func (j *JDB) Subscribe() (<-chan *Measurement, func()) {
+	j.saveMutex.Lock()
+	defer j.saveMutex.Unlock()
+
+	c := make(chan *Measurement, SubscriptionBufferSize)
+	if j.closed {
+		close(c)
+
+		return c, func() {}
+	}
+
+	if j.subscriptions == nil {
+		j.subscriptions = make(map[chan *Measurement]bool)
+	}
+
+	j.subscriptions[c] = true
+
+	return c, func() {
+		j.saveMutex.Lock()
+		defer j.saveMutex.Unlock()
+
+		if j.subscriptions[c] {
+			delete(j.subscriptions, c)
+			close(c)
+		}
+	}
+}
+
+// publish sends ms to every subscriber, dropping Measurements for any
+// subscriber whose buffer is full.
+//
+// Callers must hold saveMutex
+func (j *JDB) publish(ms ...*Measurement) {
+	for c := range j.subscriptions {
+		for _, m := range ms {
+			select {
+			case c <- expand(m):
+			default:
+				Logger.Warn("Dropping Measurement for slow subscriber", "name", m.Name, "when", m.When)
+			}
+		}
+	}
+}
+
+// closeSubscriptions closes every subscribed channel, and stops any further
+// subscriptions. Callers must hold saveMutex
+func (j *JDB) closeSubscriptions() {
+	for c := range j.subscriptions {
+		close(c)
+	}
+
+	j.subscriptions = nil
+	j.closed = true
+}
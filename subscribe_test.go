@@ -0,0 +1,106 @@
+package jdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_Subscribe(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c1, unsubscribe1 := db.Subscribe()
+	c2, unsubscribe2 := db.Subscribe()
+
+	defer unsubscribe2()
+
+	now := time.Now()
+	insert := func(i int) error {
+		return db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       now.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+		})
+	}
+
+	for i := 0; i < 3; i++ {
+		err = insert(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Failed inserts aren't sent
+	err = insert(0)
+	if err == nil {
+		t.Fatal("expected error, received none")
+	}
+
+	err = db.InsertBatch([]*jdb.Measurement{{
+		Name:       "wibbles",
+		When:       now.Add(time.Hour),
+		Dimensions: map[string]float64{"wobble_count": 3},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Every subscriber receives every insert", func(t *testing.T) {
+		for _, c := range []<-chan *jdb.Measurement{c1, c2} {
+			for i := 0; i < 4; i++ {
+				select {
+				case m := <-c:
+					if m.Dimensions["wobble_count"] != float64(i) {
+						t.Errorf("expected: %v, received %v", i, m.Dimensions["wobble_count"])
+					}
+
+				case <-time.After(time.Second):
+					t.Fatal("timed out waiting for measurement")
+				}
+			}
+		}
+	})
+
+	t.Run("Unsubscribing closes the channel", func(t *testing.T) {
+		unsubscribe1()
+		unsubscribe1()
+
+		if _, ok := <-c1; ok {
+			t.Error("expected channel to be closed")
+		}
+	})
+
+	t.Run("Slow subscribers don't block inserts", func(t *testing.T) {
+		for i := 0; i < jdb.SubscriptionBufferSize+10; i++ {
+			err = insert(100 + i)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(c2) != jdb.SubscriptionBufferSize {
+			t.Errorf("expected %d buffered measurements, received %d", jdb.SubscriptionBufferSize, len(c2))
+		}
+	})
+
+	t.Run("Closing the database closes every channel", func(t *testing.T) {
+		err := db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for range c2 {
+		}
+
+		c3, unsubscribe3 := db.Subscribe()
+		defer unsubscribe3()
+
+		if _, ok := <-c3; ok {
+			t.Error("expected channel to be closed")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package jdb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrTransformToSelf returns when calling Transform with the same source and
+// destination, which would have Transform read a file as it writes to it
+var ErrTransformToSelf = errors.New("cannot transform a database into its own file")
+
+// Transform streams every Measurement from the database file at srcPath through fn,
+// writing the results to a new database at dstPath, and returning the number of
+// Measurements written.
+//
+// This is the general purpose migration tool for jdb; renaming dimensions, changing
+// index schemes, filtering, or downsampling can all be done within fn. Where fn returns
+// a nil Measurement, that Measurement is dropped. Where fn returns an error, Transform
+// stops and returns that error.
+//
+// The source database is read line by line, rather than being loaded into memory
+// as per `New`, and is never written to. Measurements are written to the destination
+// with `Upsert`, so that superseded values in the source remain superseded.
+//
+// opts configure the destination database. Where the source database needs options
+// of its own, such as an encryption key, use `TransformWithOptions`.
+//
+// srcPath and dstPath must be different files, or Transform returns ErrTransformToSelf
+func Transform(srcPath, dstPath string, fn func(*Measurement) (*Measurement, error), opts ...OpenOption) (int, error) {
+	return TransformWithOptions(srcPath, dstPath, fn, nil, opts...)
+}
+
+// TransformWithOptions works identically to `Transform`, but additionally accepts
+// srcOpts to configure how the source database is read.
+//
+// As per `Decode`, the Codec is detected from the file header, and so the only
+// srcOpt needed is `WithEncryptionKey`, for encrypted sources. Because dstOpts
+// configure the destination separately, a source may be re-encrypted with a
+// different key, or decrypted entirely, as it is transformed
+func TransformWithOptions(srcPath, dstPath string, fn func(*Measurement) (*Measurement, error), srcOpts []OpenOption, dstOpts ...OpenOption) (n int, err error) {
+	if samePath(srcPath, dstPath) {
+		return 0, ErrTransformToSelf
+	}
+
+	reader, err := newJDB(srcOpts)
+	if err != nil {
+		return
+	}
+
+	// #nosec: G304
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return
+	}
+
+	defer src.Close()
+
+	dst, err := New(dstPath, dstOpts...)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		closeErr := dst.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	_, err = reader.scan(src, func(m *Measurement) (err error) {
+		m, err = fn(m)
+		if err != nil || m == nil {
+			return
+		}
+
+		err = dst.Upsert(m)
+		if err != nil {
+			return
+		}
+
+		n++
+
+		return
+	})
+
+	return
+}
+
+// samePath returns true where a and b refer to the same file, either because
+// they resolve to the same absolute path or, where both exist, because they
+// are links to one another
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA == nil && errB == nil && absA == absB {
+		return true
+	}
+
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
@@ -0,0 +1,213 @@
+package jdb_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestTransform(t *testing.T) {
+	src, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Close()
+
+	db, err := jdb.New(src.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name: "wibbles",
+			When: now.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{
+				"wobble_count": float64(i),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		fn          func(*jdb.Measurement) (*jdb.Measurement, error)
+		expectCount int
+		expectErr   bool
+	}{
+		{"Erroring transformations fail", func(*jdb.Measurement) (*jdb.Measurement, error) { return nil, errors.New("oh no") }, 0, true},
+		{"Invalid transformations fail", func(m *jdb.Measurement) (*jdb.Measurement, error) { m.Name = ""; return m, nil }, 0, true},
+		{"Dropping measurements writes nothing", func(*jdb.Measurement) (*jdb.Measurement, error) { return nil, nil }, 0, false},
+		{"Renaming a dimension writes everything", func(m *jdb.Measurement) (*jdb.Measurement, error) {
+			m.Dimensions["wobble_total"] = m.Dimensions["wobble_count"]
+			delete(m.Dimensions, "wobble_count")
+
+			return m, nil
+		}, 10, false},
+		{"Filtering writes a subset", func(m *jdb.Measurement) (*jdb.Measurement, error) {
+			if m.Dimensions["wobble_count"] >= 5 {
+				return nil, nil
+			}
+
+			return m, nil
+		}, 5, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dst, err := os.CreateTemp("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst.Close()
+
+			n, err := jdb.Transform(src.Name(), dst.Name(), test.fn)
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectCount != n {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, n)
+			}
+
+			if test.expectErr || test.expectCount == 0 {
+				return
+			}
+
+			db, err := jdb.New(dst.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer db.Close()
+
+			m, err := db.QueryAll("wibbles", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+		})
+	}
+}
+
+func TestTransform_ToSelf(t *testing.T) {
+	src, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Close()
+
+	passthrough := func(m *jdb.Measurement) (*jdb.Measurement, error) { return m, nil }
+
+	for _, test := range []struct {
+		name string
+		dst  string
+	}{
+		{"Identical paths fail", src.Name()},
+		{"Uncleaned paths fail", filepath.Dir(src.Name()) + "/./" + filepath.Base(src.Name())},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := jdb.Transform(src.Name(), test.dst, passthrough)
+			if !errors.Is(err, jdb.ErrTransformToSelf) {
+				t.Errorf("expected %#v, received %#v", jdb.ErrTransformToSelf, err)
+			}
+		})
+	}
+}
+
+func TestTransformWithOptions(t *testing.T) {
+	srcKey := bytes.Repeat([]byte{0xab}, 32)
+	dstKey := bytes.Repeat([]byte{0xcd}, 32)
+
+	src, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Close()
+
+	db, err := jdb.New(src.Name(), jdb.WithEncryptionKey(srcKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       now.Add(time.Minute * time.Duration(i)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passthrough := func(m *jdb.Measurement) (*jdb.Measurement, error) { return m, nil }
+
+	for _, test := range []struct {
+		name        string
+		srcOpts     []jdb.OpenOption
+		expectCount int
+		expectErr   bool
+	}{
+		{"Without the source key, transforming fails", nil, 0, true},
+		{"With the wrong source key, transforming fails", []jdb.OpenOption{jdb.WithEncryptionKey(dstKey)}, 0, true},
+		{"With the source key, everything is re-encrypted", []jdb.OpenOption{jdb.WithEncryptionKey(srcKey)}, 10, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dst, err := os.CreateTemp("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst.Close()
+
+			n, err := jdb.TransformWithOptions(src.Name(), dst.Name(), passthrough, test.srcOpts, jdb.WithEncryptionKey(dstKey))
+			if test.expectErr == (err == nil) {
+				t.Errorf("expected: %v, received %#v", test.expectErr, err)
+			}
+
+			if test.expectCount != n {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, n)
+			}
+
+			if test.expectErr {
+				return
+			}
+
+			db, err := jdb.New(dst.Name(), jdb.WithEncryptionKey(dstKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer db.Close()
+
+			m, err := db.QueryAll("wibbles", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectCount != len(m) {
+				t.Errorf("expected %d measurements, received %d", test.expectCount, len(m))
+			}
+		})
+	}
+}
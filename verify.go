@@ -0,0 +1,104 @@
+package jdb
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrInconsistent returns from `JDB.Verify` when the in-memory structures
+// of a JDB disagree with one another
+var ErrInconsistent = errors.New("database is inconsistent")
+
+// VerifyReport describes the outcome of `JDB.Verify`, counting anomalies by
+// category. A consistent JDB has no anomalies
+type VerifyReport struct {
+	// Measurements is the number of Measurements checked, including any
+	// duplicates created by `Upsert` which have yet to be compacted away
+	Measurements int `json:"measurements"`
+
+	// UnsortedShards is the number of shards, across both Measurement names
+	// and indices, which aren't sorted by When
+	UnsortedShards int `json:"unsorted_shards"`
+
+	// MissingIDs is the number of ids, derived from the Measurements held in
+	// memory, which aren't present in the ids map
+	MissingIDs int `json:"missing_ids"`
+
+	// DanglingIDs is the number of entries in the ids map which point to a
+	// Measurement which either isn't held in memory, or which doesn't derive
+	// that id
+	DanglingIDs int `json:"dangling_ids"`
+}
+
+// Anomalies returns the total number of anomalies found
+func (r VerifyReport) Anomalies() int {
+	return r.UnsortedShards + r.MissingIDs + r.DanglingIDs
+}
+
+// Verify audits the in-memory structures of this JDB for consistency, such as
+// after recovering from a crash, and before trusting the data within. It checks
+// that:
+//
+//  1. Every shard is sorted by When
+//  2. Every id derived from every Measurement is present in the ids map
+//  3. Every entry in the ids map points to a Measurement which is held in memory
+//
+// Where any anomalies are found, Verify returns an error wrapping ErrInconsistent,
+// alongside a report counting them.
+//
+// Verify doesn't look at the database file itself, and so is distinct from the
+// recovery jdb does when loading a file
+func (j *JDB) Verify() (report VerifyReport, err error) {
+	j.saveMutex.RLock()
+	defer j.saveMutex.RUnlock()
+
+	byWhen := func(a, b *Measurement) int {
+		return a.When.Compare(b.When)
+	}
+
+	held := make(map[*Measurement]bool)
+
+	for _, shards := range j.measurements {
+		for _, shard := range shards {
+			if !slices.IsSortedFunc(shard, byWhen) {
+				report.UnsortedShards++
+			}
+
+			for _, m := range shard {
+				report.Measurements++
+				held[m] = true
+
+				for _, id := range m.ids(j.dedupe) {
+					if _, ok := j.ids[id]; !ok {
+						report.MissingIDs++
+					}
+				}
+			}
+		}
+	}
+
+	for _, measurement := range j.indices {
+		for _, idx := range measurement {
+			for _, shards := range idx {
+				for _, shard := range shards {
+					if !slices.IsSortedFunc(shard, byWhen) {
+						report.UnsortedShards++
+					}
+				}
+			}
+		}
+	}
+
+	for id, m := range j.ids {
+		if !held[m] || !slices.Contains(m.ids(j.dedupe), id) {
+			report.DanglingIDs++
+		}
+	}
+
+	if report.Anomalies() > 0 {
+		err = fmt.Errorf("%w: %d unsorted shards, %d missing ids, %d dangling ids", ErrInconsistent, report.UnsortedShards, report.MissingIDs, report.DanglingIDs)
+	}
+
+	return
+}
@@ -0,0 +1,67 @@
+package jdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jspc/jdb"
+)
+
+func TestJDB_Verify(t *testing.T) {
+	db, err := jdb.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	t.Run("Empty databases are consistent", func(t *testing.T) {
+		report, err := db.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if report.Anomalies() != 0 {
+			t.Errorf("expected no anomalies, received %#v", report)
+		}
+	})
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		// Insert out of order, to ensure shards are sorted
+		err = db.Insert(&jdb.Measurement{
+			Name:       "wibbles",
+			When:       now.Add(0 - time.Minute*time.Duration((i*7)%10)),
+			Dimensions: map[string]float64{"wobble_count": float64(i)},
+			Indices:    map[string]string{"sensor": "a", "room": "kitchen"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.Upsert(&jdb.Measurement{
+		Name:       "wibbles",
+		When:       now,
+		Dimensions: map[string]float64{"wobble_count": 100},
+		Indices:    map[string]string{"sensor": "a", "room": "kitchen"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Populated databases are consistent", func(t *testing.T) {
+		report, err := db.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if report.Anomalies() != 0 {
+			t.Errorf("expected no anomalies, received %#v", report)
+		}
+
+		if report.Measurements != 11 {
+			t.Errorf("expected %d measurements, received %d", 11, report.Measurements)
+		}
+	})
+}